@@ -9,6 +9,7 @@ import (
 var DefaultFileName = "app-config.yaml"
 var DefaultLocation = fmt.Sprintf("file://~/.swiz/%v", DefaultFileName)
 var DefaultOutLocation = "file://./out"
+var DefaultPluginLocation = "file://~/.swiz/plugins"
 
 type EnvDef struct {
 	Name       string `yaml:"name"`
@@ -20,6 +21,7 @@ type AppConfig struct {
 	DefaultEnv       string   `yaml:"default_env"`
 	EnvDefinition    []EnvDef `yaml:"env_def"`
 	DisabledCommands []string `yaml:"disabled_commands"`
+	PluginDir        string   `yaml:"plugin_dir,omitempty"`
 	BaseDir          string   `yaml:"-"`
 }
 
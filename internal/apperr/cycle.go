@@ -0,0 +1,30 @@
+package apperr
+
+import (
+	"fmt"
+	"strings"
+)
+
+type CycleErr struct {
+	Subject string
+	Path    []string
+}
+
+func NewCycleError(subject string, path []string) *CycleErr {
+	return &CycleErr{
+		Subject: subject,
+		Path:    path,
+	}
+}
+
+func (e *CycleErr) Error() string {
+
+	return fmt.Sprintf("%v dependency cycle detected: %v", e.Subject, strings.Join(e.Path, " -> "))
+}
+
+func (e *CycleErr) Is(tgt error) bool {
+	_, ok := tgt.(*CycleErr)
+	return ok
+}
+
+var GenCycleError = &CycleErr{}
@@ -0,0 +1,34 @@
+package apperr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewCycleError(t *testing.T) {
+	err := NewCycleError("stack", []string{"a", "b", "a"})
+
+	assert.NotNil(t, err, "NewCycleError should not return nil")
+	assert.Equal(t, "stack", err.Subject, "Expected subject 'stack'")
+	assert.Equal(t, []string{"a", "b", "a"}, err.Path, "Expected path to match")
+}
+
+func TestCycleErr_Error(t *testing.T) {
+	err := &CycleErr{
+		Subject: "stack",
+		Path:    []string{"a", "b", "a"},
+	}
+
+	expectedMessage := "stack dependency cycle detected: a -> b -> a"
+	assert.Equal(t, expectedMessage, err.Error(), "Expected error message to match")
+}
+
+func TestCycleErr_Is(t *testing.T) {
+	err := &CycleErr{
+		Subject: "stack",
+		Path:    []string{"a", "b", "a"},
+	}
+
+	assert.True(t, err.Is(GenCycleError), "Expected Is method to return true")
+	assert.False(t, err.Is(nil), "Expected Is method to return false")
+}
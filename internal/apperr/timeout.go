@@ -0,0 +1,33 @@
+package apperr
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type TimeoutErr struct {
+	Subject string
+	Names   []string
+	Timeout time.Duration
+}
+
+func NewTimeoutError(subject string, names []string, timeout time.Duration) *TimeoutErr {
+	return &TimeoutErr{
+		Subject: subject,
+		Names:   names,
+		Timeout: timeout,
+	}
+}
+
+func (e *TimeoutErr) Error() string {
+
+	return fmt.Sprintf("timed out after %v waiting on %v %v", e.Timeout, e.Subject, strings.Join(e.Names, ", "))
+}
+
+func (e *TimeoutErr) Is(tgt error) bool {
+	_, ok := tgt.(*TimeoutErr)
+	return ok
+}
+
+var GenTimeoutError = &TimeoutErr{}
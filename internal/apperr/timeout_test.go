@@ -0,0 +1,37 @@
+package apperr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewTimeoutError(t *testing.T) {
+	err := NewTimeoutError("stack", []string{"a", "b"}, 30*time.Minute)
+
+	assert.NotNil(t, err, "NewTimeoutError should not return nil")
+	assert.Equal(t, "stack", err.Subject, "Expected subject 'stack'")
+	assert.Equal(t, []string{"a", "b"}, err.Names, "Expected names to match")
+	assert.Equal(t, 30*time.Minute, err.Timeout, "Expected timeout to match")
+}
+
+func TestTimeoutErr_Error(t *testing.T) {
+	err := &TimeoutErr{
+		Subject: "stack",
+		Names:   []string{"a", "b"},
+		Timeout: 30 * time.Minute,
+	}
+
+	expectedMessage := "timed out after 30m0s waiting on stack a, b"
+	assert.Equal(t, expectedMessage, err.Error(), "Expected error message to match")
+}
+
+func TestTimeoutErr_Is(t *testing.T) {
+	err := &TimeoutErr{
+		Subject: "stack",
+		Names:   []string{"a"},
+	}
+
+	assert.True(t, err.Is(GenTimeoutError), "Expected Is method to return true")
+	assert.False(t, err.Is(nil), "Expected Is method to return false")
+}
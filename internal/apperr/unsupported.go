@@ -0,0 +1,29 @@
+package apperr
+
+import (
+	"fmt"
+)
+
+type UnsupportedErr struct {
+	Feature string
+	Subject string
+}
+
+func NewUnsupportedError(feature string, subject string) *UnsupportedErr {
+	return &UnsupportedErr{
+		Feature: feature,
+		Subject: subject,
+	}
+}
+
+func (e *UnsupportedErr) Error() string {
+
+	return fmt.Sprintf("%v is not supported by %v", e.Feature, e.Subject)
+}
+
+func (e *UnsupportedErr) Is(tgt error) bool {
+	_, ok := tgt.(*UnsupportedErr)
+	return ok
+}
+
+var GenUnsupportedError = &UnsupportedErr{}
@@ -0,0 +1,34 @@
+package apperr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewUnsupportedError(t *testing.T) {
+	err := NewUnsupportedError("rollback", "Terraform")
+
+	assert.NotNil(t, err, "NewUnsupportedError should not return nil")
+	assert.Equal(t, "rollback", err.Feature, "Expected feature 'rollback'")
+	assert.Equal(t, "Terraform", err.Subject, "Expected subject 'Terraform'")
+}
+
+func TestUnsupportedErr_Error(t *testing.T) {
+	err := &UnsupportedErr{
+		Feature: "rollback",
+		Subject: "Terraform",
+	}
+
+	expectedMessage := "rollback is not supported by Terraform"
+	assert.Equal(t, expectedMessage, err.Error(), "Expected error message to match")
+}
+
+func TestUnsupportedErr_Is(t *testing.T) {
+	err := &UnsupportedErr{
+		Feature: "rollback",
+		Subject: "Terraform",
+	}
+
+	assert.True(t, err.Is(GenUnsupportedError), "Expected Is method to return true")
+	assert.False(t, err.Is(nil), "Expected Is method to return false")
+}
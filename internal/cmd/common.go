@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"github.com/swizzleio/swiz/internal/environment"
+	"github.com/swizzleio/swiz/internal/environment/model"
 	"github.com/urfave/cli/v2"
 	"strings"
+	"time"
 )
 
 func genCommandPreflight(appConfigSoftFail bool) cli.BeforeFunc {
@@ -47,3 +52,57 @@ func genCommandPreflight(appConfigSoftFail bool) cli.BeforeFunc {
 		return nil
 	}
 }
+
+// reportInterrupted prints the stacks that were still in progress when a command was cancelled. true is returned if
+// there were any.
+func reportInterrupted(err error) bool {
+	var interruptErr *environment.InterruptedErr
+	if !errors.As(err, &interruptErr) || len(interruptErr.Stacks) == 0 {
+		return false
+	}
+
+	cl.Info("Stacks still in progress:\n")
+	for _, stack := range interruptErr.Stacks {
+		cl.Info("  %v\n", stack)
+	}
+
+	return true
+}
+
+// runInterruptible runs a command that stops once its context is cancelled. true is returned if Ctrl-C was pressed
+// again before the command stopped.
+func runInterruptible(ctx context.Context, run func() error) (bool, error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- run()
+	}()
+
+	cancelled := ctx.Done()
+	pressedAgain := false
+	for {
+		select {
+		case err := <-done:
+			return pressedAgain, err
+		case <-cancelled:
+			cl.Info("Press Ctrl-C again to cancel the in progress updates\n")
+			cancelled = nil
+		case <-interrupts:
+			if !pressedAgain {
+				cl.Info("The in progress updates will be cancelled once the deploy stops\n")
+			}
+			pressedAgain = true
+		}
+	}
+}
+
+// printEvent prints a stack event prefixed with the stack name, so the events of stacks deployed in parallel can be
+// told apart
+func printEvent(event model.StackEvent) {
+	reason := ""
+	if event.Reason != "" {
+		reason = " - " + event.Reason
+	}
+
+	cl.Info("[%v] %v %v %v %v%v\n", event.StackName, event.Timestamp.Local().Format(time.TimeOnly), event.Status,
+		event.ResourceType, event.LogicalId, reason)
+}
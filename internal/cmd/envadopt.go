@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"github.com/swizzleio/swiz/internal/environment"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	addSubCommand("env", &cli.Command{
+		Name:   "adopt",
+		Usage:  "Adopt stacks that were deployed outside of swiz into an environment",
+		Action: envAdoptCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "name",
+				Aliases:  []string{"n"},
+				Usage:    "Name of the environment",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "stack",
+				Aliases:  []string{"s"},
+				Usage:    "Stack to adopt as stack=deployed-name. Can be specified multiple times or be a comma seperated list",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:        "env-def",
+				Aliases:     []string{"d"},
+				Usage:       "Environment definition to use",
+				DefaultText: "",
+			},
+			&cli.StringFlag{
+				Name:        "enclave",
+				Aliases:     []string{"e"},
+				Usage:       "Enclave to use",
+				DefaultText: "",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Check the stacks against their templates without adopting them",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Adopt the stacks without checking them against their templates",
+			},
+		},
+	})
+}
+
+func envAdoptCmd(ctx *cli.Context) error {
+	enclave := ctx.String("enclave")
+	envDef := ctx.String("env-def")
+	envName := ctx.String("name")
+
+	stacks, err := model.ParseAdoptedStacks(ctx.StringSlice("stack"))
+	if err != nil {
+		return err
+	}
+
+	svc, err := environment.NewEnvService(appConfigMgr.Get())
+	if err != nil {
+		return err
+	}
+	svc.SetEventHandler(printEvent)
+
+	stackInfo, err := svc.AdoptStacks(ctx.Context, enclave, envDef, envName, environment.AdoptOpts{
+		Stacks: stacks,
+		DryRun: ctx.Bool("dry-run"),
+		Force:  ctx.Bool("force"),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, stack := range stackInfo {
+		cl.Info("Stack: %v [%v] - %v\n", stack.Name, stack.DeployStatus.State, stack.DeployStatus.Reason)
+	}
+
+	return nil
+}
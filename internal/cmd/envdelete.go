@@ -41,6 +41,14 @@ func init() {
 				Name:  "fast-delete",
 				Usage: "Delete everything in parallel. Can be overridden in config",
 			},
+			&cli.IntFlag{
+				Name:  "parallel",
+				Usage: "Maximum number of stacks to delete at once, 0 for no limit. Can be overridden in config",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "Maximum time for the whole delete, such as 2h. 0 for no limit. Can be overridden in config",
+			},
 		},
 	})
 }
@@ -49,17 +57,23 @@ func envDeleteCmd(ctx *cli.Context) error {
 	enclave := ctx.String("enclave")
 	envDef := ctx.String("env-def")
 	envName := ctx.String("name")
-	dryRun := ctx.Bool("dry-run")
-	noOrphanDelete := ctx.Bool("no-orphan-delete")
-	fastDelete := ctx.Bool("fast-delete")
 
 	svc, err := environment.NewEnvService(appConfigMgr.Get())
 	if err != nil {
 		return err
 	}
+	svc.SetEventHandler(printEvent)
 
-	stackInfo, err := svc.DeleteEnvironment(ctx.Context, enclave, envDef, envName, dryRun, noOrphanDelete, fastDelete)
+	stackInfo, err := svc.DeleteEnvironment(ctx.Context, enclave, envDef, envName, environment.DeleteOpts{
+		DryRun:         ctx.Bool("dry-run"),
+		NoOrphanDelete: ctx.Bool("no-orphan-delete"),
+		FastDelete:     ctx.Bool("fast-delete"),
+		MaxParallel:    ctx.Int("parallel"),
+		Timeout:        ctx.Duration("timeout"),
+	})
 	if err != nil {
+		// Deletes can't be cancelled
+		reportInterrupted(err)
 		return err
 	}
 
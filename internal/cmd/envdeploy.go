@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/swizzleio/swiz/internal/environment"
+	"github.com/swizzleio/swiz/internal/environment/model"
 	"strings"
 
 	"github.com/urfave/cli/v2"
@@ -48,6 +52,42 @@ func init() {
 				Name:  "no-update-deploy",
 				Usage: "Fail if a stack or environment already exists. Can be overridden in config",
 			},
+			&cli.BoolFlag{
+				Name:  "with-deps",
+				Usage: "Also deploy the stacks that the selected stacks depend on if they are not already deployed",
+			},
+			&cli.BoolFlag{
+				Name:  "downstream",
+				Usage: "Also redeploy every stack that uses outputs from the selected stacks",
+			},
+			&cli.IntFlag{
+				Name:  "parallel",
+				Usage: "Maximum number of stacks to deploy at once, 0 for no limit. Can be overridden in config",
+			},
+			&cli.BoolFlag{
+				Name:  "rollback",
+				Usage: "Roll back the stacks changed by this deploy if any stack fails. Can be overridden in config",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "Maximum time for the whole deploy, such as 2h. 0 for no limit. Can be overridden in config",
+			},
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Resume the last interrupted deploy of this environment. Use the same flags as the interrupted deploy",
+			},
+			&cli.BoolFlag{
+				Name:  "review",
+				Usage: "Show the changes of each stack update and ask before applying them",
+			},
+			&cli.BoolFlag{
+				Name:  "review-all",
+				Usage: "Show the changes of every stack update and ask once before deploying the environment",
+			},
+			&cli.BoolFlag{
+				Name:  "auto-approve",
+				Usage: "Show the changes of a review but apply them without asking, such as in CI",
+			},
 		},
 	})
 }
@@ -57,9 +97,6 @@ func envCreateCmd(ctx *cli.Context) error {
 	envDef := ctx.String("env-def")
 	envName := ctx.String("name")
 	stacks := ctx.StringSlice("stack")
-	deployAll := ctx.Bool("deploy-all")
-	dryRun := ctx.Bool("dry-run")
-	noUpdate := ctx.Bool("no-update-deploy")
 
 	stackList := []string{}
 	for _, stack := range stacks {
@@ -71,9 +108,60 @@ func envCreateCmd(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	svc.SetEventHandler(printEvent)
 
-	stackInfo, err := svc.DeployEnvironment(ctx.Context, enclave, envDef, envName, deployAll, stackList, dryRun, noUpdate)
+	opts := environment.DeployOpts{
+		DeployAll:   ctx.Bool("deploy-all"),
+		Stacks:      stackList,
+		DryRun:      ctx.Bool("dry-run"),
+		NoUpdate:    ctx.Bool("no-update-deploy"),
+		WithDeps:    ctx.Bool("with-deps"),
+		Downstream:  ctx.Bool("downstream"),
+		MaxParallel: ctx.Int("parallel"),
+		Rollback:    ctx.Bool("rollback"),
+		Resume:      ctx.Bool("resume"),
+		Timeout:     ctx.Duration("timeout"),
+	}
+
+	autoApprove := ctx.Bool("auto-approve")
+	if ctx.Bool("review-all") && !opts.DryRun {
+		approved, reviewErr := reviewEnvironment(ctx.Context, svc, enclave, envDef, envName, opts, autoApprove)
+		if reviewErr != nil {
+			return reviewErr
+		}
+		if !approved {
+			cl.Info("Deploy cancelled\n")
+			return nil
+		}
+	}
+	if ctx.Bool("review") {
+		opts.Approve = func(stackName string, changes []model.ResourceChange) (bool, error) {
+			printChanges(stackName, changes)
+			if autoApprove {
+				return true, nil
+			}
+			return cl.AskConfirm(fmt.Sprintf("Apply the changes to stack %v?", stackName))
+		}
+	}
+
+	var stackInfo []*model.StackInfo
+	cancelRequested, err := runInterruptible(ctx.Context, func() error {
+		var deployErr error
+		stackInfo, deployErr = svc.DeployEnvironment(ctx.Context, enclave, envDef, envName, opts)
+		return deployErr
+	})
 	if err != nil {
+		var rollbackErr *environment.RollbackErr
+		if errors.As(err, &rollbackErr) {
+			cl.Info("Rollback summary:\n")
+			for _, stack := range rollbackErr.Stacks {
+				cl.Info("Stack: %v [%v] - %v\n", stack.Name, stack.DeployStatus.State, stack.DeployStatus.Reason)
+			}
+		}
+
+		if reportInterrupted(err) && cancelRequested {
+			cancelUpdates(svc, enclave, envDef, envName, err)
+		}
 		return err
 	}
 
@@ -83,3 +171,88 @@ func envCreateCmd(ctx *cli.Context) error {
 
 	return nil
 }
+
+// reviewEnvironment shows the changes of a dry run of the deploy and asks to confirm them all at once. The deploy
+// works out the changes again, so a stack that uses outputs changed by another stack may differ from the review.
+func reviewEnvironment(ctx context.Context, svc *environment.EnvService, enclave string, envDef string, envName string,
+	opts environment.DeployOpts, autoApprove bool) (bool, error) {
+	opts.DryRun = true
+	opts.Approve = nil
+
+	stackInfo, err := svc.DeployEnvironment(ctx, enclave, envDef, envName, opts)
+	if err != nil {
+		return false, err
+	}
+
+	destructive := 0
+	for _, stack := range stackInfo {
+		if stack.NextAction != model.NextActionUpdate {
+			cl.Info("Stack %v will be created\n", stack.Name)
+			continue
+		}
+
+		printChanges(stack.Name, stack.Changes)
+		for _, change := range stack.Changes {
+			if change.IsDestructive() {
+				destructive++
+			}
+		}
+	}
+
+	if autoApprove {
+		return true, nil
+	}
+
+	prompt := fmt.Sprintf("Deploy the changes to environment %v?", envName)
+	if destructive > 0 {
+		prompt = fmt.Sprintf("Deploy the changes to environment %v? %v resources will be replaced or removed",
+			envName, destructive)
+	}
+	return cl.AskConfirm(prompt)
+}
+
+// printChanges prints the changes of a stack update. Changes that remove or may replace a resource are flagged.
+func printChanges(stackName string, changes []model.ResourceChange) {
+	if changes == nil {
+		cl.Info("Changes to stack %v can't be listed by its IaC type\n", stackName)
+		return
+	}
+	if len(changes) == 0 {
+		cl.Info("Stack %v has no changes\n", stackName)
+		return
+	}
+
+	cl.Info("Changes to stack %v:\n", stackName)
+	cl.Info("    %-8v %-30v %-40v %-12v %v\n", "Action", "Logical ID", "Type", "Replacement", "Scope")
+	for _, change := range changes {
+		flag := " "
+		if change.IsDestructive() {
+			flag = "!"
+		}
+		cl.Info("  %v %-8v %-30v %-40v %-12v %v\n", flag, change.Action, change.LogicalId, change.ResourceType,
+			change.Replacement, strings.Join(change.Scope, ", "))
+	}
+	cl.Info("  ! removes or may replace the resource\n")
+}
+
+// cancelUpdates asks to confirm and then cancels the in progress stack updates of an interrupted deploy
+func cancelUpdates(svc *environment.EnvService, enclave string, envDef string, envName string, err error) {
+	var interruptErr *environment.InterruptedErr
+	if !errors.As(err, &interruptErr) {
+		return
+	}
+
+	confirm, askErr := cl.AskConfirm("Cancel the in progress stack updates? They will be rolled back")
+	if askErr != nil || !confirm {
+		return
+	}
+
+	// The command context is already cancelled
+	stackInfo, cancelErr := svc.CancelStackUpdates(context.Background(), enclave, envDef, envName, interruptErr.Stacks)
+	for _, stack := range stackInfo {
+		cl.Info("Stack: %v [%v] - %v\n", stack.Name, stack.DeployStatus.State, stack.DeployStatus.Reason)
+	}
+	if cancelErr != nil {
+		cl.Info("Unable to cancel the stack updates: %v\n", cancelErr)
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/swizzleio/swiz/internal/environment"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	addSubCommand("env", &cli.Command{
+		Name:   "drift",
+		Usage:  "Detect resources of an environment that were changed outside of swiz",
+		Action: envDriftCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "name",
+				Aliases:  []string{"n"},
+				Usage:    "Name of the environment",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:        "env-def",
+				Aliases:     []string{"d"},
+				Usage:       "Environment definition to use",
+				DefaultText: "",
+			},
+			&cli.StringFlag{
+				Name:        "enclave",
+				Aliases:     []string{"e"},
+				Usage:       "Enclave to use",
+				DefaultText: "",
+			},
+		},
+	})
+}
+
+func envDriftCmd(ctx *cli.Context) error {
+	enclave := ctx.String("enclave")
+	envDef := ctx.String("env-def")
+	envName := ctx.String("name")
+
+	svc, err := environment.NewEnvService(appConfigMgr.Get())
+	if err != nil {
+		return err
+	}
+
+	cl.Info("Detecting drift on environment %v\n", envName)
+	drifts, err := svc.DetectDrift(ctx.Context, enclave, envDef, envName)
+	if err != nil {
+		return err
+	}
+
+	drifted := 0
+	failed := 0
+	for _, drift := range drifts {
+		if drift.DetectionStatus == model.DriftDetectionFailed {
+			cl.Info("%v [%v, %v]\n", drift.Name, drift.Status, drift.DetectionStatus)
+		} else {
+			cl.Info("%v [%v]\n", drift.Name, drift.Status)
+		}
+		if drift.Reason != "" {
+			cl.Info("  %v\n", drift.Reason)
+		}
+
+		for _, resource := range drift.Resources {
+			cl.Info("  %v %v %v %v\n", resource.Status, resource.ResourceType, resource.LogicalId, resource.PhysicalId)
+			for _, diff := range resource.Differences {
+				cl.Info("    %v %v: expected %v, actual %v\n", diff.Type, diff.Path, diff.Expected, diff.Actual)
+			}
+		}
+
+		if drift.IsDrifted() {
+			drifted++
+		}
+		if drift.IsDetectionFailed() {
+			failed++
+		}
+	}
+
+	// A non-zero exit lets CI fail on drift, and on stacks that couldn't be checked so drift isn't missed
+	if drifted > 0 {
+		return fmt.Errorf("%v of %v stacks drifted", drifted, len(drifts))
+	}
+	if failed > 0 {
+		return fmt.Errorf("drift detection failed on %v of %v stacks", failed, len(drifts))
+	}
+
+	return nil
+}
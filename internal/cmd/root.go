@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/swizzleio/swiz/internal/appconfig"
 	appcli "github.com/swizzleio/swiz/pkg/cli"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/urfave/cli/v2"
 )
@@ -27,6 +30,10 @@ var appCli *cli.App
 // CLI
 var cl = appcli.NewCli(nil, nil)
 
+// Signals received after the command context was cancelled. It is unbuffered so a signal only gets through while a
+// command is waiting on one.
+var interrupts = make(chan os.Signal)
+
 // addCommand adds commands to the list
 func addCommand(cmd *cli.Command) {
 	commands = append(commands, cmd)
@@ -41,8 +48,33 @@ func addSubCommand(cmdName string, subCmd *cli.Command) {
 	}
 }
 
+// handleSignals cancels the command context on the first SIGINT or SIGTERM so a running command can stop polling and
+// report where it is. Later signals are passed to interrupts if a command is waiting on one, otherwise they are ignored
+// so the command can finish stopping.
+func handleSignals(cancel context.CancelFunc) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sigs
+		cl.Info("\nStopping...\n")
+		cancel()
+
+		for sig := range sigs {
+			select {
+			case interrupts <- sig:
+			default:
+				cl.Info("\nStill stopping...\n")
+			}
+		}
+	}()
+}
+
 // Execute adds all child commands to the root command. This is called by main and is considered the main entry point.
 func Execute() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handleSignals(cancel)
 
 	appCli = &cli.App{
 		Name:     "swiz",
@@ -66,8 +98,10 @@ func Execute() {
 		},
 	}
 
-	err := appCli.Run(os.Args)
+	err := appCli.RunContext(ctx, os.Args)
 	if err != nil {
+		// log.Fatal exits without running the deferred cancel
+		cancel()
 		log.Fatal(err)
 	}
 }
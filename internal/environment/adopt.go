@@ -0,0 +1,211 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/internal/environment/repo"
+)
+
+// adoptedStackCache holds the deployed name of each stack adopted into an environment. Adopted stacks keep their
+// name instead of the one from the naming scheme. The adopted stacks of a deployer are only looked up once per
+// environment.
+type adoptedStackCache struct {
+	mu     sync.Mutex
+	loadMu sync.Mutex
+	names  map[string]map[string]string
+	loaded map[adoptedStackKey]bool
+}
+
+type adoptedStackKey struct {
+	envName  string
+	deployer repo.IacDeployer
+}
+
+func newAdoptedStackCache() *adoptedStackCache {
+	return &adoptedStackCache{
+		names:  map[string]map[string]string{},
+		loaded: map[adoptedStackKey]bool{},
+	}
+}
+
+// get returns the deployed name of an adopted stack, or an empty string if the stack wasn't adopted
+func (c *adoptedStackCache) get(envName string, stackName string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.names[envName][stackName]
+}
+
+func (c *adoptedStackCache) set(envName string, stackName string, deployedName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.names[envName] == nil {
+		c.names[envName] = map[string]string{}
+	}
+	c.names[envName][stackName] = deployedName
+}
+
+func (c *adoptedStackCache) isLoaded(envName string, iacDeploy repo.IacDeployer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.loaded[adoptedStackKey{envName: envName, deployer: iacDeploy}]
+}
+
+// load reads the adopted stacks from the stacks of the environment, unless that was already done for the deployer
+func (c *adoptedStackCache) load(ctx context.Context, iacDeploy repo.IacDeployer, envName string) error {
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+
+	if c.isLoaded(envName, iacDeploy) {
+		return nil
+	}
+
+	stacks, err := iacDeploy.ListStacks(ctx, envName)
+	if err != nil && !errors.Is(err, apperr.GenNotFoundError) {
+		return err
+	}
+	for _, stack := range stacks {
+		if stack.AdoptedAs != "" {
+			c.set(envName, stack.AdoptedAs, stack.Name)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loaded[adoptedStackKey{envName: envName, deployer: iacDeploy}] = true
+	return nil
+}
+
+// AdoptStacks takes over stacks that were deployed outside of swiz. Each stack is checked against the template of its
+// stack config and tagged as part of the environment, after which deploys update it under the name it was deployed
+// with.
+func (s EnvService) AdoptStacks(ctx context.Context, enclaveName string, envDef string, envName string,
+	opts AdoptOpts) ([]*model.StackInfo, error) {
+	env, enclave, err := s.getEnvEnclave(enclaveName, envDef)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Stacks) == 0 {
+		return nil, fmt.Errorf("specify the stacks to adopt")
+	}
+
+	deployers, err := s.getStackDeployers(enclave, env)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range opts.Stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Check every stack before anything is tagged
+	adopters := map[string]repo.StackAdopter{}
+	for _, name := range names {
+		if env.Stacks[name] == nil {
+			return nil, apperr.NewNotFoundError("stack", name)
+		}
+
+		adopter, ok := deployers[name].(repo.StackAdopter)
+		if !ok {
+			return nil, apperr.NewUnsupportedError("stack adoption", fmt.Sprintf("the IaC type of stack %v", name))
+		}
+		adopters[name] = adopter
+
+		err = s.adoptedStacks.load(ctx, deployers[name], envName)
+		if err != nil {
+			return nil, err
+		}
+
+		// Adopting a stack that is already deployed would leave the deployed one behind
+		stackName := s.generateStackName(env, envName, name)
+		if stackName == opts.Stacks[name] {
+			continue
+		}
+		_, getErr := deployers[name].GetStackInfo(ctx, stackName)
+		if getErr == nil {
+			return nil, fmt.Errorf("stack %v is already deployed as %v", name, stackName)
+		}
+		if !errors.Is(getErr, apperr.GenNotFoundError) {
+			return nil, getErr
+		}
+	}
+
+	since := time.Now()
+	stackInfoList := []*model.StackInfo{}
+	started := map[repo.IacDeployer][]string{}
+	for _, name := range names {
+		deployedName := opts.Stacks[name]
+
+		// The stack name tag maps the deployed stack back to its stack config
+		metadata := s.generateMetadata(envName, env.EnvDefName, enclave.Name, false)
+		metadata[model.StackKeyStackName] = name
+
+		stackInfo, adoptErr := adopters[name].AdoptStack(ctx, deployedName, env.Stacks[name], metadata, opts.Force,
+			opts.DryRun)
+		if adoptErr != nil {
+			return stackInfoList, fmt.Errorf("stack %v: %w", name, adoptErr)
+		}
+		stackInfoList = append(stackInfoList, stackInfo)
+
+		if stackInfo.DeployStatus.State == model.StateUpdating {
+			started[deployers[name]] = append(started[deployers[name]], deployedName)
+		}
+		if !opts.DryRun {
+			s.adoptedStacks.set(envName, name, deployedName)
+		}
+	}
+
+	for iacDeploy, stackList := range started {
+		err = s.waitForStacksComplete(ctx, enclave, iacDeploy, envName, stackList, since, model.StateComplete)
+		if err != nil {
+			return stackInfoList, err
+		}
+	}
+
+	for _, stackInfo := range stackInfoList {
+		if stackInfo.DeployStatus.State == model.StateUpdating {
+			stackInfo.DeployStatus.State = model.StateComplete
+		}
+	}
+
+	return stackInfoList, nil
+}
+
+// resolveStackName returns the deployed name of a stack. A stack that doesn't exist under the name from the naming
+// scheme may have been adopted, so the adopted stacks are only looked up then. If the stack was found while resolving
+// its name, its stack info is returned as well so it doesn't need to be looked up again.
+func (s EnvService) resolveStackName(ctx context.Context, env *model.EnvironmentConfig, envName string,
+	stackName string, iacDeploy repo.IacDeployer) (string, *model.StackInfo, error) {
+	name := s.generateStackName(env, envName, stackName)
+	if _, ok := iacDeploy.(repo.StackAdopter); !ok || s.adoptedStacks.isLoaded(envName, iacDeploy) {
+		return name, nil, nil
+	}
+
+	stackInfo, err := iacDeploy.GetStackInfo(ctx, name)
+	if err == nil {
+		return name, stackInfo, nil
+	}
+	if !errors.Is(err, apperr.GenNotFoundError) {
+		return "", nil, err
+	}
+
+	err = s.adoptedStacks.load(ctx, iacDeploy, envName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return s.generateStackName(env, envName, stackName), nil, nil
+}
@@ -0,0 +1,60 @@
+package environment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+// fakeAdopter is a fake deployer that can adopt stacks and counts the stack lookups
+type fakeAdopter struct {
+	*fakeDeployer
+	lookups map[string]int
+}
+
+func newFakeAdopter() *fakeAdopter {
+	return &fakeAdopter{
+		fakeDeployer: newFakeDeployer(),
+		lookups:      map[string]int{},
+	}
+}
+
+func (d *fakeAdopter) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	d.mu.Lock()
+	d.lookups[name]++
+	d.mu.Unlock()
+
+	return d.fakeDeployer.GetStackInfo(ctx, name)
+}
+
+func (d *fakeAdopter) AdoptStack(ctx context.Context, name string, stack *model.StackConfig,
+	metadata map[string]string, force bool, dryRun bool) (*model.StackInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls = append(d.calls, "adopt "+name)
+	d.stacks[name].AdoptedAs = metadata[model.StackKeyStackName]
+	retVal := *d.stacks[name]
+	return &retVal, nil
+}
+
+func TestEnvService_DeployEnvironmentAdoptedStacks(t *testing.T) {
+	iacDeploy := newFakeAdopter()
+	iacDeploy.setStack("dev-vpc", model.StateComplete)
+	iacDeploy.setStack("legacy-app", model.StateComplete)
+	iacDeploy.stacks["legacy-app"].AdoptedAs = "app"
+	svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+		testStack{name: "vpc"},
+		testStack{name: "app", dependsOn: []string{"vpc"}},
+	)
+
+	_, err := svc.DeployEnvironment(context.Background(), "", "", "dev", DeployOpts{DeployAll: true})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"update dev-vpc", "outputs dev-vpc", "update legacy-app", "outputs legacy-app"},
+		iacDeploy.callList())
+
+	// The stack found while resolving its name isn't looked up again to deploy it
+	assert.Equal(t, 1, iacDeploy.lookups["dev-vpc"])
+}
@@ -0,0 +1,115 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/internal/environment/repo"
+	"github.com/swizzleio/swiz/pkg/backoff"
+)
+
+// driftDetection is a drift detection that is still running on a stack
+type driftDetection struct {
+	deployer    repo.IacDeployer
+	detectionId string
+}
+
+// DetectDrift runs drift detection on every stack of the environment and waits for it to finish. Stacks whose IaC type
+// can't detect drift are returned as not checked.
+func (s EnvService) DetectDrift(ctx context.Context, enclaveName string, envDef string, envName string) ([]model.StackDrift, error) {
+	env, enclave, err := s.getEnvEnclave(enclaveName, envDef)
+	if err != nil {
+		return nil, err
+	}
+
+	envDeployers, err := s.getEnvDeployersByDef(enclave, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start a detection on every stack so they run at the same time
+	retVal := []model.StackDrift{}
+	detections := map[string]driftDetection{}
+	found := map[string]bool{}
+	for _, iacDeploy := range envDeployers {
+		stacks, listErr := iacDeploy.ListStacks(ctx, envName)
+		if listErr != nil {
+			if errors.Is(listErr, apperr.GenNotFoundError) {
+				continue
+			}
+			return nil, listErr
+		}
+
+		for _, stack := range stacks {
+			if found[stack.Name] {
+				continue
+			}
+			found[stack.Name] = true
+
+			detectionId, detectErr := iacDeploy.DetectStackDrift(ctx, stack.Name)
+			if detectErr != nil {
+				if !errors.Is(detectErr, apperr.GenUnsupportedError) {
+					return nil, fmt.Errorf("stack %v: %w", stack.Name, detectErr)
+				}
+
+				retVal = append(retVal, model.StackDrift{
+					Name:     stack.Name,
+					Complete: true,
+					Status:   model.DriftStatusNotChecked,
+					Reason:   detectErr.Error(),
+				})
+				continue
+			}
+
+			detections[stack.Name] = driftDetection{
+				deployer:    iacDeploy,
+				detectionId: detectionId,
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, apperr.NewNotFoundError("environment", envName)
+	}
+
+	interval := enclave.Retry.PollInterval()
+	for len(detections) > 0 {
+		names := []string{}
+		for name := range detections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		done := false
+		for _, name := range names {
+			detection := detections[name]
+			drift, driftErr := detection.deployer.GetStackDrift(ctx, name, detection.detectionId)
+			if driftErr != nil {
+				return nil, fmt.Errorf("stack %v: %w", name, driftErr)
+			}
+
+			if drift.Complete {
+				retVal = append(retVal, *drift)
+				delete(detections, name)
+				done = true
+			}
+		}
+
+		if len(detections) > 0 {
+			err = backoff.Sleep(ctx, interval.Next(done))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(retVal, func(i, j int) bool {
+		return retVal[i].Name < retVal[j].Name
+	})
+
+	return retVal, nil
+}
@@ -8,20 +8,36 @@ import (
 	"github.com/swizzleio/swiz/internal/apperr"
 	"github.com/swizzleio/swiz/internal/environment/model"
 	"github.com/swizzleio/swiz/internal/environment/repo"
+	"github.com/swizzleio/swiz/pkg/backoff"
 	"github.com/swizzleio/swiz/pkg/configutil"
+	"github.com/swizzleio/swiz/pkg/errtype"
 	"github.com/swizzleio/swiz/pkg/preprocessor"
 	"os"
+	"sort"
+	"sync"
 	"time"
 )
 
 type EnvService struct {
-	envRepo    *repo.EnvironmentRepo
-	iacFactory *repo.IacRepoFactory
+	envRepo       *repo.EnvironmentRepo
+	iacFactory    deployerFactory
+	journalRepo   *repo.JournalRepo
+	buildRepo     *repo.BuildRepo
+	adoptedStacks *adoptedStackCache
+	eventHandler  model.StackEventHandler
 }
 
-const (
-	PollIntervalSec = 5
-)
+// deployerFactory returns the deployer for an IaC type, provider and region of an enclave
+type deployerFactory interface {
+	GetDeployer(enclave model.Enclave, providerName string, iacType string, region string) (repo.IacDeployer, error)
+}
+
+// stackStartFunc starts an operation on a stack and returns the deployed stack name to wait on. An empty name means
+// there is nothing to wait on.
+type stackStartFunc func(stack *model.StackConfig) (string, error)
+
+// stackDoneFunc is called once the operation on a stack has finished
+type stackDoneFunc func(stack *model.StackConfig) error
 
 func NewEnvService(config appconfig.AppConfig) (*EnvService, error) {
 	envRepo := repo.NewEnvironmentRepo(config)
@@ -31,13 +47,22 @@ func NewEnvService(config appconfig.AppConfig) (*EnvService, error) {
 	}
 
 	return &EnvService{
-		envRepo:    envRepo,
-		iacFactory: repo.NewIacRepoFactory(config),
+		envRepo:       envRepo,
+		iacFactory:    repo.NewIacRepoFactory(config),
+		journalRepo:   repo.NewJournalRepo(repo.DefaultRunLocation),
+		buildRepo:     repo.NewBuildRepo(repo.DefaultBuildLocation),
+		adoptedStacks: newAdoptedStackCache(),
 	}, nil
 }
 
-func (s EnvService) DeployEnvironment(ctx context.Context, enclaveName string, envDef string, envName string, deployAll bool, stacksToDeploy []string, dryRun bool,
-	noUpdate bool) ([]*model.StackInfo, error) {
+// SetEventHandler sets the handler that is passed the events of the stacks that are being waited on. Only deployers
+// that report events, such as CloudFormation, have any.
+func (s *EnvService) SetEventHandler(handler model.StackEventHandler) {
+	s.eventHandler = handler
+}
+
+func (s EnvService) DeployEnvironment(ctx context.Context, enclaveName string, envDef string, envName string,
+	opts DeployOpts) ([]*model.StackInfo, error) {
 	// Get environment definition
 	env, enclave, err := s.getEnvEnclave(enclaveName, envDef)
 	if err != nil {
@@ -45,79 +70,267 @@ func (s EnvService) DeployEnvironment(ctx context.Context, enclaveName string, e
 	}
 
 	// Determine enclave behavior or config behavior
-	noUpdate = configutil.FlagOrConfig(noUpdate, enclave.EnvBehavior.NoUpdateDeploy)
-	deployAll = configutil.FlagOrConfig(deployAll, enclave.EnvBehavior.DeployAllStacks)
+	noUpdate := configutil.FlagOrConfig(opts.NoUpdate, enclave.EnvBehavior.NoUpdateDeploy)
+	deployAll := configutil.FlagOrConfig(opts.DeployAll, enclave.EnvBehavior.DeployAllStacks)
+	maxParallel := configutil.FlagOrConfig(opts.MaxParallel, enclave.EnvBehavior.MaxParallel)
+	rollback := configutil.FlagOrConfig(opts.Rollback, enclave.EnvBehavior.RollbackOnFailure) && !opts.DryRun
+	envTimeout := configutil.FlagOrConfig(opts.Timeout, enclave.EnvBehavior.EnvTimeout)
+	stacksToDeploy := opts.Stacks
+	dryRun := opts.DryRun
+
+	// Stacks are deployed in parallel, but only one is reviewed at a time
+	approve := opts.Approve
+	if approve != nil {
+		var approveMu sync.Mutex
+		approve = func(stackName string, changes []model.ResourceChange) (bool, error) {
+			approveMu.Lock()
+			defer approveMu.Unlock()
+
+			return opts.Approve(stackName, changes)
+		}
+	}
 
 	// Init param store
 	ps := preprocessor.NewParamStore(enclave.Parameters)
 
 	// Determine dependency order
-	stackDeps := s.buildDependencyOrder(env.Stacks, false)
+	graph, err := model.NewDependencyGraph(env.Stacks)
+	if err != nil {
+		return nil, err
+	}
 
 	// Determine stacks to deploy
 	if !deployAll && len(stacksToDeploy) == 0 {
 		return nil, fmt.Errorf("specify a list of stacks to deploy or provide a flag to deploy all stacks")
 	}
 
-	shouldDeploy := map[string]bool{}
+	selected := map[string]*model.StackConfig{}
+	verifyOnly := map[string]bool{}
 	if len(stacksToDeploy) == 0 {
-		for _, stack := range env.Stacks {
-			shouldDeploy[stack.Name] = true
+		for name, stack := range env.Stacks {
+			selected[name] = stack
 		}
 	} else {
-		for _, stack := range stacksToDeploy {
-			shouldDeploy[stack] = true
+		// A stack deployed to several regions selects every regional copy
+		expanded := []string{}
+		for _, name := range stacksToDeploy {
+			names := env.ExpandStackName(name)
+			if len(names) == 0 {
+				return nil, apperr.NewNotFoundError("stack", name)
+			}
+			expanded = append(expanded, names...)
+		}
+		stacksToDeploy = expanded
+
+		for _, name := range stacksToDeploy {
+			selected[name] = env.Stacks[name]
+		}
+
+		if opts.Downstream {
+			// Redeploy everything that consumes the outputs of the selected stacks
+			for _, name := range graph.Downstream(stacksToDeploy) {
+				selected[name] = env.Stacks[name]
+			}
+		}
+
+		if opts.WithDeps {
+			// Upstream stacks are only deployed if they don't already exist
+			for _, name := range graph.Upstream(stacksToDeploy) {
+				if _, ok := selected[name]; !ok {
+					selected[name] = env.Stacks[name]
+					verifyOnly[name] = true
+				}
+			}
+		}
+	}
+
+	deployers, err := s.getStackDeployers(enclave, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load outputs from stacks that are used but not part of this deploy
+	err = s.loadSkippedOutputs(ctx, env, envName, selected, deployers, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record progress so an interrupted deploy can be resumed
+	journal, err := s.openJournal(env, enclave, envName, opts.Resume)
+	if err != nil {
+		return nil, err
+	}
+	saveJournal := func() error {
+		if dryRun {
+			return nil
+		}
+		return s.journalRepo.SaveJournal(journal)
+	}
+	err = saveJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	// Stacks finished by the interrupted deploy only need their outputs
+	noOutputs := map[string]bool{}
+	for name := range selected {
+		if journal.IsStackDone(name) {
+			ps.SetParams(name, journal.Stacks[name].Outputs)
+			noOutputs[name] = true
 		}
 	}
 
 	// Create stacks
+	parentCtx := ctx
+	ctx, cancel := s.withTimeout(parentCtx, envTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
 	stackInfoList := []*model.StackInfo{}
-	for _, stackDep := range stackDeps {
-		deployList := []*model.StackConfig{}
-		waitList := []string{}
-		for _, stack := range stackDep {
-			if shouldDeploy[stack.Name] {
-				params := ps.GetParams(stack.Parameters)
-
-				// Upsert stack
-				stackInfo, createUpErr := s.upsertStack(ctx, env, enclave, envName, stack, params, noUpdate, dryRun)
-				if createUpErr != nil {
-					return nil, createUpErr
+	changes := map[string]stackChange{}
+	err = s.runGraph(ctx, enclave, envName, graph, selected, deployers, false, maxParallel, model.StateComplete,
+		func(stack *model.StackConfig) (string, error) {
+			iacDeploy := deployers[stack.RawName]
+			stackName, existing, nameErr := s.resolveStackName(ctx, env, envName, stack.RawName, iacDeploy)
+			if nameErr != nil {
+				return "", nameErr
+			}
+
+			mu.Lock()
+			isDone := journal.IsStackDone(stack.RawName)
+			_, isStarted := journal.Stacks[stack.RawName]
+			mu.Unlock()
+
+			if isDone {
+				return "", nil
+			}
+
+			if isStarted {
+				// Wait on the operation started by the interrupted deploy
+				attached, attachErr := s.reattachStack(ctx, iacDeploy, stackName)
+				if attachErr != nil {
+					return "", attachErr
+				}
+				if attached {
+					return stackName, nil
 				}
+			}
 
-				stackInfoList = append(stackInfoList, stackInfo)
-				waitList = append(waitList, stackInfo.Name)
-				deployList = append(deployList, stack)
+			if verifyOnly[stack.RawName] {
+				existing, verifyErr := s.verifyStack(ctx, iacDeploy, stackName)
+				if verifyErr != nil {
+					return "", verifyErr
+				}
+				if existing {
+					// Already deployed, only the outputs are needed
+					return "", nil
+				}
 			}
-		}
 
-		// Wait for completion
-		err = s.waitForStacksComplete(ctx, enclave, envName, waitList, model.StateComplete)
-		if err != nil {
-			return nil, err
-		}
+			params := ps.GetParams(stack.Parameters)
+
+			// Capture the deployed version so it can be restored
+			change := stackChange{
+				stack:    stack,
+				name:     stackName,
+				deployer: iacDeploy,
+			}
+			if rollback {
+				snapshot, snapErr := iacDeploy.GetStackSnapshot(ctx, change.name)
+				switch {
+				case snapErr == nil:
+					change.snapshot = snapshot
+				case errors.Is(snapErr, apperr.GenNotFoundError):
+					change.created = true
+				case errors.Is(snapErr, apperr.GenUnsupportedError):
+					// Without a snapshot an existing stack can only be rolled back while its update is in progress
+					_, infoErr := iacDeploy.GetStackInfo(ctx, change.name)
+					if infoErr != nil && !errors.Is(infoErr, apperr.GenNotFoundError) {
+						return "", infoErr
+					}
+					change.created = infoErr != nil
+				default:
+					return "", snapErr
+				}
+			}
 
-		// Get outputs
-		for _, stack := range deployList {
-			iacDeploy, iacErr := s.iacFactory.GetDeployer(*enclave, "", "")
-			if iacErr != nil {
-				return nil, iacErr
+			// Upsert stack
+			stackInfo, createUpErr := s.upsertStack(ctx, env, enclave, iacDeploy, envName, stack, existing, params, noUpdate, dryRun, approve)
+			if createUpErr != nil {
+				return "", createUpErr
 			}
 
-			out, oerr := iacDeploy.GetStackOutputs(ctx, stack.Name)
+			mu.Lock()
+			defer mu.Unlock()
+
+			stackInfoList = append(stackInfoList, stackInfo)
+			if rollback && stackInfo.DeployStatus.State != model.StateDryRun {
+				changes[stack.RawName] = change
+			}
+
+			entry := journal.GetStack(stack.RawName)
+			entry.StackInfo = *stackInfo
+			if stackInfo.NextAction == model.NextActionUpdate {
+				// Updates report the change set in the details
+				entry.ChangeSetName = stackInfo.DeployStatus.Details
+			}
+			journalErr := saveJournal()
+			if journalErr != nil {
+				return "", journalErr
+			}
+			if stackInfo.DeployStatus.State == model.StateDryRun {
+				// Nothing was changed so there is nothing to wait on. A new stack has no outputs yet.
+				noOutputs[stack.RawName] = stackInfo.NextAction == model.NextActionCreate
+				return "", nil
+			}
+
+			return stackInfo.Name, nil
+		},
+		func(stack *model.StackConfig) error {
+			mu.Lock()
+			skipOutputs := noOutputs[stack.RawName]
+			mu.Unlock()
+
+			if skipOutputs {
+				return nil
+			}
+
+			// Get outputs
+			out, oerr := deployers[stack.RawName].GetStackOutputs(ctx, s.generateStackName(env, envName, stack.RawName))
 			if oerr != nil {
-				return nil, oerr
+				return oerr
 			}
 
 			ps.SetParams(stack.RawName, out)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			entry := journal.GetStack(stack.RawName)
+			entry.Outputs = out
+			entry.Done = true
+			return saveJournal()
+		})
+	if err != nil {
+		err = s.envTimeoutErr(parentCtx, ctx, envName, envTimeout, err)
+		if rollback && len(changes) > 0 && parentCtx.Err() == nil {
+			// The env timeout doesn't apply to the rollback
+			return nil, s.rollbackChanges(parentCtx, enclave, envName, graph, changes, err)
 		}
+		return nil, err
+	}
+
+	journal.Complete = true
+	err = saveJournal()
+	if err != nil {
+		return nil, err
 	}
 
 	return stackInfoList, nil
 }
 
-func (s EnvService) DeleteEnvironment(ctx context.Context, enclaveName string, envDef string, envName string, dryRun bool,
-	noOrphanDelete bool, fastDelete bool) ([]model.StackInfo, error) {
+func (s EnvService) DeleteEnvironment(ctx context.Context, enclaveName string, envDef string, envName string,
+	opts DeleteOpts) ([]model.StackInfo, error) {
 
 	// Get environment definition
 	env, enclave, err := s.getEnvEnclave(enclaveName, envDef)
@@ -126,147 +339,326 @@ func (s EnvService) DeleteEnvironment(ctx context.Context, enclaveName string, e
 	}
 
 	// Determine flag behavior
-	noOrphanDelete = configutil.FlagOrConfig(noOrphanDelete, enclave.EnvBehavior.NoOrphanDelete)
-	fastDelete = configutil.FlagOrConfig(fastDelete, enclave.EnvBehavior.FastDelete)
+	noOrphanDelete := configutil.FlagOrConfig(opts.NoOrphanDelete, enclave.EnvBehavior.NoOrphanDelete)
+	fastDelete := configutil.FlagOrConfig(opts.FastDelete, enclave.EnvBehavior.FastDelete)
+	maxParallel := configutil.FlagOrConfig(opts.MaxParallel, enclave.EnvBehavior.MaxParallel)
+	envTimeout := configutil.FlagOrConfig(opts.Timeout, enclave.EnvBehavior.EnvTimeout)
+	dryRun := opts.DryRun
 
 	// Determine dependency order
-	stackDeps := s.buildDependencyOrder(env.Stacks, true)
+	graph, err := model.NewDependencyGraph(env.Stacks)
+	if err != nil {
+		return nil, err
+	}
+
+	deployers, err := s.getStackDeployers(enclave, env)
+	if err != nil {
+		return nil, err
+	}
+
+	parentCtx := ctx
+	ctx, cancel := s.withTimeout(parentCtx, envTimeout)
+	defer cancel()
 
-	// Delete stacks
+	// Delete stacks, dependents go first
+	var mu sync.Mutex
+	stackInfoList := []model.StackInfo{}
 	stackDeleted := map[string]bool{}
-	for _, stackDep := range stackDeps {
-		waitList := make([]string, len(stackDep))
-		for i, stack := range stackDep {
-			iacDeploy, iacErr := s.iacFactory.GetDeployer(*enclave, "", "")
-			if iacErr != nil {
-				return nil, iacErr
+	err = s.runGraph(ctx, enclave, envName, graph, env.Stacks, deployers, true, maxParallel, model.StateDeleted,
+		func(stack *model.StackConfig) (string, error) {
+			stackName, _, nameErr := s.resolveStackName(ctx, env, envName, stack.RawName, deployers[stack.RawName])
+			if nameErr != nil {
+				return "", nameErr
 			}
-
-			// Generate stack name
-			stack.Name = s.generateStackName(env, envName, stack.Name)
-			stackInfo, deleteErr := iacDeploy.DeleteStack(ctx, stack.Name, dryRun)
+			stackInfo, deleteErr := deployers[stack.RawName].DeleteStack(ctx, stackName, dryRun)
 			if deleteErr != nil {
-				return nil, deleteErr
+				return "", deleteErr
 			}
 
-			waitList[i] = stackInfo.Name
-			stackDeleted[stack.Name] = true
-		}
-		if !fastDelete {
-			// Wait for completion
-			err = s.waitForStacksComplete(ctx, enclave, envName, waitList, model.StateDeleted)
-			if err != nil {
-				return nil, err
+			mu.Lock()
+			defer mu.Unlock()
+
+			stackInfoList = append(stackInfoList, *stackInfo)
+			stackDeleted[stackName] = true
+			if fastDelete || stackInfo.DeployStatus.State == model.StateDryRun {
+				return "", nil
 			}
-		}
+
+			return stackInfo.Name, nil
+		},
+		func(stack *model.StackConfig) error {
+			return nil
+		})
+	if err != nil {
+		return nil, s.envTimeoutErr(parentCtx, ctx, envName, envTimeout, err)
 	}
 
 	// Find orphaned stacks
 	if !noOrphanDelete {
-		// Get list of stacks
-		iacDeploy, iacErr := s.iacFactory.GetDeployer(*enclave, "", "")
-		if iacErr != nil {
-			return nil, iacErr
-		}
-
-		stackList, listErr := iacDeploy.ListStacks(ctx, envName)
-		if listErr != nil {
-			return nil, listErr
+		envDeployers, envErr := s.getEnvDeployers(enclave, deployers)
+		if envErr != nil {
+			return nil, envErr
 		}
 
+		// Orphans are looked for in every deployer the environment uses
+		orphanStart := time.Now()
 		waitList := []string{}
-		for _, stack := range stackList {
-			stackName := s.generateStackName(env, envName, stack.Name)
-			if _, ok := stackDeleted[stackName]; !ok {
-				iacDeploy, iacErr = s.iacFactory.GetDeployer(*enclave, "", "")
-				if iacErr != nil {
-					return nil, iacErr
-				}
+		waitLists := map[repo.IacDeployer][]string{}
+		for _, iacDeploy := range envDeployers {
+			// Get list of stacks
+			stackList, listErr := iacDeploy.ListStacks(ctx, envName)
+			if listErr != nil {
+				return nil, listErr
+			}
 
-				// Delete stack
-				stackInfo, deleteErr := iacDeploy.DeleteStack(ctx, stackName, dryRun)
-				if deleteErr != nil {
-					return nil, deleteErr
+			for _, stack := range stackList {
+				if _, ok := stackDeleted[stack.Name]; !ok {
+					// Delete stack
+					stackInfo, deleteErr := iacDeploy.DeleteStack(ctx, stack.Name, dryRun)
+					if deleteErr != nil {
+						return nil, deleteErr
+					}
+
+					stackInfoList = append(stackInfoList, *stackInfo)
+					stackDeleted[stack.Name] = true
+					if stackInfo.DeployStatus.State != model.StateDryRun {
+						waitList = append(waitList, stackInfo.Name)
+						waitLists[iacDeploy] = append(waitLists[iacDeploy], stackInfo.Name)
+					}
 				}
-
-				waitList = append(waitList, stackInfo.Name)
 			}
 		}
 
 		if !fastDelete {
 			// Wait for completion
-			err = s.waitForStacksComplete(ctx, enclave, envName, waitList, model.StateDeleted)
-			if err != nil {
-				return nil, err
+			for _, iacDeploy := range envDeployers {
+				err = s.waitForStacksComplete(ctx, enclave, iacDeploy, envName, waitLists[iacDeploy], orphanStart, model.StateDeleted)
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, s.envTimeoutErr(parentCtx, ctx, envName, envTimeout, &InterruptedErr{
+							Cause:  err,
+							Stacks: waitList,
+						})
+					}
+					return nil, err
+				}
 			}
 		}
 	}
 
-	return []model.StackInfo{}, nil
+	return stackInfoList, nil
 }
 
 func (s EnvService) ListEnvironments(ctx context.Context, enclaveName string, envDef string) ([]string, error) {
 	// Get environment definition
-	_, enclave, err := s.getEnvEnclave(enclaveName, envDef)
+	env, enclave, err := s.getEnvEnclave(enclaveName, envDef)
+	if err != nil {
+		return nil, err
+	}
+
+	envDeployers, err := s.getEnvDeployersByDef(enclave, env)
 	if err != nil {
 		return nil, err
 	}
 
-	iacDeploy, iacErr := s.iacFactory.GetDeployer(*enclave, "", "")
-	if iacErr != nil {
-		return nil, iacErr
+	// An environment can have stacks in more than one deployer
+	retVal := []string{}
+	found := map[string]bool{}
+	for _, iacDeploy := range envDeployers {
+		envList, listErr := iacDeploy.ListEnvironments(ctx)
+		if listErr != nil {
+			return nil, listErr
+		}
+
+		for _, envName := range envList {
+			if !found[envName] {
+				found[envName] = true
+				retVal = append(retVal, envName)
+			}
+		}
 	}
 
-	return iacDeploy.ListEnvironments(ctx)
+	return retVal, nil
 }
 
 func (s EnvService) GetEnvironmentInfo(ctx context.Context, enclaveName string, envDef string, envName string) (*model.EnvironmentInfo, error) {
 	// Get environment definition
-	_, enclave, err := s.getEnvEnclave(enclaveName, envDef)
+	env, enclave, err := s.getEnvEnclave(enclaveName, envDef)
 	if err != nil {
 		return nil, err
 	}
 
-	iacDeploy, iacErr := s.iacFactory.GetDeployer(*enclave, "", "")
-	if iacErr != nil {
-		return nil, iacErr
+	envDeployers, err := s.getEnvDeployersByDef(enclave, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(envDeployers) == 1 {
+		return envDeployers[0].GetEnvironment(ctx, envName)
 	}
 
-	return iacDeploy.GetEnvironment(ctx, envName)
+	// Combine the stacks from every deployer the environment uses
+	stacks := []model.StackInfo{}
+	found := map[string]bool{}
+	for _, iacDeploy := range envDeployers {
+		envInfo, envErr := iacDeploy.GetEnvironment(ctx, envName)
+		if envErr != nil {
+			if errors.Is(envErr, apperr.GenNotFoundError) {
+				continue
+			}
+			return nil, envErr
+		}
+
+		for _, stack := range envInfo.StackInfo {
+			if !found[stack.Name] {
+				found[stack.Name] = true
+				stacks = append(stacks, stack)
+			}
+		}
+	}
+
+	if len(stacks) == 0 {
+		return nil, apperr.NewNotFoundError("environment", envName)
+	}
+
+	envInfo := model.NewEnvironmentInfo(envName, stacks)
+	return &envInfo, nil
 }
 
-func (s EnvService) upsertStack(ctx context.Context, env *model.EnvironmentConfig, enclave *model.Enclave, envName string, stack *model.StackConfig, params map[string]string, noUpdate bool, dryRun bool) (*model.StackInfo, error) {
+// upsertStack creates the stack, or updates it if it exists. existing is the deployed stack if it was already looked up.
+func (s EnvService) upsertStack(ctx context.Context, env *model.EnvironmentConfig, enclave *model.Enclave, iacDeploy repo.IacDeployer, envName string, stack *model.StackConfig, existing *model.StackInfo, params map[string]string, noUpdate bool, dryRun bool, approve model.ChangeApprover) (*model.StackInfo, error) {
 	var err error
 	var stackInfo *model.StackInfo
 
-	iacDeploy, iacErr := s.iacFactory.GetDeployer(*enclave, "", "")
-	if iacErr != nil {
-		return nil, iacErr
-	}
-
 	// Generate stack name
-	stack.Name = s.generateStackName(env, envName, stack.Name)
+	stackName := s.generateStackName(env, envName, stack.RawName)
+
+	// Apply the enclave defaults
+	deployStack := *stack
+	deployStack.Timeout = s.getStackTimeout(enclave, stack)
+
+	// Synthesize the template of built stacks
+	if stack.Build != nil {
+		deployStack.TemplateFile, err = s.buildRepo.Synth(ctx, stackName, stack.Build, params)
+		if err != nil {
+			return nil, fmt.Errorf("unable to build stack %v: %w", stack.RawName, err)
+		}
+	}
 
 	// Check to see if stack exists
-	_, getErr := iacDeploy.GetStackInfo(ctx, stack.Name)
+	var getErr error
+	if existing == nil {
+		_, getErr = iacDeploy.GetStackInfo(ctx, stackName)
+	}
 	if getErr != nil {
 		if errors.Is(getErr, apperr.GenNotFoundError) {
 			// No new stack, create one
-			stackInfo, err = iacDeploy.CreateStack(ctx, stack.Name, stack.TemplateFile, params, s.generateMetadata(envName, env.EnvDefName, enclave.Name, true), dryRun)
+			stackInfo, err = iacDeploy.CreateStack(ctx, stackName, &deployStack, params, s.generateMetadata(envName, env.EnvDefName, enclave.Name, true), dryRun)
 		} else {
 			return nil, getErr
 		}
 	} else if !noUpdate {
-		// Update stack
-		stackInfo, err = iacDeploy.UpdateStack(ctx, stack.Name, stack.TemplateFile, params, s.generateMetadata(envName, env.EnvDefName, enclave.Name, false), dryRun)
+		// Update stack, adopted stacks keep the tag that maps them to the stack
+		metadata := s.generateMetadata(envName, env.EnvDefName, enclave.Name, false)
+		if s.adoptedStacks.get(envName, stack.RawName) != "" {
+			metadata[model.StackKeyStackName] = stack.RawName
+		}
+		stackInfo, err = s.updateStack(ctx, iacDeploy, stackName, &deployStack, params, metadata, dryRun, approve)
 	} else {
 		// Stacks exists and no update requested
-		return nil, apperr.NewExistsError("stack", stack.Name)
+		return nil, apperr.NewExistsError("stack", stackName)
 	}
 
 	return stackInfo, err
 }
 
+// updateStack updates a stack. With approve set, the changes are reviewed first by deployers that can list them.
+// Other deployers ask for approval without the changes.
+func (s EnvService) updateStack(ctx context.Context, iacDeploy repo.IacDeployer, stackName string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool, approve model.ChangeApprover) (*model.StackInfo, error) {
+	if approve == nil || dryRun {
+		return iacDeploy.UpdateStack(ctx, stackName, stack, params, metadata, dryRun)
+	}
+
+	reviewer, ok := iacDeploy.(repo.ChangeReviewer)
+	if ok {
+		return reviewer.ReviewUpdateStack(ctx, stackName, stack, params, metadata, approve)
+	}
+
+	approved, err := approve(stackName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to review changes: %w", err)
+	}
+	if !approved {
+		return &model.StackInfo{
+			Name:       stackName,
+			NextAction: model.NextActionUpdate,
+			DeployStatus: model.DeployStatus{
+				Name:   stackName,
+				State:  model.StateDryRun,
+				Reason: "Changes not approved",
+			},
+			Resources: []string{},
+		}, nil
+	}
+
+	return iacDeploy.UpdateStack(ctx, stackName, stack, params, metadata, false)
+}
+
+// loadSkippedOutputs loads the outputs of stacks that are referenced by the selected stacks but are not being deployed
+func (s EnvService) loadSkippedOutputs(ctx context.Context, env *model.EnvironmentConfig, envName string,
+	selected map[string]*model.StackConfig, deployers map[string]repo.IacDeployer, ps *preprocessor.ParamStore) error {
+	loaded := map[string]bool{}
+	for _, stack := range selected {
+		for _, ref := range model.OutputRefStacks(stack) {
+			if _, ok := selected[ref]; ok || loaded[ref] {
+				continue
+			}
+			if _, ok := env.Stacks[ref]; !ok {
+				continue
+			}
+
+			stackName, _, err := s.resolveStackName(ctx, env, envName, ref, deployers[ref])
+			if err != nil {
+				return err
+			}
+
+			out, err := deployers[ref].GetStackOutputs(ctx, stackName)
+			if err != nil {
+				if errors.Is(err, apperr.GenNotFoundError) {
+					return fmt.Errorf("stack %v uses outputs from stack %v which is not deployed, deploy it with --with-deps: %w",
+						stack.RawName, ref, err)
+				}
+				return err
+			}
+
+			ps.SetParams(ref, out)
+			loaded[ref] = true
+		}
+	}
+
+	return nil
+}
+
+// verifyStack checks that an upstream stack exists and is healthy. A stack whose last update was rolled back is still on
+// a working version. false is returned if the stack does not exist.
+func (s EnvService) verifyStack(ctx context.Context, iacDeploy repo.IacDeployer, stackName string) (bool, error) {
+	stackInfo, err := iacDeploy.GetStackInfo(ctx, stackName)
+	if err != nil {
+		if errors.Is(err, apperr.GenNotFoundError) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	state := stackInfo.DeployStatus.State
+	if state != model.StateComplete && state != model.StateRolledBack {
+		return true, fmt.Errorf("upstream stack %v is in state %v", stackName, stackInfo.DeployStatus.State)
+	}
+
+	return true, nil
+}
+
 func (s EnvService) getEnvEnclave(enclaveName string, envDef string) (*model.EnvironmentConfig, *model.Enclave, error) {
 	// Get environment definition
 	env, err := s.envRepo.GetEnvironmentByDef(envDef)
@@ -286,16 +678,80 @@ func (s EnvService) getEnvEnclave(enclaveName string, envDef string) (*model.Env
 	return env, enclave, nil
 }
 
+// getStackDeployers returns the deployer of each stack by name. A stack can override the IaC type, provider and region
+// of the enclave.
+func (s EnvService) getStackDeployers(enclave *model.Enclave, env *model.EnvironmentConfig) (map[string]repo.IacDeployer, error) {
+	deployers := map[string]repo.IacDeployer{}
+	for name, stack := range env.Stacks {
+		iacDeploy, err := s.iacFactory.GetDeployer(*enclave, stack.Provider, stack.Iac, stack.Region)
+		if err != nil {
+			return nil, fmt.Errorf("stack %v: %w", name, err)
+		}
+		deployers[name] = iacDeploy
+	}
+
+	return deployers, nil
+}
+
+// getEnvDeployers returns the enclave default deployer followed by the other deployers used by the stacks
+func (s EnvService) getEnvDeployers(enclave *model.Enclave, deployers map[string]repo.IacDeployer) ([]repo.IacDeployer, error) {
+	iacDeploy, err := s.iacFactory.GetDeployer(*enclave, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range deployers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	retVal := []repo.IacDeployer{iacDeploy}
+	found := map[repo.IacDeployer]bool{iacDeploy: true}
+	for _, name := range names {
+		if !found[deployers[name]] {
+			found[deployers[name]] = true
+			retVal = append(retVal, deployers[name])
+		}
+	}
+
+	return retVal, nil
+}
+
+// getEnvDeployersByDef returns every deployer used by the stacks of an environment definition
+func (s EnvService) getEnvDeployersByDef(enclave *model.Enclave, env *model.EnvironmentConfig) ([]repo.IacDeployer, error) {
+	deployers, err := s.getStackDeployers(enclave, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getEnvDeployers(enclave, deployers)
+}
+
 func (s EnvService) generateStackName(env *model.EnvironmentConfig, envName string, stackName string) string {
+	// Adopted stacks keep the name they were deployed with
+	adoptedName := s.adoptedStacks.get(envName, stackName)
+	if adoptedName != "" {
+		return adoptedName
+	}
+
 	template := env.NamingScheme
 	if env.NamingScheme == "" {
 		template = model.DefaultNamingScheme
 	}
 
-	return preprocessor.ParseTemplateTokens(template, map[string]string{
+	baseName, region := model.SplitRegionalStackName(stackName)
+	name := preprocessor.ParseTemplateTokens(template, map[string]string{
 		"env_name":   envName,
-		"stack_name": stackName,
+		"stack_name": baseName,
 	})
+
+	// The region goes after the naming scheme so it isn't truncated
+	if region != "" {
+		name = fmt.Sprintf("%v-%v", name, region)
+	}
+
+	return name
 }
 
 func (s EnvService) generateMetadata(envName string, envDef string, enclaveName string, isCreate bool) map[string]string {
@@ -313,17 +769,22 @@ func (s EnvService) generateMetadata(envName string, envDef string, enclaveName
 	return retVal
 }
 
-func (s EnvService) waitForStacksComplete(ctx context.Context, enclave *model.Enclave, envName string, stackList []string, state model.State) error {
-	iacDeploy, iacErr := s.iacFactory.GetDeployer(*enclave, "", "") // This will need refactoring when we support multiple IACs
-	if iacErr != nil {
-		return iacErr
+func (s EnvService) waitForStacksComplete(ctx context.Context, enclave *model.Enclave, iacDeploy repo.IacDeployer,
+	envName string, stackList []string, since time.Time, states ...model.State) error {
+	if len(stackList) == 0 {
+		return nil
 	}
 
+	events := s.newEventStream(iacDeploy, since)
+	interval := enclave.Retry.PollInterval()
 	stopPoll := false
 	for !stopPoll {
 		var envErr error
 		var stackCompleteList []string
-		stopPoll, stackCompleteList, envErr = iacDeploy.IsEnvironmentInState(ctx, envName, stackList, []model.State{state})
+		stopPoll, stackCompleteList, envErr = iacDeploy.IsEnvironmentInState(ctx, envName, stackList, states)
+
+		// Stream the events first so the ones that led to a failure are shown
+		events.stream(ctx, stackList)
 		if envErr != nil {
 			return envErr
 		}
@@ -346,42 +807,139 @@ func (s EnvService) waitForStacksComplete(ctx context.Context, enclave *model.En
 		stackList = newStackList
 
 		if !stopPoll {
-			time.Sleep(PollIntervalSec * time.Second)
+			// Poll less often while nothing finishes
+			err := backoff.Sleep(ctx, interval.Next(len(stackCompleteList) > 0))
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func (s EnvService) buildDependencyOrder(stacks map[string]*model.StackConfig, reverseOrder bool) [][]*model.StackConfig {
-	// Figure out how many stack order buckets
-	maxSize := 0
-	for _, stack := range stacks {
-		if stack.Order < 0 {
+// runGraph walks the dependency graph and starts each selected stack as soon as the selected stacks it depends on are
+// done. When reverse is set, a stack waits on the stacks that depend on it instead, which is the order used to delete.
+// Stacks that are not selected are skipped and do not block the stacks around them. Each stack runs in its own
+// goroutine with at most maxParallel running at once, 0 means no limit. Once a stack fails no new stacks are started.
+// If the context is cancelled, an InterruptedErr with the stacks that were still in progress is returned.
+// deployers holds the deployer of each stack, it is used to wait on the stacks that were started.
+func (s EnvService) runGraph(ctx context.Context, enclave *model.Enclave, envName string, graph *model.DependencyGraph,
+	stacks map[string]*model.StackConfig, deployers map[string]repo.IacDeployer, reverse bool, maxParallel int,
+	state model.State, start stackStartFunc, done stackDoneFunc) error {
+	type stackResult struct {
+		name     string
+		waitName string
+		err      error
+	}
+
+	results := make(chan stackResult)
+	started := map[string]bool{}
+	finished := map[string]bool{}
+	running := 0
+	errList := errtype.ErrList{}
+	inProgress := []string{}
+
+	for {
+		// Start every stack that is no longer waiting on another stack
+		if len(errList.Errors) == 0 && ctx.Err() == nil {
+			for _, name := range graph.Stacks() {
+				if maxParallel > 0 && running >= maxParallel {
+					break
+				}
+
+				stack, ok := stacks[name]
+				if !ok || started[name] || !s.isStackReady(graph, stacks, finished, name, reverse) {
+					continue
+				}
+
+				started[name] = true
+				running++
+				go func(name string, stack *model.StackConfig) {
+					waitName, err := s.runStack(ctx, enclave, deployers[name], envName, stack, state, start, done)
+					results <- stackResult{
+						name:     name,
+						waitName: waitName,
+						err:      err,
+					}
+				}(name, stack)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		if res.err != nil {
+			if ctx.Err() != nil && res.waitName != "" {
+				inProgress = append(inProgress, res.waitName)
+			}
+			errList.Add(res.err)
 			continue
 		}
+		finished[res.name] = true
+	}
 
-		if stack.Order > maxSize {
-			maxSize = stack.Order
+	if len(errList.Errors) == 0 && len(finished) < len(stacks) {
+		if ctx.Err() != nil {
+			errList.Add(ctx.Err())
+		} else {
+			errList.Add(fmt.Errorf("unable to schedule the remaining stacks"))
 		}
 	}
 
-	// Iterate through the stacks and determine the order. Note, 0 is a valid number.
-	// Yes this could be more efficient but it's not worth it
-	retVal := make([][]*model.StackConfig, maxSize+1)
-	for _, stack := range stacks {
-		if retVal[stack.Order] == nil {
-			retVal[stack.Order] = []*model.StackConfig{}
+	if ctx.Err() != nil {
+		sort.Strings(inProgress)
+		return &InterruptedErr{
+			Cause:  errList.ErrOrNil(),
+			Stacks: inProgress,
 		}
+	}
 
-		retVal[stack.Order] = append(retVal[stack.Order], stack)
+	return errList.ErrOrNil()
+}
+
+// runStack starts the operation on a single stack and waits for it to reach the desired state. The deployed stack name
+// that was waited on is returned. If the stack takes longer than its timeout, a timeout error is returned.
+func (s EnvService) runStack(ctx context.Context, enclave *model.Enclave, iacDeploy repo.IacDeployer, envName string,
+	stack *model.StackConfig, state model.State, start stackStartFunc, done stackDoneFunc) (string, error) {
+	startTime := time.Now()
+	waitName, err := start(stack)
+	if err != nil {
+		return "", err
 	}
 
-	if reverseOrder {
-		// Reverse order
-		for i, j := 0, len(retVal)-1; i < j; i, j = i+1, j-1 {
-			retVal[i], retVal[j] = retVal[j], retVal[i]
+	if waitName != "" {
+		timeout := s.getStackTimeout(enclave, stack)
+		waitCtx, cancel := s.withTimeout(ctx, timeout)
+		defer cancel()
+
+		err = s.waitForStacksComplete(waitCtx, enclave, iacDeploy, envName, []string{waitName}, startTime, state)
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+				return waitName, apperr.NewTimeoutError("stack", []string{waitName}, timeout)
+			}
+			return waitName, err
 		}
 	}
 
-	return retVal
+	return waitName, done(stack)
+}
+
+// isStackReady returns true when none of the selected stacks the named stack waits on are still outstanding
+func (s EnvService) isStackReady(graph *model.DependencyGraph, stacks map[string]*model.StackConfig,
+	finished map[string]bool, name string, reverse bool) bool {
+	waitOn := graph.Dependencies(name)
+	if reverse {
+		waitOn = graph.Dependents(name)
+	}
+
+	for _, dep := range waitOn {
+		if _, selected := stacks[dep]; selected && !finished[dep] {
+			return false
+		}
+	}
+
+	return true
 }
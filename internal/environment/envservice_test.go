@@ -0,0 +1,619 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/internal/environment/repo"
+	"gopkg.in/yaml.v3"
+)
+
+// testRetry polls without waiting between polls
+var testRetry = model.EncRetry{
+	MinPollInterval: time.Millisecond,
+	MaxPollInterval: time.Millisecond,
+}
+
+// fakeDeployer keeps stacks in memory. An operation finishes on the first poll after opTime, unless the stack is set
+// to hang, in which case it never finishes, or to fail, which fails everything but deletes. Every call is recorded as
+// "<op> <stack name>".
+type fakeDeployer struct {
+	mu         sync.Mutex
+	opTime     time.Duration
+	stacks     map[string]*model.StackInfo
+	started    map[string]time.Time
+	params     map[string]map[string]string
+	outputs    map[string]map[string]string
+	hang       map[string]bool
+	fail       map[string]bool
+	noSnapshot bool
+	calls      []string
+	running    int
+	maxRunning int
+}
+
+func newFakeDeployer() *fakeDeployer {
+	return &fakeDeployer{
+		stacks:  map[string]*model.StackInfo{},
+		started: map[string]time.Time{},
+		params:  map[string]map[string]string{},
+		outputs: map[string]map[string]string{},
+		hang:    map[string]bool{},
+		fail:    map[string]bool{},
+	}
+}
+
+// setStack puts a stack in the given state, as if it was deployed before the test
+func (d *fakeDeployer) setStack(name string, state model.State) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stacks[name] = d.stackInfo(name, model.NextActionNone, state)
+}
+
+func (d *fakeDeployer) state(name string) model.State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stacks[name] == nil {
+		return model.StateUnknown
+	}
+	return d.stacks[name].DeployStatus.State
+}
+
+func (d *fakeDeployer) callList() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string{}, d.calls...)
+}
+
+// callIndex returns the position of a call, or -1 if it wasn't made
+func (d *fakeDeployer) callIndex(call string) int {
+	for i, c := range d.callList() {
+		if c == call {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *fakeDeployer) stackInfo(name string, action model.NextAction, state model.State) *model.StackInfo {
+	return &model.StackInfo{
+		Name:       name,
+		NextAction: action,
+		DeployStatus: model.DeployStatus{
+			Name:  name,
+			State: state,
+		},
+		Resources: []string{},
+	}
+}
+
+// start records the call and starts an operation, the lock must be held
+func (d *fakeDeployer) start(op string, name string, action model.NextAction, state model.State) *model.StackInfo {
+	d.calls = append(d.calls, op+" "+name)
+	d.stacks[name] = d.stackInfo(name, action, state)
+	d.started[name] = time.Now()
+	d.running++
+	if d.running > d.maxRunning {
+		d.maxRunning = d.running
+	}
+
+	retVal := *d.stacks[name]
+	return &retVal
+}
+
+func (d *fakeDeployer) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.params[name] = params
+	if dryRun {
+		d.calls = append(d.calls, "create "+name)
+		return d.stackInfo(name, model.NextActionCreate, model.StateDryRun), nil
+	}
+	return d.start("create", name, model.NextActionCreate, model.StateCreating), nil
+}
+
+func (d *fakeDeployer) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.params[name] = params
+	if dryRun {
+		d.calls = append(d.calls, "update "+name)
+		return d.stackInfo(name, model.NextActionUpdate, model.StateDryRun), nil
+	}
+	return d.start("update", name, model.NextActionUpdate, model.StateUpdating), nil
+}
+
+func (d *fakeDeployer) DeleteStack(ctx context.Context, name string, dryRun bool) (*model.StackInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if dryRun {
+		d.calls = append(d.calls, "delete "+name)
+		return d.stackInfo(name, model.NextActionDelete, model.StateDryRun), nil
+	}
+	return d.start("delete", name, model.NextActionDelete, model.StateDeleting), nil
+}
+
+func (d *fakeDeployer) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stackInfo := d.stacks[name]
+	if stackInfo == nil || stackInfo.DeployStatus.State == model.StateDeleted {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+
+	retVal := *stackInfo
+	return &retVal, nil
+}
+
+func (d *fakeDeployer) GetStackOutputs(ctx context.Context, name string) (map[string]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls = append(d.calls, "outputs "+name)
+	if d.stacks[name] == nil {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+	return d.outputs[name], nil
+}
+
+func (d *fakeDeployer) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.noSnapshot {
+		return nil, apperr.NewUnsupportedError("stack snapshots", "fake")
+	}
+	if d.stacks[name] == nil {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+	return &model.StackSnapshot{Name: name, Parameters: d.params[name]}, nil
+}
+
+// RollbackStack cancels an update in progress, or deploys the snapshot again once the update finished
+func (d *fakeDeployer) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stackInfo := d.stacks[name]
+	if stackInfo == nil {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+
+	switch {
+	case stackInfo.DeployStatus.State == model.StateUpdating:
+		d.running--
+		return d.start("rollback", name, model.NextActionUpdate, model.StateRollingBack), nil
+	case stackInfo.DeployStatus.State == model.StateComplete && snapshot != nil:
+		d.params[name] = snapshot.Parameters
+		return d.start("rollback", name, model.NextActionUpdate, model.StateUpdating), nil
+	}
+
+	d.calls = append(d.calls, "rollback "+name)
+	retVal := *stackInfo
+	return &retVal, nil
+}
+
+func (d *fakeDeployer) ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stacks := []model.StackInfo{}
+	for _, stackInfo := range d.stacks {
+		if stackInfo.DeployStatus.State != model.StateDeleted {
+			stacks = append(stacks, *stackInfo)
+		}
+	}
+	return stacks, nil
+}
+
+func (d *fakeDeployer) ListEnvironments(ctx context.Context) ([]string, error) {
+	return []string{}, nil
+}
+
+func (d *fakeDeployer) GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error) {
+	stacks, err := d.ListStacks(ctx, envName)
+	if err != nil {
+		return nil, err
+	}
+
+	envInfo := model.NewEnvironmentInfo(envName, stacks)
+	return &envInfo, nil
+}
+
+// IsEnvironmentInState finishes the operations that ran for at least opTime
+func (d *fakeDeployer) IsEnvironmentInState(ctx context.Context, envName string, stacks []string,
+	states []model.State) (bool, []string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stackCompleteList := []string{}
+	for _, name := range stacks {
+		stackInfo := d.stacks[name]
+		if stackInfo == nil {
+			return false, stackCompleteList, apperr.NewNotFoundError("stack", name)
+		}
+		if d.hang[name] || time.Since(d.started[name]) < d.opTime {
+			continue
+		}
+		if d.fail[name] && stackInfo.NextAction != model.NextActionDelete && stackInfo.DeployStatus.State != model.StateFailed {
+			d.running--
+			stackInfo.DeployStatus.State = model.StateFailed
+		}
+
+		switch stackInfo.DeployStatus.State {
+		case model.StateCreating, model.StateUpdating:
+			d.running--
+			stackInfo.DeployStatus.State = model.StateComplete
+		case model.StateDeleting:
+			d.running--
+			stackInfo.DeployStatus.State = model.StateDeleted
+		case model.StateRollingBack:
+			d.running--
+			stackInfo.DeployStatus.State = model.StateRolledBack
+		case model.StateFailed:
+			return false, stackCompleteList, fmt.Errorf("stack %v failed", name)
+		}
+
+		for _, state := range states {
+			if stackInfo.DeployStatus.State == state {
+				stackCompleteList = append(stackCompleteList, name)
+			}
+		}
+	}
+
+	return len(stackCompleteList) == len(stacks), stackCompleteList, nil
+}
+
+func (d *fakeDeployer) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	return name, nil
+}
+
+func (d *fakeDeployer) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	return &model.StackDrift{Name: name, Complete: true, Status: model.DriftStatusInSync}, nil
+}
+
+// fakeFactory returns the same deployer for every stack
+type fakeFactory struct {
+	deployer repo.IacDeployer
+}
+
+func (f fakeFactory) GetDeployer(enclave model.Enclave, providerName string, iacType string,
+	region string) (repo.IacDeployer, error) {
+	return f.deployer, nil
+}
+
+// testStack is a stack of the test environment. Stacks without dependsOn don't depend on each other.
+type testStack struct {
+	name      string
+	dependsOn []string
+	timeout   time.Duration
+	params    map[string]string
+}
+
+// newTestEnvService writes an environment definition with the stacks to a temp dir and returns a service that deploys
+// them with iacDeploy. Stacks get the default <env name>-<stack name> names and the deploy journals are kept in the temp
+// dir.
+func newTestEnvService(t *testing.T, iacDeploy repo.IacDeployer, behavior model.EnvBehavior,
+	stacks ...testStack) *EnvService {
+	dir := t.TempDir()
+	env := model.EnvironmentConfig{
+		Version:        1,
+		DefaultEnclave: "dev",
+		EnclaveDefinition: []model.Enclave{
+			{
+				Name:            "dev",
+				DefaultProvider: "test",
+				Providers: []model.EncProvider{
+					{Name: "test", ProviderId: model.EncProvDummy},
+				},
+				EnvBehavior: behavior,
+				Retry:       testRetry,
+			},
+		},
+	}
+	for _, stack := range stacks {
+		configFile := stack.name + "-cfg.yaml"
+		writeTestYaml(t, filepath.Join(dir, configFile), model.StackConfig{
+			Version:      1,
+			TemplateFile: "file://" + stack.name + ".yaml",
+			Parameters:   stack.params,
+		})
+		env.StackCfgDef = append(env.StackCfgDef, model.StackConfigDef{
+			Name:       stack.name,
+			ConfigFile: "file://" + configFile,
+			DependsOn:  stack.dependsOn,
+			Timeout:    stack.timeout,
+		})
+	}
+	writeTestYaml(t, filepath.Join(dir, "env-def.yaml"), env)
+
+	envRepo := repo.NewEnvironmentRepo(appconfig.AppConfig{
+		DefaultEnv:    "test",
+		EnvDefinition: []appconfig.EnvDef{{Name: "test", EnvDefFile: "file://env-def.yaml"}},
+		BaseDir:       dir,
+	})
+	assert.NoError(t, envRepo.Bootstrap())
+
+	return &EnvService{
+		envRepo:       envRepo,
+		iacFactory:    fakeFactory{deployer: iacDeploy},
+		journalRepo:   repo.NewJournalRepo("file://" + filepath.Join(dir, "runs")),
+		adoptedStacks: newAdoptedStackCache(),
+	}
+}
+
+func writeTestYaml(t *testing.T, path string, data any) {
+	out, err := yaml.Marshal(data)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, out, 0600))
+}
+
+func TestEnvService_DeployEnvironmentOrder(t *testing.T) {
+	iacDeploy := newFakeDeployer()
+	iacDeploy.outputs["dev-vpc"] = map[string]string{"VpcId": "vpc-0123"}
+	svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+		testStack{name: "vpc"},
+		testStack{name: "db", dependsOn: []string{"vpc"}},
+		testStack{name: "app", dependsOn: []string{"db"}, params: map[string]string{"VpcId": "{{vpc.VpcId}}"}},
+		testStack{name: "cache"},
+	)
+
+	stackInfoList, err := svc.DeployEnvironment(context.Background(), "", "", "dev", DeployOpts{DeployAll: true})
+	assert.NoError(t, err)
+	assert.Len(t, stackInfoList, 4)
+
+	// A stack starts once the stacks it depends on finished and their outputs were read
+	assert.Less(t, iacDeploy.callIndex("outputs dev-vpc"), iacDeploy.callIndex("create dev-db"))
+	assert.Less(t, iacDeploy.callIndex("outputs dev-db"), iacDeploy.callIndex("create dev-app"))
+	assert.Equal(t, "vpc-0123", iacDeploy.params["dev-app"]["VpcId"])
+	for _, name := range []string{"dev-vpc", "dev-db", "dev-app", "dev-cache"} {
+		assert.Equal(t, model.StateComplete, iacDeploy.state(name), name)
+	}
+}
+
+func TestEnvService_DeployEnvironmentSelectedStacks(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       DeployOpts
+		existing   []string
+		wantCalls  []string
+		wantNoCall []string
+		wantErr    bool
+	}{
+		{
+			name:       "only the selected stack",
+			opts:       DeployOpts{Stacks: []string{"app"}},
+			existing:   []string{"dev-vpc", "dev-db"},
+			wantCalls:  []string{"outputs dev-vpc", "create dev-app"},
+			wantNoCall: []string{"create dev-vpc", "update dev-vpc", "update dev-db", "create dev-db"},
+		},
+		{
+			name:      "with missing upstream stacks",
+			opts:      DeployOpts{Stacks: []string{"app"}, WithDeps: true},
+			wantCalls: []string{"create dev-vpc", "create dev-db", "create dev-app"},
+		},
+		{
+			name:       "with deployed upstream stacks",
+			opts:       DeployOpts{Stacks: []string{"app"}, WithDeps: true},
+			existing:   []string{"dev-vpc", "dev-db"},
+			wantCalls:  []string{"outputs dev-vpc", "outputs dev-db", "create dev-app"},
+			wantNoCall: []string{"update dev-vpc", "update dev-db"},
+		},
+		{
+			name:       "with stacks using the outputs",
+			opts:       DeployOpts{Stacks: []string{"vpc"}, Downstream: true},
+			existing:   []string{"dev-vpc", "dev-db", "dev-app"},
+			wantCalls:  []string{"update dev-vpc", "update dev-app"},
+			wantNoCall: []string{"update dev-db"},
+		},
+		{
+			name:    "missing upstream outputs",
+			opts:    DeployOpts{Stacks: []string{"app"}},
+			wantErr: true,
+		},
+		{
+			name:    "nothing selected",
+			opts:    DeployOpts{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iacDeploy := newFakeDeployer()
+			for _, name := range tt.existing {
+				iacDeploy.setStack(name, model.StateComplete)
+			}
+			svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+				testStack{name: "vpc"},
+				testStack{name: "db", dependsOn: []string{"vpc"}},
+				testStack{name: "app", dependsOn: []string{"db"}, params: map[string]string{"VpcId": "{{vpc.VpcId}}"}},
+			)
+
+			_, err := svc.DeployEnvironment(context.Background(), "", "", "dev", tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			for _, call := range tt.wantCalls {
+				assert.Contains(t, iacDeploy.callList(), call)
+			}
+			for _, call := range tt.wantNoCall {
+				assert.NotContains(t, iacDeploy.callList(), call)
+			}
+		})
+	}
+}
+
+func TestEnvService_DeleteEnvironmentOrder(t *testing.T) {
+	iacDeploy := newFakeDeployer()
+	for _, name := range []string{"dev-vpc", "dev-db", "dev-app", "dev-orphan"} {
+		iacDeploy.setStack(name, model.StateComplete)
+	}
+	svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+		testStack{name: "vpc"},
+		testStack{name: "db", dependsOn: []string{"vpc"}},
+		testStack{name: "app", dependsOn: []string{"db"}},
+	)
+
+	stackInfoList, err := svc.DeleteEnvironment(context.Background(), "", "", "dev", DeleteOpts{})
+	assert.NoError(t, err)
+	assert.Len(t, stackInfoList, 4)
+
+	// Dependents are deleted first, orphans once the environment stacks are gone
+	assert.Less(t, iacDeploy.callIndex("delete dev-app"), iacDeploy.callIndex("delete dev-db"))
+	assert.Less(t, iacDeploy.callIndex("delete dev-db"), iacDeploy.callIndex("delete dev-vpc"))
+	assert.Less(t, iacDeploy.callIndex("delete dev-vpc"), iacDeploy.callIndex("delete dev-orphan"))
+	for _, name := range []string{"dev-vpc", "dev-db", "dev-app", "dev-orphan"} {
+		assert.Equal(t, model.StateDeleted, iacDeploy.state(name), name)
+	}
+}
+
+func TestEnvService_DeployEnvironmentStopsOnFailure(t *testing.T) {
+	iacDeploy := newFakeDeployer()
+	iacDeploy.fail["dev-db"] = true
+	svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+		testStack{name: "vpc"},
+		testStack{name: "db", dependsOn: []string{"vpc"}},
+		testStack{name: "app", dependsOn: []string{"db"}},
+	)
+
+	_, err := svc.DeployEnvironment(context.Background(), "", "", "dev", DeployOpts{DeployAll: true})
+	assert.ErrorContains(t, err, "stack dev-db failed")
+	assert.Equal(t, -1, iacDeploy.callIndex("create dev-app"))
+}
+
+func TestEnvService_DeployEnvironmentMaxParallel(t *testing.T) {
+	maxParallel := 3
+	tests := []struct {
+		name     string
+		opts     DeployOpts
+		behavior model.EnvBehavior
+		want     int
+	}{
+		{
+			name: "no limit",
+			opts: DeployOpts{DeployAll: true},
+			want: 6,
+		},
+		{
+			name: "flag",
+			opts: DeployOpts{DeployAll: true, MaxParallel: 2},
+			want: 2,
+		},
+		{
+			name:     "enclave config",
+			opts:     DeployOpts{DeployAll: true},
+			behavior: model.EnvBehavior{MaxParallel: &maxParallel},
+			want:     3,
+		},
+		{
+			name:     "config overrides flag",
+			opts:     DeployOpts{DeployAll: true, MaxParallel: 1},
+			behavior: model.EnvBehavior{MaxParallel: &maxParallel},
+			want:     3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iacDeploy := newFakeDeployer()
+			iacDeploy.opTime = 20 * time.Millisecond
+			stacks := []testStack{}
+			for i := 0; i < 6; i++ {
+				stacks = append(stacks, testStack{name: fmt.Sprintf("stack%v", i)})
+			}
+			svc := newTestEnvService(t, iacDeploy, tt.behavior, stacks...)
+
+			stackInfoList, err := svc.DeployEnvironment(context.Background(), "", "", "dev", tt.opts)
+			assert.NoError(t, err)
+			assert.Len(t, stackInfoList, 6)
+			assert.Equal(t, tt.want, iacDeploy.maxRunning)
+		})
+	}
+}
+
+func TestEnvService_VerifyStack(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      model.State
+		wantExists bool
+		wantErr    bool
+	}{
+		{
+			name:  "missing stack",
+			state: model.StateUnknown,
+		},
+		{
+			name:       "healthy stack",
+			state:      model.StateComplete,
+			wantExists: true,
+		},
+		{
+			name:       "last update rolled back",
+			state:      model.StateRolledBack,
+			wantExists: true,
+		},
+		{
+			name:       "update in progress",
+			state:      model.StateUpdating,
+			wantExists: true,
+			wantErr:    true,
+		},
+		{
+			name:       "failed stack",
+			state:      model.StateFailed,
+			wantExists: true,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iacDeploy := newFakeDeployer()
+			if tt.state != model.StateUnknown {
+				iacDeploy.setStack("dev-vpc", tt.state)
+			}
+
+			exists, err := EnvService{}.verifyStack(context.Background(), iacDeploy, "dev-vpc")
+			assert.Equal(t, tt.wantExists, exists)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+
+	t.Run("describe failure", func(t *testing.T) {
+		_, err := EnvService{}.verifyStack(context.Background(), &failingDeployer{fakeDeployer: newFakeDeployer()},
+			"dev-vpc")
+		assert.ErrorContains(t, err, "access denied")
+	})
+}
+
+// failingDeployer fails to describe any stack
+type failingDeployer struct {
+	*fakeDeployer
+}
+
+func (d *failingDeployer) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	return nil, errors.New("access denied")
+}
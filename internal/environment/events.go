@@ -0,0 +1,62 @@
+package environment
+
+import (
+	"context"
+	"time"
+
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/internal/environment/repo"
+)
+
+// eventStream passes the new events of the stacks being waited on to the event handler. since holds the time of the
+// latest event of each stack, so only newer events are fetched.
+type eventStream struct {
+	handler model.StackEventHandler
+	eventer repo.StackEventer
+	since   map[string]time.Time
+	start   time.Time
+	seen    map[string]bool
+}
+
+// newEventStream streams the events after start. Nothing is streamed without an event handler or if the deployer
+// doesn't report events.
+func (s EnvService) newEventStream(iacDeploy repo.IacDeployer, start time.Time) *eventStream {
+	eventer, _ := iacDeploy.(repo.StackEventer)
+	return &eventStream{
+		handler: s.eventHandler,
+		eventer: eventer,
+		since:   map[string]time.Time{},
+		start:   start,
+		seen:    map[string]bool{},
+	}
+}
+
+// stream passes on the events of the stacks that haven't been passed on yet. Events are informational, so a stack
+// whose events can't be fetched is skipped.
+func (e *eventStream) stream(ctx context.Context, stacks []string) {
+	if e.handler == nil || e.eventer == nil {
+		return
+	}
+
+	for _, name := range stacks {
+		since, ok := e.since[name]
+		if !ok {
+			since = e.start
+		}
+
+		events, err := e.eventer.GetStackEvents(ctx, name, since)
+		if err != nil {
+			continue
+		}
+
+		for _, event := range events {
+			// Events that share the timestamp of the latest event are returned again
+			if e.seen[event.Id] {
+				continue
+			}
+			e.seen[event.Id] = true
+			e.since[name] = event.Timestamp
+			e.handler(event)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/internal/environment/repo"
+)
+
+// InterruptedErr is returned when a deploy or delete is cancelled. Stacks holds the deployed stack names that were
+// still in progress and are left running in the cloud provider.
+type InterruptedErr struct {
+	Cause  error
+	Stacks []string
+}
+
+func (e InterruptedErr) Error() string {
+	return fmt.Sprintf("interrupted with %v stacks in progress: %v", len(e.Stacks), e.Cause)
+}
+
+func (e InterruptedErr) Unwrap() error {
+	return e.Cause
+}
+
+// CancelStackUpdates cancels the in progress updates of the named stacks, which rolls them back to the previous
+// version. Stacks that are not being updated are left alone.
+func (s EnvService) CancelStackUpdates(ctx context.Context, enclaveName string, envDef string, envName string,
+	stacks []string) ([]model.StackInfo, error) {
+	env, enclave, err := s.getEnvEnclave(enclaveName, envDef)
+	if err != nil {
+		return nil, err
+	}
+
+	deployers, err := s.getStackDeployers(enclave, env)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultDeploy, err := s.iacFactory.GetDeployer(*enclave, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Map the deployed names back to the deployer of their stack, adopted stacks found by the deploy keep their name
+	nameDeployers := map[string]repo.IacDeployer{}
+	for rawName, iacDeploy := range deployers {
+		nameDeployers[s.generateStackName(env, envName, rawName)] = iacDeploy
+	}
+
+	stackInfoList := []model.StackInfo{}
+	for _, name := range stacks {
+		iacDeploy, ok := nameDeployers[name]
+		if !ok {
+			iacDeploy = defaultDeploy
+		}
+
+		// Without a snapshot only an in progress update is rolled back
+		stackInfo, rollbackErr := iacDeploy.RollbackStack(ctx, name, nil)
+		if rollbackErr != nil {
+			return stackInfoList, rollbackErr
+		}
+		stackInfoList = append(stackInfoList, *stackInfo)
+	}
+
+	return stackInfoList, nil
+}
@@ -0,0 +1,97 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+// cancelOnCall cancels the context once the deployer was called
+func cancelOnCall(iacDeploy *fakeDeployer, call string, cancel context.CancelFunc) {
+	go func() {
+		for iacDeploy.callIndex(call) < 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+}
+
+func TestEnvService_DeployEnvironmentInterrupted(t *testing.T) {
+	iacDeploy := newFakeDeployer()
+	iacDeploy.hang["dev-db"] = true
+	svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+		testStack{name: "vpc"},
+		testStack{name: "db", dependsOn: []string{"vpc"}},
+		testStack{name: "app", dependsOn: []string{"db"}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelOnCall(iacDeploy, "create dev-db", cancel)
+
+	_, err := svc.DeployEnvironment(ctx, "", "", "dev", DeployOpts{DeployAll: true, Rollback: true})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var interruptErr *InterruptedErr
+	assert.True(t, errors.As(err, &interruptErr))
+	assert.Equal(t, []string{"dev-db"}, interruptErr.Stacks)
+
+	// Nothing is started or rolled back once cancelled
+	assert.Equal(t, []string{"create dev-vpc", "outputs dev-vpc", "create dev-db"}, iacDeploy.callList())
+
+	journal, err := svc.journalRepo.GetJournal("dev")
+	assert.NoError(t, err)
+	assert.False(t, journal.Complete)
+	assert.True(t, journal.IsStackDone("vpc"))
+	assert.False(t, journal.IsStackDone("db"))
+}
+
+func TestEnvService_DeleteEnvironmentInterrupted(t *testing.T) {
+	iacDeploy := newFakeDeployer()
+	iacDeploy.hang["dev-app"] = true
+	iacDeploy.setStack("dev-vpc", model.StateComplete)
+	iacDeploy.setStack("dev-app", model.StateComplete)
+	svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+		testStack{name: "vpc"},
+		testStack{name: "app", dependsOn: []string{"vpc"}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelOnCall(iacDeploy, "delete dev-app", cancel)
+
+	_, err := svc.DeleteEnvironment(ctx, "", "", "dev", DeleteOpts{})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var interruptErr *InterruptedErr
+	assert.True(t, errors.As(err, &interruptErr))
+	assert.Equal(t, []string{"dev-app"}, interruptErr.Stacks)
+	assert.Equal(t, []string{"delete dev-app"}, iacDeploy.callList())
+}
+
+func TestEnvService_CancelStackUpdates(t *testing.T) {
+	iacDeploy := newFakeDeployer()
+	iacDeploy.setStack("dev-vpc", model.StateComplete)
+	iacDeploy.setStack("dev-app", model.StateUpdating)
+	svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+		testStack{name: "vpc"},
+		testStack{name: "app", dependsOn: []string{"vpc"}},
+	)
+
+	stackInfoList, err := svc.CancelStackUpdates(context.Background(), "", "", "dev", []string{"dev-vpc", "dev-app"})
+	assert.NoError(t, err)
+
+	// Only the update in progress is rolled back
+	states := map[string]model.State{}
+	for _, stackInfo := range stackInfoList {
+		states[stackInfo.Name] = stackInfo.DeployStatus.State
+	}
+	assert.Equal(t, map[string]model.State{
+		"dev-vpc": model.StateComplete,
+		"dev-app": model.StateRollingBack,
+	}, states)
+}
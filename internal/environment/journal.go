@@ -0,0 +1,58 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/internal/environment/repo"
+)
+
+// openJournal returns the journal for a deploy. When resuming, the journal of the interrupted deploy is loaded instead
+// of starting a new one.
+func (s EnvService) openJournal(env *model.EnvironmentConfig, enclave *model.Enclave, envName string,
+	resume bool) (*model.DeployJournal, error) {
+	if !resume {
+		return model.NewDeployJournal(envName, env.EnvDefName, enclave.Name), nil
+	}
+
+	journal, err := s.journalRepo.GetJournal(envName)
+	if err != nil {
+		if errors.Is(err, apperr.GenNotFoundError) {
+			return nil, fmt.Errorf("there is no deploy of %v to resume: %w", envName, err)
+		}
+		return nil, err
+	}
+
+	if journal.EnvDef != env.EnvDefName || journal.Enclave != enclave.Name {
+		return nil, fmt.Errorf("the last deploy of %v used env def %v in enclave %v", envName, journal.EnvDef,
+			journal.Enclave)
+	}
+
+	if journal.Complete {
+		return nil, fmt.Errorf("the last deploy of %v finished, there is nothing to resume", envName)
+	}
+
+	return journal, nil
+}
+
+// reattachStack checks on a stack that was started by an interrupted deploy. true is returned if the operation is still
+// in progress or has finished, in which case the deploy waits on it instead of starting a new one.
+func (s EnvService) reattachStack(ctx context.Context, iacDeploy repo.IacDeployer, stackName string) (bool, error) {
+	stackInfo, err := iacDeploy.GetStackInfo(ctx, stackName)
+	if err != nil {
+		if errors.Is(err, apperr.GenNotFoundError) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	switch stackInfo.DeployStatus.State {
+	case model.StateCreating, model.StateUpdating, model.StateComplete:
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,188 @@
+package environment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+// saveTestJournal saves the journal of an interrupted deploy where vpc finished and db was started
+func saveTestJournal(t *testing.T, svc *EnvService, complete bool) {
+	journal := model.NewDeployJournal("dev", "test", "dev")
+	journal.Complete = complete
+
+	vpc := journal.GetStack("vpc")
+	vpc.Outputs = map[string]string{"VpcId": "vpc-0123"}
+	vpc.Done = true
+	journal.GetStack("db")
+
+	assert.NoError(t, svc.journalRepo.SaveJournal(journal))
+}
+
+func TestEnvService_DeployEnvironmentResume(t *testing.T) {
+	tests := []struct {
+		name       string
+		dbState    model.State
+		wantCalls  []string
+		wantNoCall []string
+	}{
+		{
+			name:       "update still in progress",
+			dbState:    model.StateUpdating,
+			wantCalls:  []string{"outputs dev-db", "create dev-app"},
+			wantNoCall: []string{"update dev-vpc", "outputs dev-vpc", "update dev-db"},
+		},
+		{
+			name:       "update finished",
+			dbState:    model.StateComplete,
+			wantCalls:  []string{"outputs dev-db", "create dev-app"},
+			wantNoCall: []string{"update dev-vpc", "outputs dev-vpc", "update dev-db"},
+		},
+		{
+			name:       "update rolled back",
+			dbState:    model.StateRolledBack,
+			wantCalls:  []string{"update dev-db", "outputs dev-db", "create dev-app"},
+			wantNoCall: []string{"update dev-vpc", "outputs dev-vpc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iacDeploy := newFakeDeployer()
+			iacDeploy.setStack("dev-vpc", model.StateComplete)
+			iacDeploy.setStack("dev-db", tt.dbState)
+			svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+				testStack{name: "vpc"},
+				testStack{name: "db", dependsOn: []string{"vpc"}},
+				testStack{name: "app", dependsOn: []string{"db"}, params: map[string]string{"VpcId": "{{vpc.VpcId}}"}},
+			)
+			saveTestJournal(t, svc, false)
+
+			_, err := svc.DeployEnvironment(context.Background(), "", "", "dev", DeployOpts{DeployAll: true, Resume: true})
+			assert.NoError(t, err)
+			for _, call := range tt.wantCalls {
+				assert.Contains(t, iacDeploy.callList(), call)
+			}
+			for _, call := range tt.wantNoCall {
+				assert.NotContains(t, iacDeploy.callList(), call)
+			}
+
+			// The outputs of finished stacks come from the journal
+			assert.Equal(t, "vpc-0123", iacDeploy.params["dev-app"]["VpcId"])
+
+			journal, err := svc.journalRepo.GetJournal("dev")
+			assert.NoError(t, err)
+			assert.True(t, journal.Complete)
+			for _, name := range []string{"vpc", "db", "app"} {
+				assert.True(t, journal.IsStackDone(name), name)
+			}
+		})
+	}
+}
+
+func TestEnvService_OpenJournal(t *testing.T) {
+	tests := []struct {
+		name      string
+		journal   *model.DeployJournal
+		resume    bool
+		wantStack bool
+		wantErr   bool
+	}{
+		{
+			name: "new deploy",
+			journal: &model.DeployJournal{
+				EnvName: "dev",
+				EnvDef:  "test",
+				Enclave: "dev",
+				Stacks:  map[string]*model.JournalStack{"vpc": {Done: true}},
+			},
+		},
+		{
+			name: "resume",
+			journal: &model.DeployJournal{
+				EnvName: "dev",
+				EnvDef:  "test",
+				Enclave: "dev",
+				Stacks:  map[string]*model.JournalStack{"vpc": {Done: true}},
+			},
+			resume:    true,
+			wantStack: true,
+		},
+		{
+			name:    "nothing to resume",
+			resume:  true,
+			wantErr: true,
+		},
+		{
+			name: "finished deploy",
+			journal: &model.DeployJournal{
+				EnvName:  "dev",
+				EnvDef:   "test",
+				Enclave:  "dev",
+				Complete: true,
+			},
+			resume:  true,
+			wantErr: true,
+		},
+		{
+			name: "other enclave",
+			journal: &model.DeployJournal{
+				EnvName: "dev",
+				EnvDef:  "test",
+				Enclave: "prod",
+			},
+			resume:  true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestEnvService(t, newFakeDeployer(), model.EnvBehavior{}, testStack{name: "vpc"})
+			if tt.journal != nil {
+				assert.NoError(t, svc.journalRepo.SaveJournal(tt.journal))
+			}
+			env, enclave, err := svc.getEnvEnclave("", "")
+			assert.NoError(t, err)
+
+			journal, err := svc.openJournal(env, enclave, "dev", tt.resume)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStack, journal.IsStackDone("vpc"))
+		})
+	}
+}
+
+func TestEnvService_ReattachStack(t *testing.T) {
+	tests := []struct {
+		name  string
+		state model.State
+		want  bool
+	}{
+		{name: "missing", state: model.StateUnknown},
+		{name: "creating", state: model.StateCreating, want: true},
+		{name: "updating", state: model.StateUpdating, want: true},
+		{name: "complete", state: model.StateComplete, want: true},
+		{name: "failed", state: model.StateFailed},
+		{name: "rolled back", state: model.StateRolledBack},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iacDeploy := newFakeDeployer()
+			if tt.state != model.StateUnknown {
+				iacDeploy.setStack("dev-app", tt.state)
+			}
+
+			attached, err := EnvService{}.reattachStack(context.Background(), iacDeploy, "dev-app")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, attached)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseAdoptedStacks parses stack=deployed-name pairs into the deployed name of each stack by stack name
+func ParseAdoptedStacks(pairs []string) (map[string]string, error) {
+	retVal := map[string]string{}
+	deployed := map[string]bool{}
+	for _, pair := range pairs {
+		stackName, deployedName, ok := strings.Cut(pair, "=")
+		stackName = strings.TrimSpace(stackName)
+		deployedName = strings.TrimSpace(deployedName)
+		if !ok || stackName == "" || deployedName == "" {
+			return nil, fmt.Errorf("%v must be a stack name and a deployed stack name, such as stack=deployed-name", pair)
+		}
+		if _, found := retVal[stackName]; found {
+			return nil, fmt.Errorf("stack %v is adopted more than once", stackName)
+		}
+		if deployed[deployedName] {
+			return nil, fmt.Errorf("deployed stack %v is adopted more than once", deployedName)
+		}
+		deployed[deployedName] = true
+
+		retVal[stackName] = deployedName
+	}
+
+	return retVal, nil
+}
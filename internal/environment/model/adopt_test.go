@@ -0,0 +1,31 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdopt_ParseAdoptedStacks(t *testing.T) {
+	stacks, err := ParseAdoptedStacks([]string{"swizboot=legacy-boot", " edge@eu-west-1 = legacy-edge-eu "})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"swizboot":       "legacy-boot",
+		"edge@eu-west-1": "legacy-edge-eu",
+	}, stacks)
+
+	stacks, err = ParseAdoptedStacks(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, stacks)
+
+	_, err = ParseAdoptedStacks([]string{"swizboot"})
+	assert.Error(t, err)
+	_, err = ParseAdoptedStacks([]string{"=legacy-boot"})
+	assert.Error(t, err)
+	_, err = ParseAdoptedStacks([]string{"swizboot="})
+	assert.Error(t, err)
+	_, err = ParseAdoptedStacks([]string{"swizboot=legacy-boot", "swizboot=other"})
+	assert.Error(t, err)
+	_, err = ParseAdoptedStacks([]string{"swizboot=legacy-boot", "edge=legacy-boot"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	BuildTypeCdk     = "cdk"
+	BuildTypeSam     = "sam"
+	BuildTypeCommand = "command"
+)
+
+// StackBuild is a synth step that produces the stack template before it is deployed. Target is the CDK stack or SAM
+// template to build, and Output the path of the template that the step writes.
+type StackBuild struct {
+	Type      string `yaml:"type"`
+	SourceDir string `yaml:"source_dir,omitempty"`
+	Target    string `yaml:"target,omitempty"`
+	Command   string `yaml:"command,omitempty"`
+	Output    string `yaml:"output,omitempty"`
+}
+
+func (b StackBuild) Validate() error {
+	switch b.Type {
+	case BuildTypeCdk:
+		if b.Target == "" && b.Output == "" {
+			return fmt.Errorf("cdk builds need a target or an output")
+		}
+	case BuildTypeSam:
+	case BuildTypeCommand:
+		if b.Command == "" || b.Output == "" {
+			return fmt.Errorf("command builds need a command and an output")
+		}
+	default:
+		return fmt.Errorf("unknown build type %v", b.Type)
+	}
+
+	return nil
+}
+
+// TemplateName returns the file name of the template in the build output directory
+func (b StackBuild) TemplateName() string {
+	if b.Output != "" {
+		return filepath.Base(b.Output)
+	}
+
+	switch b.Type {
+	case BuildTypeCdk:
+		return fmt.Sprintf("%v.template.json", b.Target)
+	default:
+		return "template.yaml"
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild_Validate(t *testing.T) {
+	assert.NoError(t, StackBuild{Type: BuildTypeCdk, Target: "NeatoStack"}.Validate())
+	assert.NoError(t, StackBuild{Type: BuildTypeSam}.Validate())
+	assert.NoError(t, StackBuild{Type: BuildTypeCommand, Command: "make synth", Output: "out/neato.yaml"}.Validate())
+
+	assert.Error(t, StackBuild{Type: BuildTypeCdk}.Validate())
+	assert.Error(t, StackBuild{Type: BuildTypeCommand, Command: "make synth"}.Validate())
+	assert.Error(t, StackBuild{Type: "bogus"}.Validate())
+}
+
+func TestBuild_TemplateName(t *testing.T) {
+	assert.Equal(t, "NeatoStack.template.json", StackBuild{Type: BuildTypeCdk, Target: "NeatoStack"}.TemplateName())
+	assert.Equal(t, "template.yaml", StackBuild{Type: BuildTypeSam}.TemplateName())
+	assert.Equal(t, "neato.yaml", StackBuild{Type: BuildTypeCommand, Output: "out/neato.yaml"}.TemplateName())
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/swizzleio/swiz/pkg/configutil"
+)
+
+const (
+	CfOnFailureRollback  = "ROLLBACK"
+	CfOnFailureDelete    = "DELETE"
+	CfOnFailureDoNothing = "DO_NOTHING"
+)
+
+const (
+	CfCapabilityIam        = "CAPABILITY_IAM"
+	CfCapabilityNamedIam   = "CAPABILITY_NAMED_IAM"
+	CfCapabilityAutoExpand = "CAPABILITY_AUTO_EXPAND"
+)
+
+const CfRollbackTriggerAlarm = "AWS::CloudWatch::Alarm"
+
+// CloudFormationConfig holds the CloudFormation options of a stack. An enclave can set defaults for all of its stacks,
+// and the settings of a stack take precedence over them.
+type CloudFormationConfig struct {
+	RoleArn               string            `yaml:"role_arn,omitempty"`
+	Capabilities          []string          `yaml:"capabilities,omitempty"`
+	OnFailure             string            `yaml:"on_failure,omitempty"`
+	StackPolicy           string            `yaml:"stack_policy,omitempty"`
+	TerminationProtection *bool             `yaml:"termination_protection,omitempty"`
+	NotificationArns      []string          `yaml:"notification_arns,omitempty"`
+	RollbackTriggers      []RollbackTrigger `yaml:"rollback_triggers,omitempty"`
+	DisableRollback       *bool             `yaml:"disable_rollback,omitempty"`
+}
+
+// RollbackTrigger is an alarm that rolls back a create or update if it goes off during the deploy
+type RollbackTrigger struct {
+	Arn  string `yaml:"arn"`
+	Type string `yaml:"type,omitempty"`
+}
+
+// Merge returns the config with every unset field taken from defaults. Either may be nil.
+func (c *CloudFormationConfig) Merge(defaults *CloudFormationConfig) CloudFormationConfig {
+	retVal := CloudFormationConfig{}
+	if defaults != nil {
+		retVal = *defaults
+	}
+	if c == nil {
+		return retVal
+	}
+
+	retVal.RoleArn = configutil.SetOrDefault(c.RoleArn, retVal.RoleArn)
+	retVal.OnFailure = configutil.SetOrDefault(c.OnFailure, retVal.OnFailure)
+	retVal.StackPolicy = configutil.SetOrDefault(c.StackPolicy, retVal.StackPolicy)
+	retVal.TerminationProtection = configutil.SetOrDefault(c.TerminationProtection, retVal.TerminationProtection)
+	retVal.DisableRollback = configutil.SetOrDefault(c.DisableRollback, retVal.DisableRollback)
+	if len(c.Capabilities) > 0 {
+		retVal.Capabilities = c.Capabilities
+	}
+	if len(c.NotificationArns) > 0 {
+		retVal.NotificationArns = c.NotificationArns
+	}
+	if len(c.RollbackTriggers) > 0 {
+		retVal.RollbackTriggers = c.RollbackTriggers
+	}
+
+	return retVal
+}
+
+// GetCapabilities returns the capabilities, which are CAPABILITY_NAMED_IAM unless set
+func (c CloudFormationConfig) GetCapabilities() []string {
+	if len(c.Capabilities) == 0 {
+		return []string{CfCapabilityNamedIam}
+	}
+	return c.Capabilities
+}
+
+// GetOnFailure returns what to do when a create fails. New stacks are deleted unless this or disable_rollback is set.
+func (c CloudFormationConfig) GetOnFailure() string {
+	if c.IsRollbackDisabled() {
+		return ""
+	}
+	return configutil.SetOrDefault(c.OnFailure, CfOnFailureDelete)
+}
+
+func (c CloudFormationConfig) IsRollbackDisabled() bool {
+	return c.DisableRollback != nil && *c.DisableRollback
+}
+
+func (c CloudFormationConfig) Validate() error {
+	switch c.OnFailure {
+	case "", CfOnFailureRollback, CfOnFailureDelete, CfOnFailureDoNothing:
+	default:
+		return fmt.Errorf("cloudformation on_failure must be %v, %v or %v", CfOnFailureRollback, CfOnFailureDelete,
+			CfOnFailureDoNothing)
+	}
+	if c.OnFailure != "" && c.IsRollbackDisabled() {
+		return fmt.Errorf("cloudformation can set either on_failure or disable_rollback")
+	}
+
+	for _, capability := range c.Capabilities {
+		switch capability {
+		case CfCapabilityIam, CfCapabilityNamedIam, CfCapabilityAutoExpand:
+		default:
+			return fmt.Errorf("cloudformation capability %v must be %v, %v or %v", capability, CfCapabilityIam,
+				CfCapabilityNamedIam, CfCapabilityAutoExpand)
+		}
+	}
+
+	for _, trigger := range c.RollbackTriggers {
+		if trigger.Arn == "" {
+			return fmt.Errorf("cloudformation rollback trigger needs an arn")
+		}
+	}
+
+	return nil
+}
+
+// GetType returns the type of the trigger, which is a CloudWatch alarm unless set
+func (t RollbackTrigger) GetType() string {
+	return configutil.SetOrDefault(t.Type, CfRollbackTriggerAlarm)
+}
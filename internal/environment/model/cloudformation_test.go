@@ -0,0 +1,74 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudFormationConfig_Merge(t *testing.T) {
+	yes := true
+	no := false
+
+	defaults := &CloudFormationConfig{
+		RoleArn:               "arn:aws:iam::123456789012:role/swiz-cf",
+		Capabilities:          []string{CfCapabilityNamedIam, CfCapabilityAutoExpand},
+		TerminationProtection: &yes,
+		NotificationArns:      []string{"arn:aws:sns:us-east-1:123456789012:swiz"},
+	}
+	stack := &CloudFormationConfig{
+		OnFailure:             CfOnFailureRollback,
+		TerminationProtection: &no,
+		NotificationArns:      []string{"arn:aws:sns:us-east-1:123456789012:stack"},
+	}
+
+	assert.Equal(t, CloudFormationConfig{
+		RoleArn:               "arn:aws:iam::123456789012:role/swiz-cf",
+		Capabilities:          []string{CfCapabilityNamedIam, CfCapabilityAutoExpand},
+		OnFailure:             CfOnFailureRollback,
+		TerminationProtection: &no,
+		NotificationArns:      []string{"arn:aws:sns:us-east-1:123456789012:stack"},
+	}, stack.Merge(defaults))
+	assert.Equal(t, *defaults, (*CloudFormationConfig)(nil).Merge(defaults))
+	assert.Equal(t, *stack, stack.Merge(nil))
+	assert.Equal(t, CloudFormationConfig{}, (*CloudFormationConfig)(nil).Merge(nil))
+}
+
+func TestCloudFormationConfig_Defaults(t *testing.T) {
+	yes := true
+
+	cfg := CloudFormationConfig{}
+	assert.Equal(t, []string{CfCapabilityNamedIam}, cfg.GetCapabilities())
+	assert.Equal(t, CfOnFailureDelete, cfg.GetOnFailure())
+	assert.False(t, cfg.IsRollbackDisabled())
+
+	cfg = CloudFormationConfig{Capabilities: []string{CfCapabilityAutoExpand}, OnFailure: CfOnFailureDoNothing}
+	assert.Equal(t, []string{CfCapabilityAutoExpand}, cfg.GetCapabilities())
+	assert.Equal(t, CfOnFailureDoNothing, cfg.GetOnFailure())
+
+	cfg = CloudFormationConfig{DisableRollback: &yes}
+	assert.Equal(t, "", cfg.GetOnFailure())
+	assert.True(t, cfg.IsRollbackDisabled())
+
+	assert.Equal(t, CfRollbackTriggerAlarm, RollbackTrigger{Arn: "arn"}.GetType())
+	assert.Equal(t, "AWS::CloudWatch::CompositeAlarm", RollbackTrigger{Arn: "arn",
+		Type: "AWS::CloudWatch::CompositeAlarm"}.GetType())
+}
+
+func TestCloudFormationConfig_Validate(t *testing.T) {
+	yes := true
+	no := false
+
+	assert.NoError(t, CloudFormationConfig{}.Validate())
+	assert.NoError(t, CloudFormationConfig{
+		Capabilities:     []string{CfCapabilityIam, CfCapabilityAutoExpand},
+		OnFailure:        CfOnFailureRollback,
+		DisableRollback:  &no,
+		RollbackTriggers: []RollbackTrigger{{Arn: "arn:aws:cloudwatch:us-east-1:123456789012:alarm:errors"}},
+	}.Validate())
+
+	assert.Error(t, CloudFormationConfig{OnFailure: "EXPLODE"}.Validate())
+	assert.Error(t, CloudFormationConfig{OnFailure: CfOnFailureDelete, DisableRollback: &yes}.Validate())
+	assert.Error(t, CloudFormationConfig{Capabilities: []string{"CAPABILITY_EVERYTHING"}}.Validate())
+	assert.Error(t, CloudFormationConfig{RollbackTriggers: []RollbackTrigger{{Type: CfRollbackTriggerAlarm}}}.Validate())
+}
@@ -0,0 +1,200 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/pkg/preprocessor"
+)
+
+// DependencyGraph is a directed acyclic graph of stacks keyed by the raw stack name
+type DependencyGraph struct {
+	names      []string
+	deps       map[string][]string
+	dependents map[string][]string
+	consumers  map[string][]string
+}
+
+// NewDependencyGraph builds the dependency graph for a set of stacks. Edges come from the explicit depends_on list,
+// from {{stack_name.output_name}} references in the stack params and, for stacks without a depends_on list, from the
+// legacy order buckets where a stack depends on every stack with a lower order.
+func NewDependencyGraph(stacks map[string]*StackConfig) (*DependencyGraph, error) {
+	g := &DependencyGraph{
+		names:      []string{},
+		deps:       map[string][]string{},
+		dependents: map[string][]string{},
+		consumers:  map[string][]string{},
+	}
+
+	for name := range stacks {
+		g.names = append(g.names, name)
+	}
+	sort.Strings(g.names)
+
+	for _, name := range g.names {
+		stack := stacks[name]
+		depSet := map[string]bool{}
+
+		if stack.DependsOn != nil {
+			for _, dep := range stack.DependsOn {
+				if _, ok := stacks[dep]; !ok {
+					return nil, fmt.Errorf("stack %v depends on an unknown stack: %w", name, apperr.NewNotFoundError("stack", dep))
+				}
+				depSet[dep] = true
+			}
+		} else {
+			// Legacy behavior, wait on every stack in a lower order bucket
+			for _, other := range g.names {
+				if stacks[other].Order < stack.Order {
+					depSet[other] = true
+				}
+			}
+		}
+
+		for _, dep := range OutputRefStacks(stack) {
+			if _, ok := stacks[dep]; ok {
+				depSet[dep] = true
+				g.consumers[dep] = append(g.consumers[dep], name)
+			}
+		}
+
+		deps := []string{}
+		for dep := range depSet {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+
+		g.deps[name] = deps
+		for _, dep := range deps {
+			g.dependents[dep] = append(g.dependents[dep], name)
+		}
+	}
+
+	if cycle := g.findCycle(); cycle != nil {
+		return nil, apperr.NewCycleError("stack", cycle)
+	}
+
+	return g, nil
+}
+
+// OutputRefStacks returns the names of the stacks referenced by {{stack_name.output_name}} params
+func OutputRefStacks(stack *StackConfig) []string {
+	refs := map[string]bool{}
+	for _, v := range stack.Parameters {
+		if refStack, _, ok := preprocessor.ParseOutputRef(v); ok {
+			refs[refStack] = true
+		}
+	}
+
+	retVal := []string{}
+	for ref := range refs {
+		retVal = append(retVal, ref)
+	}
+	sort.Strings(retVal)
+
+	return retVal
+}
+
+// Stacks returns all stack names in the graph sorted by name
+func (g DependencyGraph) Stacks() []string {
+	return g.names
+}
+
+// Dependencies returns the stacks that the named stack directly depends on
+func (g DependencyGraph) Dependencies(name string) []string {
+	return g.deps[name]
+}
+
+// Dependents returns the stacks that directly depend on the named stack
+func (g DependencyGraph) Dependents(name string) []string {
+	return g.dependents[name]
+}
+
+// Consumers returns the stacks that use outputs from the named stack
+func (g DependencyGraph) Consumers(name string) []string {
+	return g.consumers[name]
+}
+
+// Upstream returns every stack that the named stacks transitively depend on, not including the named stacks
+func (g DependencyGraph) Upstream(names []string) []string {
+	return g.walk(names, g.deps)
+}
+
+// Downstream returns every stack that transitively uses outputs from the named stacks, not including the named stacks
+func (g DependencyGraph) Downstream(names []string) []string {
+	return g.walk(names, g.consumers)
+}
+
+func (g DependencyGraph) walk(names []string, edges map[string][]string) []string {
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+
+	retVal := []string{}
+	queue := append([]string{}, names...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for _, next := range edges[name] {
+			if !seen[next] {
+				seen[next] = true
+				retVal = append(retVal, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+	sort.Strings(retVal)
+
+	return retVal
+}
+
+// findCycle returns the path of the first cycle found or nil if the graph is acyclic
+func (g DependencyGraph) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := map[string]int{}
+	path := []string{}
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+
+		for _, dep := range g.deps[name] {
+			switch state[dep] {
+			case visiting:
+				// Trim the path down to the start of the cycle
+				for i, p := range path {
+					if p == dep {
+						return append(append([]string{}, path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range g.names {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/apperr"
+)
+
+func TestDependencyGraph_NewDependencyGraph(t *testing.T) {
+	stacks := map[string]*StackConfig{
+		"boot": {
+			RawName:   "boot",
+			DependsOn: []string{},
+		},
+		"network": {
+			RawName:   "network",
+			DependsOn: []string{"boot"},
+		},
+		"sleep": {
+			RawName:   "sleep",
+			DependsOn: []string{},
+			Parameters: map[string]string{
+				"FunctionArn": "{{boot.FunctionArn}}",
+				"LogLevel":    "{{LogLevel}}",
+			},
+		},
+		"app": {
+			RawName:   "app",
+			DependsOn: []string{"network", "sleep"},
+		},
+	}
+
+	g, err := NewDependencyGraph(stacks)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app", "boot", "network", "sleep"}, g.Stacks())
+	assert.Empty(t, g.Dependencies("boot"))
+	assert.Equal(t, []string{"boot"}, g.Dependencies("network"))
+	assert.Equal(t, []string{"boot"}, g.Dependencies("sleep"))
+	assert.Equal(t, []string{"network", "sleep"}, g.Dependencies("app"))
+	assert.Equal(t, []string{"network", "sleep"}, g.Dependents("boot"))
+}
+
+func TestDependencyGraph_UpstreamDownstream(t *testing.T) {
+	stacks := map[string]*StackConfig{
+		"boot":    {RawName: "boot", DependsOn: []string{}},
+		"network": {RawName: "network", DependsOn: []string{"boot"}},
+		"db": {
+			RawName:    "db",
+			DependsOn:  []string{},
+			Parameters: map[string]string{"VpcId": "{{network.VpcId}}"},
+		},
+		"app": {
+			RawName:    "app",
+			DependsOn:  []string{},
+			Parameters: map[string]string{"DbHost": "{{db.Host}}"},
+		},
+		"other": {RawName: "other", DependsOn: []string{}},
+	}
+
+	g, err := NewDependencyGraph(stacks)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"boot", "db", "network"}, g.Upstream([]string{"app"}))
+	assert.Equal(t, []string{"app", "db"}, g.Downstream([]string{"network"}))
+	assert.Empty(t, g.Downstream([]string{"boot"}), "depends_on is not an output consumer")
+	assert.Equal(t, []string{"db"}, g.Consumers("network"))
+}
+
+func TestDependencyGraph_LegacyOrder(t *testing.T) {
+	stacks := map[string]*StackConfig{
+		"boot":  {RawName: "boot", Order: 1},
+		"other": {RawName: "other", Order: 1},
+		"sleep": {RawName: "sleep", Order: 2},
+	}
+
+	g, err := NewDependencyGraph(stacks)
+	assert.NoError(t, err)
+	assert.Empty(t, g.Dependencies("boot"))
+	assert.Empty(t, g.Dependencies("other"))
+	assert.Equal(t, []string{"boot", "other"}, g.Dependencies("sleep"))
+}
+
+func TestDependencyGraph_Cycle(t *testing.T) {
+	stacks := map[string]*StackConfig{
+		"a": {RawName: "a", DependsOn: []string{"b"}},
+		"b": {RawName: "b", DependsOn: []string{}, Parameters: map[string]string{"Out": "{{a.Out}}"}},
+	}
+
+	_, err := NewDependencyGraph(stacks)
+	assert.True(t, errors.Is(err, apperr.GenCycleError))
+	assert.Equal(t, "stack dependency cycle detected: a -> b -> a", err.Error())
+}
+
+func TestDependencyGraph_UnknownDependency(t *testing.T) {
+	stacks := map[string]*StackConfig{
+		"a": {RawName: "a", DependsOn: []string{"nope"}},
+	}
+
+	_, err := NewDependencyGraph(stacks)
+	assert.True(t, errors.Is(err, apperr.GenNotFoundError))
+}
+
+func TestDependencyGraph_OutputRefStacks(t *testing.T) {
+	stack := &StackConfig{
+		Parameters: map[string]string{
+			"One":      "{{boot.One}}",
+			"Two":      "{{boot.Two}}",
+			"Three":    "{{net.Three}}",
+			"LogLevel": "{{LogLevel}}",
+			"Static":   "10",
+		},
+	}
+
+	assert.Equal(t, []string{"boot", "net"}, OutputRefStacks(stack))
+}
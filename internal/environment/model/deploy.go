@@ -11,6 +11,7 @@ const (
 	StateUpdating
 	StateDeleting
 	StateRollingBack
+	StateRolledBack
 	StateFailed
 )
 
@@ -33,17 +34,31 @@ func (e State) String() string {
 		return "Deleting"
 	case StateRollingBack:
 		return "RollingBack"
+	case StateRolledBack:
+		return "RolledBack"
 	case StateFailed:
 		return "Failed"
 	case StateComplete:
 		return "Complete"
 	case StateDryRun:
 		return "DryRun"
+	case StateDeleted:
+		return "Deleted"
 	default:
 		return "Unknown"
 	}
 }
 
+// ParseState returns the state with the given name, unknown names return StateUnknown
+func ParseState(name string) State {
+	for st := StateUnknown; st <= StateFailed; st++ {
+		if st.String() == name {
+			return st
+		}
+	}
+	return StateUnknown
+}
+
 type NextAction int
 
 const (
@@ -71,6 +86,16 @@ func (e NextAction) String() string {
 	}
 }
 
+// ParseNextAction returns the action with the given name, unknown names return NextActionUnknown
+func ParseNextAction(name string) NextAction {
+	for act := NextActionUnknown; act <= NextActionNone; act++ {
+		if act.String() == name {
+			return act
+		}
+	}
+	return NextActionUnknown
+}
+
 type DeployStatus struct {
 	Name    string
 	State   State
@@ -17,9 +17,21 @@ func TestState_GetPriority(t *testing.T) {
 func TestState_String(t *testing.T) {
 	st := StateUnknown
 	assert.Equal(t, "Unknown", st.String())
+	assert.Equal(t, "RolledBack", StateRolledBack.String())
 }
 
 func TestNextAction_String(t *testing.T) {
 	act := NextActionCreate
 	assert.Equal(t, "Create", act.String())
 }
+
+func TestParseState(t *testing.T) {
+	assert.Equal(t, StateRollingBack, ParseState("RollingBack"))
+	assert.Equal(t, StateFailed, ParseState(StateFailed.String()))
+	assert.Equal(t, StateUnknown, ParseState("bogus"))
+}
+
+func TestParseNextAction(t *testing.T) {
+	assert.Equal(t, NextActionDelete, ParseNextAction("Delete"))
+	assert.Equal(t, NextActionUnknown, ParseNextAction("bogus"))
+}
@@ -0,0 +1,58 @@
+package model
+
+const (
+	DriftStatusInSync     = "IN_SYNC"
+	DriftStatusDrifted    = "DRIFTED"
+	DriftStatusUnknown    = "UNKNOWN"
+	DriftStatusNotChecked = "NOT_CHECKED"
+)
+
+const (
+	DriftDetectionComplete = "DETECTION_COMPLETE"
+	DriftDetectionFailed   = "DETECTION_FAILED"
+)
+
+const (
+	ResourceDriftModified = "MODIFIED"
+	ResourceDriftDeleted  = "DELETED"
+)
+
+// StackDrift is the result of a drift detection on a stack. Complete is false while the detection is still running,
+// and Resources only lists the resources that drifted. DetectionStatus is DETECTION_FAILED if some resources couldn't
+// be checked.
+type StackDrift struct {
+	Name            string          `json:"name"`
+	Complete        bool            `json:"complete"`
+	Status          string          `json:"status,omitempty"`
+	DetectionStatus string          `json:"detection_status,omitempty"`
+	Reason          string          `json:"reason,omitempty"`
+	Resources       []ResourceDrift `json:"resources,omitempty"`
+}
+
+// ResourceDrift is a resource that was changed or deleted outside of a deploy
+type ResourceDrift struct {
+	LogicalId    string               `json:"logical_id"`
+	PhysicalId   string               `json:"physical_id,omitempty"`
+	ResourceType string               `json:"resource_type,omitempty"`
+	Status       string               `json:"status"`
+	Differences  []PropertyDifference `json:"differences,omitempty"`
+}
+
+// PropertyDifference is a property of a drifted resource that differs from the template. Type is ADD, REMOVE or
+// NOT_EQUAL.
+type PropertyDifference struct {
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// IsDrifted returns true if the stack or any of its resources drifted
+func (d StackDrift) IsDrifted() bool {
+	return d.Status == DriftStatusDrifted || len(d.Resources) > 0
+}
+
+// IsDetectionFailed returns true if the detection failed or couldn't tell whether the stack drifted
+func (d StackDrift) IsDetectionFailed() bool {
+	return d.DetectionStatus == DriftDetectionFailed || d.Status == DriftStatusUnknown
+}
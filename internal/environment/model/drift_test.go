@@ -0,0 +1,25 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackDrift_IsDrifted(t *testing.T) {
+	assert.True(t, StackDrift{Status: DriftStatusDrifted}.IsDrifted())
+	assert.True(t, StackDrift{Status: DriftStatusUnknown, Resources: []ResourceDrift{{
+		LogicalId: "Bucket",
+		Status:    ResourceDriftDeleted,
+	}}}.IsDrifted())
+	assert.False(t, StackDrift{Status: DriftStatusInSync}.IsDrifted())
+	assert.False(t, StackDrift{Status: DriftStatusNotChecked}.IsDrifted())
+}
+
+func TestStackDrift_IsDetectionFailed(t *testing.T) {
+	assert.True(t, StackDrift{Status: DriftStatusDrifted, DetectionStatus: DriftDetectionFailed}.IsDetectionFailed())
+	assert.True(t, StackDrift{Status: DriftStatusUnknown}.IsDetectionFailed())
+	assert.False(t, StackDrift{Status: DriftStatusInSync, DetectionStatus: DriftDetectionComplete}.IsDetectionFailed())
+	assert.False(t, StackDrift{Status: DriftStatusDrifted}.IsDetectionFailed())
+	assert.False(t, StackDrift{Status: DriftStatusNotChecked}.IsDetectionFailed())
+}
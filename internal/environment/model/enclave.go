@@ -1,36 +1,76 @@
 package model
 
-import "github.com/swizzleio/swiz/pkg/drivers/awswrap"
+import (
+	"time"
+
+	"github.com/swizzleio/swiz/pkg/backoff"
+	"github.com/swizzleio/swiz/pkg/configutil"
+	"github.com/swizzleio/swiz/pkg/drivers/awswrap"
+)
+
+const (
+	DefaultMinPollInterval = 2 * time.Second
+	DefaultMaxPollInterval = 30 * time.Second
+)
 
 const (
-	EncProvDummy = "DUMMY"
-	EncProvAws   = "AWS"
-	IacTypeDummy = "Dummy"
-	IacTypeCf    = "Cloudformation"
+	EncProvDummy     = "DUMMY"
+	EncProvAws       = "AWS"
+	EncProvK8s       = "KUBERNETES"
+	IacTypeDummy     = "Dummy"
+	IacTypeCf        = "Cloudformation"
+	IacTypeCfSet     = "CloudformationStackSet"
+	IacTypeTerraform = "Terraform"
+	IacTypeOpenTofu  = "OpenTofu"
+	IacTypeK8s       = "Kubernetes"
+	IacTypeScript    = "Script"
+	IacTypeCompose   = "Compose"
+	IacTypePlugin    = "plugin:"
 )
 
 type EnvBehavior struct {
-	NoUpdateDeploy  *bool `yaml:"no_update_deploy,omitempty"`
-	NoOrphanDelete  *bool `yaml:"no_orphan_delete,omitempty"`
-	DeployAllStacks *bool `yaml:"deploy_all_stacks,omitempty"`
-	FastDelete      *bool `yaml:"fast_delete,omitempty"`
+	NoUpdateDeploy    *bool          `yaml:"no_update_deploy,omitempty"`
+	NoOrphanDelete    *bool          `yaml:"no_orphan_delete,omitempty"`
+	DeployAllStacks   *bool          `yaml:"deploy_all_stacks,omitempty"`
+	FastDelete        *bool          `yaml:"fast_delete,omitempty"`
+	MaxParallel       *int           `yaml:"max_parallel,omitempty"`
+	RollbackOnFailure *bool          `yaml:"rollback_on_failure,omitempty"`
+	StackTimeout      *time.Duration `yaml:"stack_timeout,omitempty"`
+	EnvTimeout        *time.Duration `yaml:"env_timeout,omitempty"`
+}
+
+type EncRetry struct {
+	MaxAttempts     int           `yaml:"max_attempts,omitempty"`
+	BaseDelay       time.Duration `yaml:"base_delay,omitempty"`
+	MaxDelay        time.Duration `yaml:"max_delay,omitempty"`
+	MinPollInterval time.Duration `yaml:"min_poll_interval,omitempty"`
+	MaxPollInterval time.Duration `yaml:"max_poll_interval,omitempty"`
 }
 
 type EncProvider struct {
-	Name       string `yaml:"name"`
-	ProviderId string `yaml:"provider_id"`
-	AccountId  string `yaml:"account_id"`
-	Region     string `yaml:"region"`
+	Name        string        `yaml:"name"`
+	ProviderId  string        `yaml:"provider_id"`
+	AccountId   string        `yaml:"account_id"`
+	Region      string        `yaml:"region"`
+	Profile     string        `yaml:"profile,omitempty"`
+	RoleArn     string        `yaml:"role_arn,omitempty"`
+	ExternalId  string        `yaml:"external_id,omitempty"`
+	SessionName string        `yaml:"session_name,omitempty"`
+	Duration    time.Duration `yaml:"duration,omitempty"`
 }
 
 type Enclave struct {
-	Name            string            `yaml:"name"`
-	DefaultProvider string            `yaml:"default_provider"`
-	DefaultIac      string            `yaml:"default_iac"`
-	Providers       []EncProvider     `yaml:"providers"`
-	EnvBehavior     EnvBehavior       `yaml:"env_behavior"`
-	DomainName      string            `yaml:"domain_name"`
-	Parameters      map[string]string `yaml:"params"`
+	Name            string                `yaml:"name"`
+	DefaultProvider string                `yaml:"default_provider"`
+	DefaultIac      string                `yaml:"default_iac"`
+	Providers       []EncProvider         `yaml:"providers"`
+	EnvBehavior     EnvBehavior           `yaml:"env_behavior"`
+	Retry           EncRetry              `yaml:"retry,omitempty"`
+	DomainName      string                `yaml:"domain_name"`
+	ArtifactBucket  string                `yaml:"artifact_bucket,omitempty"`
+	ArtifactBuckets map[string]string     `yaml:"artifact_buckets,omitempty"`
+	CfConfig        *CloudFormationConfig `yaml:"cloudformation,omitempty"`
+	Parameters      map[string]string     `yaml:"params"`
 }
 
 func (e Enclave) GetProvider(providerName string) *EncProvider {
@@ -46,8 +86,53 @@ func (e Enclave) GetProvider(providerName string) *EncProvider {
 	return nil
 }
 
+// GetArtifactBucket returns the artifact bucket for a provider deploying to a region. The artifact_buckets entry of the
+// region comes first, and artifact_bucket is only used in the region of the provider since CloudFormation can't read
+// templates from a bucket in another region. It's empty if there is no bucket in the region.
+func (e Enclave) GetArtifactBucket(providerName string, region string) string {
+	if bucket := e.ArtifactBuckets[region]; bucket != "" {
+		return bucket
+	}
+
+	provider := e.GetProvider(providerName)
+	if provider == nil || provider.Region != region {
+		return ""
+	}
+
+	return e.ArtifactBucket
+}
+
+// GetProfile returns the AWS profile of the provider, which is the provider name unless a profile is set
+func (e EncProvider) GetProfile() string {
+	return configutil.SetOrDefault(e.Profile, e.Name)
+}
+
+// ToAwsConfig returns the AWS config of the provider. The profile assumes the role if one is set.
 func (e EncProvider) ToAwsConfig() awswrap.AwsConfiger {
-	return awswrap.NewAwsConfig(e.Name, e.AccountId, e.Region)
+	return &awswrap.AwsConfig{
+		Profile:     e.GetProfile(),
+		AccountId:   e.AccountId,
+		Region:      e.Region,
+		RoleArn:     e.RoleArn,
+		ExternalId:  e.ExternalId,
+		SessionName: e.SessionName,
+		Duration:    e.Duration,
+	}
+}
+
+// ToRetryOpts returns the options for retrying AWS calls, unset values use the awswrap defaults
+func (r EncRetry) ToRetryOpts() awswrap.RetryOpts {
+	return awswrap.RetryOpts{
+		MaxAttempts: r.MaxAttempts,
+		BaseDelay:   r.BaseDelay,
+		MaxDelay:    r.MaxDelay,
+	}
+}
+
+// PollInterval returns a new adaptive interval for polling the state of a deploy
+func (r EncRetry) PollInterval() *backoff.Interval {
+	return backoff.NewInterval(configutil.SetOrDefault(r.MinPollInterval, DefaultMinPollInterval),
+		configutil.SetOrDefault(r.MaxPollInterval, DefaultMaxPollInterval))
 }
 
 func GenerateEnclave(config awswrap.AwsConfig, domainName string, params map[string]string) Enclave {
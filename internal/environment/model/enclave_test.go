@@ -2,6 +2,7 @@ package model
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/swizzleio/swiz/pkg/drivers/awswrap"
@@ -65,6 +66,82 @@ func TestEnclave_ToAwsConfig(t *testing.T) {
 	assert.Equal(t, "foobar", cfg.Profile)
 	assert.Equal(t, "1234567890", cfg.AccountId)
 	assert.Equal(t, "us-west-2", cfg.Region)
+	assert.Equal(t, "", cfg.RoleArn)
+
+	encProvider.RoleArn = "arn:aws:iam::1234567890:role/deploy"
+	encProvider.ExternalId = "neato"
+	encProvider.SessionName = "swiz-dev"
+	encProvider.Duration = time.Hour
+
+	encProvider.Profile = "base"
+
+	cfg, ok = encProvider.ToAwsConfig().(*awswrap.AwsConfig)
+	assert.True(t, ok)
+	assert.Equal(t, "base", cfg.Profile)
+	assert.Equal(t, "arn:aws:iam::1234567890:role/deploy", cfg.RoleArn)
+	assert.Equal(t, "neato", cfg.ExternalId)
+	assert.Equal(t, "swiz-dev", cfg.SessionName)
+	assert.Equal(t, time.Hour, cfg.Duration)
+}
+
+func TestEnclave_Retry(t *testing.T) {
+	retry := EncRetry{
+		MaxAttempts:     3,
+		BaseDelay:       2 * time.Second,
+		MaxPollInterval: 10 * time.Second,
+	}
+
+	opts := retry.ToRetryOpts()
+	assert.Equal(t, 3, opts.MaxAttempts)
+	assert.Equal(t, 2*time.Second, opts.BaseDelay)
+	assert.Equal(t, time.Duration(0), opts.MaxDelay)
+
+	interval := retry.PollInterval()
+	assert.Equal(t, DefaultMinPollInterval, interval.Min)
+	assert.Equal(t, 10*time.Second, interval.Max)
+}
+
+func TestEnclave_GetArtifactBucket(t *testing.T) {
+	enc := Enclave{
+		DefaultProvider: "dev",
+		Providers: []EncProvider{
+			{Name: "dev", Region: "us-east-1"},
+			{Name: "shared", Region: "us-west-2"},
+		},
+		ArtifactBucket:  "swiz-artifacts",
+		ArtifactBuckets: map[string]string{"eu-west-1": "swiz-artifacts-eu"},
+	}
+	tests := []struct {
+		name     string
+		provider string
+		region   string
+		want     string
+	}{
+		{
+			name:   "provider region",
+			region: "us-east-1",
+			want:   "swiz-artifacts",
+		},
+		{
+			name:   "regional bucket",
+			region: "eu-west-1",
+			want:   "swiz-artifacts-eu",
+		},
+		{
+			name:   "no bucket in region",
+			region: "ap-south-1",
+		},
+		{
+			name:     "other provider region",
+			provider: "shared",
+			region:   "us-east-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, enc.GetArtifactBucket(tt.provider, tt.region))
+		})
+	}
 }
 
 func TestEnclave_GenerateEnclave(t *testing.T) {
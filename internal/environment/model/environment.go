@@ -3,6 +3,9 @@ package model
 import (
 	"fmt"
 	"github.com/swizzleio/swiz/internal/appconfig"
+	"sort"
+	"strings"
+	"time"
 )
 
 const (
@@ -10,9 +13,15 @@ const (
 )
 
 type StackConfigDef struct {
-	Name       string `yaml:"name"`
-	ConfigFile string `yaml:"config_file"`
-	Order      int    `yaml:"order"`
+	Name       string        `yaml:"name"`
+	ConfigFile string        `yaml:"config_file"`
+	Order      int           `yaml:"order"`
+	DependsOn  []string      `yaml:"depends_on,omitempty"`
+	Timeout    time.Duration `yaml:"timeout,omitempty"`
+	Iac        string        `yaml:"iac,omitempty"`
+	Provider   string        `yaml:"provider,omitempty"`
+	Region     string        `yaml:"region,omitempty"`
+	Regions    []string      `yaml:"regions,omitempty"`
 }
 
 type EnvironmentConfig struct {
@@ -31,6 +40,48 @@ type EnvironmentInfo struct {
 	StackInfo       []StackInfo
 }
 
+// NewEnvironmentInfo sums up the state of the stacks in an environment. The environment takes the state of its least
+// healthy stack.
+func NewEnvironmentInfo(envName string, stacks []StackInfo) EnvironmentInfo {
+	envState := StateComplete
+	stackStatus := []string{}
+	for _, stack := range stacks {
+		if stack.DeployStatus.State != StateComplete {
+			envState = envState.GetPriority(stack.DeployStatus.State)
+			stackStatus = append(stackStatus, fmt.Sprintf("%v[%v]", stack.Name, stack.DeployStatus.State.String()))
+		}
+	}
+
+	return EnvironmentInfo{
+		EnvironmentName: envName,
+		DeployStatus: DeployStatus{
+			Name:    envName,
+			State:   envState,
+			Reason:  envState.String(),
+			Details: strings.Join(stackStatus, ", "),
+		},
+		StackInfo: stacks,
+	}
+}
+
+// ExpandStackName returns the stacks for a stack name, which are the regional copies of a stack deployed to several
+// regions. Nothing is returned if there is no such stack.
+func (e EnvironmentConfig) ExpandStackName(name string) []string {
+	if _, ok := e.Stacks[name]; ok {
+		return []string{name}
+	}
+
+	retVal := []string{}
+	for stackName := range e.Stacks {
+		if baseName, region := SplitRegionalStackName(stackName); region != "" && baseName == name {
+			retVal = append(retVal, stackName)
+		}
+	}
+	sort.Strings(retVal)
+
+	return retVal
+}
+
 func GenerateFileName(stackName string) string {
 	return fmt.Sprintf("%v/%v-cfg.yaml", appconfig.DefaultOutLocation, stackName)
 }
@@ -46,3 +46,34 @@ func TestEnvironment_GenerateEnvironmentConfig(t *testing.T) {
 	assert.Equal(t, DefaultNamingScheme, cfg.NamingScheme)
 	assert.Equal(t, enclaves, cfg.EnclaveDefinition)
 }
+
+func TestEnvironment_NewEnvironmentInfo(t *testing.T) {
+	info := NewEnvironmentInfo("neato", []StackInfo{
+		{Name: "neato-a", DeployStatus: DeployStatus{State: StateComplete}},
+		{Name: "neato-b", DeployStatus: DeployStatus{State: StateUpdating}},
+		{Name: "neato-c", DeployStatus: DeployStatus{State: StateFailed}},
+	})
+	assert.Equal(t, "neato", info.EnvironmentName)
+	assert.Equal(t, StateFailed, info.DeployStatus.State)
+	assert.Equal(t, "neato-b[Updating], neato-c[Failed]", info.DeployStatus.Details)
+	assert.Len(t, info.StackInfo, 3)
+
+	info = NewEnvironmentInfo("neato", []StackInfo{})
+	assert.Equal(t, StateComplete, info.DeployStatus.State)
+	assert.Equal(t, "", info.DeployStatus.Details)
+}
+
+func TestEnvironment_ExpandStackName(t *testing.T) {
+	env := EnvironmentConfig{
+		Stacks: map[string]*StackConfig{
+			"boot":           {},
+			"edge@us-east-1": {},
+			"edge@eu-west-1": {},
+		},
+	}
+
+	assert.Equal(t, []string{"boot"}, env.ExpandStackName("boot"))
+	assert.Equal(t, []string{"edge@eu-west-1"}, env.ExpandStackName("edge@eu-west-1"))
+	assert.Equal(t, []string{"edge@eu-west-1", "edge@us-east-1"}, env.ExpandStackName("edge"))
+	assert.Empty(t, env.ExpandStackName("meh"))
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// StackEvent is a change to the status of a stack or one of its resources while an operation is in progress
+type StackEvent struct {
+	Id           string
+	StackName    string
+	Timestamp    time.Time
+	LogicalId    string
+	ResourceType string
+	Status       string
+	Reason       string
+}
+
+// StackEventHandler is passed the new events of the stacks that are being waited on. It can be called from several
+// goroutines at once.
+type StackEventHandler func(event StackEvent)
+
+// IsFailed returns true if the event reports that a resource failed, such as CREATE_FAILED
+func (e StackEvent) IsFailed() bool {
+	return strings.HasSuffix(e.Status, "_FAILED")
+}
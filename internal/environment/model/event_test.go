@@ -0,0 +1,14 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackEvent_IsFailed(t *testing.T) {
+	assert.True(t, StackEvent{Status: "CREATE_FAILED"}.IsFailed())
+	assert.True(t, StackEvent{Status: "UPDATE_ROLLBACK_FAILED"}.IsFailed())
+	assert.False(t, StackEvent{Status: "CREATE_IN_PROGRESS"}.IsFailed())
+	assert.False(t, StackEvent{Status: "UPDATE_COMPLETE"}.IsFailed())
+}
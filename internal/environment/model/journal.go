@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+const JournalVersion = 1
+
+// DeployJournal records the progress of a deploy so that an interrupted deploy can be resumed
+type DeployJournal struct {
+	Version  int                      `json:"version"`
+	EnvName  string                   `json:"env_name"`
+	EnvDef   string                   `json:"env_def"`
+	Enclave  string                   `json:"enclave"`
+	Started  time.Time                `json:"started"`
+	Complete bool                     `json:"complete"`
+	Stacks   map[string]*JournalStack `json:"stacks"`
+}
+
+// JournalStack is the progress of a single stack. ChangeSetName is set when the stack was updated by a change set.
+type JournalStack struct {
+	StackInfo     StackInfo         `json:"stack_info"`
+	ChangeSetName string            `json:"change_set_name,omitempty"`
+	Outputs       map[string]string `json:"outputs,omitempty"`
+	Done          bool              `json:"done"`
+}
+
+func NewDeployJournal(envName string, envDef string, enclave string) *DeployJournal {
+	return &DeployJournal{
+		Version: JournalVersion,
+		EnvName: envName,
+		EnvDef:  envDef,
+		Enclave: enclave,
+		Started: time.Now(),
+		Stacks:  map[string]*JournalStack{},
+	}
+}
+
+// GetStack returns the journal entry for a stack keyed by the raw stack name, creating it if needed
+func (j *DeployJournal) GetStack(name string) *JournalStack {
+	stack, ok := j.Stacks[name]
+	if !ok {
+		stack = &JournalStack{
+			StackInfo: StackInfo{
+				Name:      name,
+				Resources: []string{},
+			},
+		}
+		j.Stacks[name] = stack
+	}
+
+	return stack
+}
+
+// IsStackDone returns true if the stack finished deploying and its outputs were collected
+func (j *DeployJournal) IsStackDone(name string) bool {
+	stack, ok := j.Stacks[name]
+	return ok && stack.Done
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployJournal_GetStack(t *testing.T) {
+	journal := NewDeployJournal("dev", "default", "main")
+	assert.Equal(t, JournalVersion, journal.Version)
+	assert.Empty(t, journal.Stacks)
+
+	stack := journal.GetStack("boot")
+	assert.Equal(t, "boot", stack.StackInfo.Name)
+	assert.False(t, journal.IsStackDone("boot"))
+
+	stack.Done = true
+	assert.Same(t, stack, journal.GetStack("boot"))
+	assert.True(t, journal.IsStackDone("boot"))
+	assert.False(t, journal.IsStackDone("sleep"))
+}
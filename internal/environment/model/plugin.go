@@ -0,0 +1,179 @@
+package model
+
+// PluginProtocolVersion is the version of the JSON protocol spoken with IaC plugins
+const PluginProtocolVersion = 1
+
+const (
+	PluginMethodHandshake            = "Handshake"
+	PluginMethodCreateStack          = "CreateStack"
+	PluginMethodDeleteStack          = "DeleteStack"
+	PluginMethodUpdateStack          = "UpdateStack"
+	PluginMethodGetStackInfo         = "GetStackInfo"
+	PluginMethodGetStackOutputs      = "GetStackOutputs"
+	PluginMethodGetStackSnapshot     = "GetStackSnapshot"
+	PluginMethodRollbackStack        = "RollbackStack"
+	PluginMethodListStacks           = "ListStacks"
+	PluginMethodListEnvironments     = "ListEnvironments"
+	PluginMethodGetEnvironment       = "GetEnvironment"
+	PluginMethodIsEnvironmentInState = "IsEnvironmentInState"
+	PluginMethodDetectStackDrift     = "DetectStackDrift"
+	PluginMethodGetStackDrift        = "GetStackDrift"
+)
+
+const (
+	PluginErrNotFound    = "not_found"
+	PluginErrUnsupported = "unsupported"
+)
+
+// PluginRequest is written to the stdin of a plugin. Only the fields used by the method are set.
+type PluginRequest struct {
+	ProtocolVersion int               `json:"protocol_version"`
+	Method          string            `json:"method"`
+	Enclave         string            `json:"enclave"`
+	Provider        PluginProvider    `json:"provider"`
+	Name            string            `json:"name,omitempty"`
+	EnvName         string            `json:"env_name,omitempty"`
+	TemplateFile    string            `json:"template_file,omitempty"`
+	TimeoutSeconds  int               `json:"timeout_seconds,omitempty"`
+	Params          map[string]string `json:"params,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	DryRun          bool              `json:"dry_run,omitempty"`
+	Stacks          []string          `json:"stacks,omitempty"`
+	States          []string          `json:"states,omitempty"`
+	Snapshot        *PluginSnapshot   `json:"snapshot,omitempty"`
+	DetectionId     string            `json:"detection_id,omitempty"`
+}
+
+// PluginResponse is read from the stdout of a plugin. Only the fields returned by the method are set.
+type PluginResponse struct {
+	ProtocolVersion int                `json:"protocol_version"`
+	Capabilities    []string           `json:"capabilities,omitempty"`
+	Stack           *PluginStackInfo   `json:"stack,omitempty"`
+	Stacks          []PluginStackInfo  `json:"stacks,omitempty"`
+	Environment     *PluginEnvironment `json:"environment,omitempty"`
+	Environments    []string           `json:"environments,omitempty"`
+	Outputs         map[string]string  `json:"outputs,omitempty"`
+	Snapshot        *PluginSnapshot    `json:"snapshot,omitempty"`
+	InState         bool               `json:"in_state,omitempty"`
+	DetectionId     string             `json:"detection_id,omitempty"`
+	Drift           *StackDrift        `json:"drift,omitempty"`
+	Error           *PluginError       `json:"error,omitempty"`
+}
+
+type PluginProvider struct {
+	Name            string `json:"name"`
+	ProviderId      string `json:"provider_id"`
+	AccountId       string `json:"account_id"`
+	Region          string `json:"region"`
+	RoleArn         string `json:"role_arn,omitempty"`
+	ExternalId      string `json:"external_id,omitempty"`
+	SessionName     string `json:"session_name,omitempty"`
+	DurationSeconds int    `json:"duration_seconds,omitempty"`
+}
+
+// PluginStackInfo is a StackInfo with the state and next action as names
+type PluginStackInfo struct {
+	Name       string   `json:"name"`
+	NextAction string   `json:"next_action,omitempty"`
+	State      string   `json:"state"`
+	Reason     string   `json:"reason,omitempty"`
+	Details    string   `json:"details,omitempty"`
+	Resources  []string `json:"resources,omitempty"`
+}
+
+type PluginEnvironment struct {
+	Name    string            `json:"name"`
+	State   string            `json:"state"`
+	Reason  string            `json:"reason,omitempty"`
+	Details string            `json:"details,omitempty"`
+	Stacks  []PluginStackInfo `json:"stacks,omitempty"`
+}
+
+type PluginSnapshot struct {
+	TemplateBody string            `json:"template_body,omitempty"`
+	Params       map[string]string `json:"params,omitempty"`
+}
+
+type PluginError struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func NewPluginProvider(provider EncProvider) PluginProvider {
+	return PluginProvider{
+		Name:            provider.Name,
+		ProviderId:      provider.ProviderId,
+		AccountId:       provider.AccountId,
+		Region:          provider.Region,
+		RoleArn:         provider.RoleArn,
+		ExternalId:      provider.ExternalId,
+		SessionName:     provider.SessionName,
+		DurationSeconds: int(provider.Duration.Seconds()),
+	}
+}
+
+// HasCapability returns true if the plugin said it supports the method in its handshake
+func (r PluginResponse) HasCapability(method string) bool {
+	for _, c := range r.Capabilities {
+		if c == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (s PluginStackInfo) ToStackInfo() StackInfo {
+	resources := s.Resources
+	if resources == nil {
+		resources = []string{}
+	}
+
+	return StackInfo{
+		Name:       s.Name,
+		NextAction: ParseNextAction(s.NextAction),
+		DeployStatus: DeployStatus{
+			Name:    s.Name,
+			State:   ParseState(s.State),
+			Reason:  s.Reason,
+			Details: s.Details,
+		},
+		Resources: resources,
+	}
+}
+
+func (e PluginEnvironment) ToEnvironmentInfo() EnvironmentInfo {
+	stacks := []StackInfo{}
+	for _, s := range e.Stacks {
+		stacks = append(stacks, s.ToStackInfo())
+	}
+
+	return EnvironmentInfo{
+		EnvironmentName: e.Name,
+		DeployStatus: DeployStatus{
+			Name:    e.Name,
+			State:   ParseState(e.State),
+			Reason:  e.Reason,
+			Details: e.Details,
+		},
+		StackInfo: stacks,
+	}
+}
+
+func NewPluginSnapshot(snapshot *StackSnapshot) *PluginSnapshot {
+	if snapshot == nil {
+		return nil
+	}
+
+	return &PluginSnapshot{
+		TemplateBody: snapshot.TemplateBody,
+		Params:       snapshot.Parameters,
+	}
+}
+
+func (s PluginSnapshot) ToStackSnapshot(name string) *StackSnapshot {
+	return &StackSnapshot{
+		Name:         name,
+		TemplateBody: s.TemplateBody,
+		Parameters:   s.Params,
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlugin_HasCapability(t *testing.T) {
+	resp := PluginResponse{
+		ProtocolVersion: PluginProtocolVersion,
+		Capabilities:    []string{PluginMethodCreateStack, PluginMethodGetStackInfo},
+	}
+
+	assert.True(t, resp.HasCapability(PluginMethodCreateStack))
+	assert.False(t, resp.HasCapability(PluginMethodRollbackStack))
+}
+
+func TestPlugin_ResponseToStackInfo(t *testing.T) {
+	data := `{"protocol_version":1,"environment":{"name":"dev","state":"Updating","stacks":[
+		{"name":"dev-neato","next_action":"Update","state":"Updating","reason":"applying"}]}}`
+
+	resp := PluginResponse{}
+	assert.NoError(t, json.Unmarshal([]byte(data), &resp))
+
+	env := resp.Environment.ToEnvironmentInfo()
+	assert.Equal(t, "dev", env.EnvironmentName)
+	assert.Equal(t, StateUpdating, env.DeployStatus.State)
+	assert.Len(t, env.StackInfo, 1)
+	assert.Equal(t, "dev-neato", env.StackInfo[0].Name)
+	assert.Equal(t, NextActionUpdate, env.StackInfo[0].NextAction)
+	assert.Equal(t, StateUpdating, env.StackInfo[0].DeployStatus.State)
+	assert.Equal(t, "applying", env.StackInfo[0].DeployStatus.Reason)
+	assert.NotNil(t, env.StackInfo[0].Resources)
+}
+
+func TestPlugin_Snapshot(t *testing.T) {
+	assert.Nil(t, NewPluginSnapshot(nil))
+
+	snap := NewPluginSnapshot(&StackSnapshot{
+		Name:         "dev-neato",
+		TemplateBody: "body",
+		Parameters:   map[string]string{"foo": "bar"},
+	})
+
+	restored := snap.ToStackSnapshot("dev-neato")
+	assert.Equal(t, "dev-neato", restored.Name)
+	assert.Equal(t, "body", restored.TemplateBody)
+	assert.Equal(t, "bar", restored.Parameters["foo"])
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/swizzleio/swiz/pkg/preprocessor"
+)
+
+// RegionSeparator joins the name of a stack deployed to several regions with the region of each copy
+const RegionSeparator = "@"
+
+// RegionalStackName returns the name of the copy of a stack in a region, such as edge@eu-west-1
+func RegionalStackName(name string, region string) string {
+	return name + RegionSeparator + region
+}
+
+// SplitRegionalStackName returns the stack name and region of a regional copy. The region is empty for other stacks.
+func SplitRegionalStackName(name string) (string, string) {
+	stackName, region, _ := strings.Cut(name, RegionSeparator)
+	return stackName, region
+}
+
+// ExpandRegions replaces each stack with a list of regions by a copy per region named <stack>@<region>. A copy that
+// depends on or references a stack deployed to the same regions uses the copy in its own region. Anything else that
+// depends on a regional stack depends on every copy, and references must name the region.
+func ExpandRegions(stacks map[string]*StackConfig) (map[string]*StackConfig, error) {
+	regional := map[string]map[string]bool{}
+	for name, stack := range stacks {
+		if strings.Contains(name, RegionSeparator) {
+			return nil, fmt.Errorf("stack %v: stack names can't contain %v", name, RegionSeparator)
+		}
+		if len(stack.Regions) == 0 {
+			continue
+		}
+		if stack.Region != "" {
+			return nil, fmt.Errorf("stack %v: set either region or regions", name)
+		}
+
+		regional[name] = map[string]bool{}
+		for _, region := range stack.Regions {
+			if region == "" || regional[name][region] {
+				return nil, fmt.Errorf("stack %v: regions must be unique and not empty", name)
+			}
+			regional[name][region] = true
+		}
+	}
+
+	if len(regional) == 0 {
+		return stacks, nil
+	}
+
+	retVal := map[string]*StackConfig{}
+	for name, stack := range stacks {
+		if regional[name] == nil {
+			copied := *stack
+			copied.DependsOn = expandRegionalDeps(stack, regional, "")
+			retVal[name] = &copied
+			continue
+		}
+
+		for _, region := range stack.Regions {
+			copied := *stack
+			copied.Name = RegionalStackName(name, region)
+			copied.RawName = copied.Name
+			copied.Region = region
+			copied.Regions = nil
+			copied.DependsOn = expandRegionalDeps(stack, regional, region)
+
+			// References to a stack in the same regions use the copy in this region
+			copied.Parameters = map[string]string{}
+			for k, v := range stack.Parameters {
+				refStack, refOutput, ok := preprocessor.ParseOutputRef(v)
+				if ok && regional[refStack][region] {
+					v = fmt.Sprintf("{{%v.%v}}", RegionalStackName(refStack, region), refOutput)
+				}
+				copied.Parameters[k] = v
+			}
+
+			retVal[copied.Name] = &copied
+		}
+	}
+
+	// A reference to a regional stack without a region is ambiguous
+	for name, stack := range retVal {
+		for paramName, v := range stack.Parameters {
+			refStack, refOutput, ok := preprocessor.ParseOutputRef(v)
+			if ok && regional[refStack] != nil {
+				return nil, fmt.Errorf("stack %v param %v: stack %v is deployed to several regions, use {{%v.%v}}",
+					name, paramName, refStack, RegionalStackName(refStack, "<region>"), refOutput)
+			}
+		}
+	}
+
+	return retVal, nil
+}
+
+// expandRegionalDeps replaces each regional stack in the depends_on list with the copy in the region, or every copy if
+// it isn't deployed to the region
+func expandRegionalDeps(stack *StackConfig, regional map[string]map[string]bool, region string) []string {
+	if stack.DependsOn == nil {
+		return nil
+	}
+
+	deps := []string{}
+	for _, dep := range stack.DependsOn {
+		switch {
+		case regional[dep] == nil:
+			deps = append(deps, dep)
+		case regional[dep][region]:
+			deps = append(deps, RegionalStackName(dep, region))
+		default:
+			regions := []string{}
+			for r := range regional[dep] {
+				regions = append(regions, r)
+			}
+			sort.Strings(regions)
+			for _, r := range regions {
+				deps = append(deps, RegionalStackName(dep, r))
+			}
+		}
+	}
+
+	return deps
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegion_RegionalStackName(t *testing.T) {
+	assert.Equal(t, "edge@eu-west-1", RegionalStackName("edge", "eu-west-1"))
+
+	name, region := SplitRegionalStackName("edge@eu-west-1")
+	assert.Equal(t, "edge", name)
+	assert.Equal(t, "eu-west-1", region)
+
+	name, region = SplitRegionalStackName("edge")
+	assert.Equal(t, "edge", name)
+	assert.Equal(t, "", region)
+}
+
+func TestRegion_ExpandRegions(t *testing.T) {
+	stacks := map[string]*StackConfig{
+		"boot": {Name: "boot", RawName: "boot", Order: 1},
+		"edge": {
+			Name:       "edge",
+			RawName:    "edge",
+			Order:      2,
+			Regions:    []string{"us-east-1", "eu-west-1"},
+			DependsOn:  []string{"boot"},
+			Parameters: map[string]string{"BootArn": "{{boot.Arn}}"},
+		},
+		"edgeapi": {
+			Name:       "edgeapi",
+			RawName:    "edgeapi",
+			Order:      3,
+			Regions:    []string{"eu-west-1"},
+			DependsOn:  []string{"edge"},
+			Parameters: map[string]string{"Url": "{{edge.Url}}"},
+		},
+		"dns": {
+			Name:       "dns",
+			RawName:    "dns",
+			Order:      4,
+			DependsOn:  []string{"edge"},
+			Parameters: map[string]string{"EuUrl": "{{edge@eu-west-1.Url}}"},
+		},
+	}
+
+	expanded, err := ExpandRegions(stacks)
+	assert.NoError(t, err)
+	assert.Len(t, expanded, 5)
+
+	edge := expanded["edge@eu-west-1"]
+	assert.Equal(t, "edge@eu-west-1", edge.Name)
+	assert.Equal(t, "edge@eu-west-1", edge.RawName)
+	assert.Equal(t, "eu-west-1", edge.Region)
+	assert.Nil(t, edge.Regions)
+	assert.Equal(t, []string{"boot"}, edge.DependsOn)
+	assert.Equal(t, "{{boot.Arn}}", edge.Parameters["BootArn"])
+	assert.Equal(t, "us-east-1", expanded["edge@us-east-1"].Region)
+
+	api := expanded["edgeapi@eu-west-1"]
+	assert.Equal(t, []string{"edge@eu-west-1"}, api.DependsOn)
+	assert.Equal(t, "{{edge@eu-west-1.Url}}", api.Parameters["Url"])
+
+	assert.Equal(t, []string{"edge@eu-west-1", "edge@us-east-1"}, expanded["dns"].DependsOn)
+	assert.Equal(t, []string{"edge"}, stacks["dns"].DependsOn)
+
+	_, err = NewDependencyGraph(expanded)
+	assert.NoError(t, err)
+}
+
+func TestRegion_ExpandRegionsNoRegions(t *testing.T) {
+	stacks := map[string]*StackConfig{
+		"boot": {Name: "boot", RawName: "boot"},
+	}
+
+	expanded, err := ExpandRegions(stacks)
+	assert.NoError(t, err)
+	assert.Equal(t, stacks, expanded)
+}
+
+func TestRegion_ExpandRegionsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		stacks map[string]*StackConfig
+	}{
+		{
+			name: "ambiguous reference",
+			stacks: map[string]*StackConfig{
+				"edge": {Regions: []string{"us-east-1", "eu-west-1"}},
+				"dns":  {Parameters: map[string]string{"Url": "{{edge.Url}}"}},
+			},
+		},
+		{
+			name: "reference from another region",
+			stacks: map[string]*StackConfig{
+				"edge":    {Regions: []string{"us-east-1"}},
+				"edgeapi": {Regions: []string{"eu-west-1"}, Parameters: map[string]string{"Url": "{{edge.Url}}"}},
+			},
+		},
+		{
+			name: "region and regions",
+			stacks: map[string]*StackConfig{
+				"edge": {Region: "us-east-1", Regions: []string{"eu-west-1"}},
+			},
+		},
+		{
+			name: "duplicate region",
+			stacks: map[string]*StackConfig{
+				"edge": {Regions: []string{"eu-west-1", "eu-west-1"}},
+			},
+		},
+		{
+			name: "separator in name",
+			stacks: map[string]*StackConfig{
+				"edge@home": {},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExpandRegions(tt.stacks)
+			assert.Error(t, err)
+		})
+	}
+}
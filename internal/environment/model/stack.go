@@ -1,6 +1,9 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 const (
 	StackKeyEnvName    = "SwzEnv"
@@ -8,22 +11,81 @@ const (
 	StackKeyCreateUser = "SwzCreateUser"
 	StackKeyEnvDef     = "SwzEnvDef"
 	StackKeyEnclave    = "SwzEnclave"
+	StackKeyStackName  = "SwzStack"
 )
 
 type StackConfig struct {
-	Version      int               `yaml:"version"`
-	Name         string            `yaml:"-"`
-	RawName      string            `yaml:"-"`
-	Order        int               `yaml:"-"`
-	Parameters   map[string]string `yaml:"params"`
-	TemplateFile string            `yaml:"template_file"`
+	Version      int                   `yaml:"version"`
+	Name         string                `yaml:"-"`
+	RawName      string                `yaml:"-"`
+	Order        int                   `yaml:"-"`
+	DependsOn    []string              `yaml:"-"`
+	Timeout      time.Duration         `yaml:"-"`
+	Iac          string                `yaml:"-"`
+	Provider     string                `yaml:"-"`
+	Region       string                `yaml:"-"`
+	Regions      []string              `yaml:"-"`
+	Parameters   map[string]string     `yaml:"params"`
+	TemplateFile string                `yaml:"template_file"`
+	Outputs      map[string]string     `yaml:"outputs,omitempty"`
+	Build        *StackBuild           `yaml:"build,omitempty"`
+	Script       *StackScript          `yaml:"script,omitempty"`
+	StackSet     *StackSetConfig       `yaml:"stack_set,omitempty"`
+	CfConfig     *CloudFormationConfig `yaml:"cloudformation,omitempty"`
+}
+
+// StackScript holds the commands of a Script stack. Apply is required, destroy and status are optional.
+type StackScript struct {
+	Dir     string `yaml:"dir,omitempty"`
+	Apply   string `yaml:"apply"`
+	Destroy string `yaml:"destroy,omitempty"`
+	Status  string `yaml:"status,omitempty"`
 }
 
+const (
+	ChangeActionRemove     = "Remove"
+	ReplacementTrue        = "True"
+	ReplacementConditional = "Conditional"
+)
+
+// StackInfo is a deployed stack. AdoptedAs is the name of the stack config a stack deployed outside of swiz was adopted
+// as, and is empty for other stacks.
 type StackInfo struct {
 	Name         string
 	NextAction   NextAction
 	DeployStatus DeployStatus
 	Resources    []string
+	Changes      []ResourceChange
+	AdoptedAs    string
+}
+
+// ResourceChange is a change that an update makes to a resource. Replacement is True if the resource is replaced and
+// Conditional if that depends on values only known during the update.
+type ResourceChange struct {
+	Action       string
+	LogicalId    string
+	ResourceType string
+	Replacement  string
+	Scope        []string
+}
+
+// IsDestructive returns true if the change removes or may replace the resource
+func (c ResourceChange) IsDestructive() bool {
+	return c.Action == ChangeActionRemove || c.Replacement == ReplacementTrue || c.Replacement == ReplacementConditional
+}
+
+// ChangeApprover is asked to approve the changes of a stack update before they are applied. changes is nil if the
+// deployer can't list them.
+type ChangeApprover func(stackName string, changes []ResourceChange) (bool, error)
+
+// StackSnapshot is the deployed template and params of a stack, captured before an update so it can be restored.
+// Capabilities and RoleArn are only set by deployers that need them to restore it.
+type StackSnapshot struct {
+	Name         string
+	TemplateBody string
+	Parameters   map[string]string
+	Capabilities []string
+	RoleArn      string
 }
 
 func GenerateStackConfig(name string, templateFile string, params map[string]string) StackConfig {
@@ -41,3 +103,34 @@ func GenerateStackConfig(name string, templateFile string, params map[string]str
 		TemplateFile: templateFile,
 	}
 }
+
+// StackRecord is the swiz-managed state of a stack for IaC tools that don't track environments themselves. Attributes
+// hold deployer specific values and OutputRefs the outputs that are looked up when requested.
+type StackRecord struct {
+	Name       string            `json:"name"`
+	EnvName    string            `json:"env_name"`
+	Template   string            `json:"template"`
+	Params     map[string]string `json:"params"`
+	Metadata   map[string]string `json:"metadata"`
+	Outputs    map[string]string `json:"outputs"`
+	OutputRefs map[string]string `json:"output_refs,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	State      State             `json:"state"`
+	Reason     string            `json:"reason"`
+	Updated    time.Time         `json:"updated"`
+}
+
+// ToStackInfo converts the record to the stack info returned by deployers
+func (r StackRecord) ToStackInfo() StackInfo {
+	return StackInfo{
+		Name:       r.Name,
+		NextAction: NextActionUpdate,
+		DeployStatus: DeployStatus{
+			Name:    r.Name,
+			State:   r.State,
+			Reason:  r.Reason,
+			Details: r.Template,
+		},
+		Resources: []string{},
+	}
+}
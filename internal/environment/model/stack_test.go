@@ -21,3 +21,28 @@ func TestStack_GenerateStackConfig(t *testing.T) {
 	assert.Equal(t, "{{blah}}", cfg.Parameters["blah"])
 	assert.Equal(t, "{{boo}}", cfg.Parameters["boo"])
 }
+
+func TestStack_StackRecordToStackInfo(t *testing.T) {
+	rec := StackRecord{
+		Name:     "dev-neato",
+		EnvName:  "dev",
+		Template: "file://./modules/neato",
+		State:    StateFailed,
+		Reason:   "apply failed",
+	}
+
+	info := rec.ToStackInfo()
+	assert.Equal(t, "dev-neato", info.Name)
+	assert.Equal(t, NextActionUpdate, info.NextAction)
+	assert.Equal(t, StateFailed, info.DeployStatus.State)
+	assert.Equal(t, "apply failed", info.DeployStatus.Reason)
+	assert.Equal(t, "file://./modules/neato", info.DeployStatus.Details)
+}
+
+func TestStack_ResourceChangeIsDestructive(t *testing.T) {
+	assert.False(t, ResourceChange{Action: "Add"}.IsDestructive())
+	assert.False(t, ResourceChange{Action: "Modify", Replacement: "False"}.IsDestructive())
+	assert.True(t, ResourceChange{Action: "Modify", Replacement: ReplacementTrue}.IsDestructive())
+	assert.True(t, ResourceChange{Action: "Modify", Replacement: ReplacementConditional}.IsDestructive())
+	assert.True(t, ResourceChange{Action: ChangeActionRemove}.IsDestructive())
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+)
+
+const (
+	RegionConcurrencyParallel   = "PARALLEL"
+	RegionConcurrencySequential = "SEQUENTIAL"
+)
+
+// StackSetConfig deploys a stack as a CloudFormation StackSet with an instance in each region of each account. Accounts
+// use the self-managed permission model and organizational units the service-managed one, which also deploys to
+// accounts that join the unit later.
+type StackSetConfig struct {
+	Accounts              []string            `yaml:"accounts,omitempty"`
+	OrganizationalUnits   []string            `yaml:"organizational_units,omitempty"`
+	Regions               []string            `yaml:"regions"`
+	AdministrationRoleArn string              `yaml:"administration_role_arn,omitempty"`
+	ExecutionRoleName     string              `yaml:"execution_role_name,omitempty"`
+	Preferences           StackSetPreferences `yaml:"preferences,omitempty"`
+}
+
+// StackSetPreferences are the operation preferences of a StackSet. A count and a percentage of the same setting can't
+// both be set.
+type StackSetPreferences struct {
+	FailureToleranceCount      *int   `yaml:"failure_tolerance_count,omitempty"`
+	FailureTolerancePercentage *int   `yaml:"failure_tolerance_percentage,omitempty"`
+	MaxConcurrentCount         *int   `yaml:"max_concurrent_count,omitempty"`
+	MaxConcurrentPercentage    *int   `yaml:"max_concurrent_percentage,omitempty"`
+	RegionConcurrency          string `yaml:"region_concurrency,omitempty"`
+}
+
+// IsServiceManaged returns true if the instances are deployed to organizational units
+func (c StackSetConfig) IsServiceManaged() bool {
+	return len(c.OrganizationalUnits) > 0
+}
+
+// Targets returns the organizational units or accounts the instances are deployed to
+func (c StackSetConfig) Targets() []string {
+	if c.IsServiceManaged() {
+		return c.OrganizationalUnits
+	}
+	return c.Accounts
+}
+
+func (c StackSetConfig) Validate() error {
+	if len(c.Regions) == 0 {
+		return fmt.Errorf("stack set needs at least one region")
+	}
+	if len(c.Accounts) == 0 && len(c.OrganizationalUnits) == 0 {
+		return fmt.Errorf("stack set needs accounts or organizational_units")
+	}
+	if len(c.Accounts) > 0 && len(c.OrganizationalUnits) > 0 {
+		return fmt.Errorf("stack set can use either accounts or organizational_units")
+	}
+	if c.IsServiceManaged() && (c.AdministrationRoleArn != "" || c.ExecutionRoleName != "") {
+		return fmt.Errorf("stack set roles only apply to accounts, organizational_units use service-managed roles")
+	}
+
+	p := c.Preferences
+	if p.FailureToleranceCount != nil && p.FailureTolerancePercentage != nil {
+		return fmt.Errorf("stack set can set either failure_tolerance_count or failure_tolerance_percentage")
+	}
+	if p.MaxConcurrentCount != nil && p.MaxConcurrentPercentage != nil {
+		return fmt.Errorf("stack set can set either max_concurrent_count or max_concurrent_percentage")
+	}
+	switch p.RegionConcurrency {
+	case "", RegionConcurrencyParallel, RegionConcurrencySequential:
+	default:
+		return fmt.Errorf("stack set region_concurrency must be %v or %v", RegionConcurrencyParallel,
+			RegionConcurrencySequential)
+	}
+
+	return nil
+}
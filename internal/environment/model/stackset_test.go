@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackSet_Validate(t *testing.T) {
+	one := 1
+	ten := 10
+
+	assert.NoError(t, StackSetConfig{Accounts: []string{"123456789012"}, Regions: []string{"us-east-1"}}.Validate())
+	assert.NoError(t, StackSetConfig{
+		OrganizationalUnits: []string{"ou-abcd-12345678"},
+		Regions:             []string{"us-east-1", "eu-west-1"},
+		Preferences: StackSetPreferences{
+			FailureToleranceCount:   &one,
+			MaxConcurrentPercentage: &ten,
+			RegionConcurrency:       RegionConcurrencyParallel,
+		},
+	}.Validate())
+
+	assert.Error(t, StackSetConfig{Accounts: []string{"123456789012"}}.Validate())
+	assert.Error(t, StackSetConfig{Regions: []string{"us-east-1"}}.Validate())
+	assert.Error(t, StackSetConfig{
+		Accounts:            []string{"123456789012"},
+		OrganizationalUnits: []string{"ou-abcd-12345678"},
+		Regions:             []string{"us-east-1"},
+	}.Validate())
+	assert.Error(t, StackSetConfig{
+		OrganizationalUnits: []string{"ou-abcd-12345678"},
+		Regions:             []string{"us-east-1"},
+		ExecutionRoleName:   "AWSCloudFormationStackSetExecutionRole",
+	}.Validate())
+	assert.Error(t, StackSetConfig{
+		Accounts:    []string{"123456789012"},
+		Regions:     []string{"us-east-1"},
+		Preferences: StackSetPreferences{FailureToleranceCount: &one, FailureTolerancePercentage: &ten},
+	}.Validate())
+	assert.Error(t, StackSetConfig{
+		Accounts:    []string{"123456789012"},
+		Regions:     []string{"us-east-1"},
+		Preferences: StackSetPreferences{MaxConcurrentCount: &one, MaxConcurrentPercentage: &ten},
+	}.Validate())
+	assert.Error(t, StackSetConfig{
+		Accounts:    []string{"123456789012"},
+		Regions:     []string{"us-east-1"},
+		Preferences: StackSetPreferences{RegionConcurrency: "SIDEWAYS"},
+	}.Validate())
+}
+
+func TestStackSet_Targets(t *testing.T) {
+	accounts := StackSetConfig{Accounts: []string{"123456789012"}}
+	assert.False(t, accounts.IsServiceManaged())
+	assert.Equal(t, []string{"123456789012"}, accounts.Targets())
+
+	ous := StackSetConfig{OrganizationalUnits: []string{"ou-abcd-12345678"}}
+	assert.True(t, ous.IsServiceManaged())
+	assert.Equal(t, []string{"ou-abcd-12345678"}, ous.Targets())
+}
@@ -0,0 +1,42 @@
+package environment
+
+import (
+	"time"
+
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+// DeployOpts are the options for deploying an environment. Options that are also part of the enclave env_behavior can
+// be overridden in config. Approve is asked to approve each stack update before it is applied, nil applies updates
+// without review.
+type DeployOpts struct {
+	DeployAll   bool
+	Stacks      []string
+	DryRun      bool
+	NoUpdate    bool
+	WithDeps    bool
+	Downstream  bool
+	MaxParallel int
+	Rollback    bool
+	Resume      bool
+	Timeout     time.Duration
+	Approve     model.ChangeApprover
+}
+
+// DeleteOpts are the options for deleting an environment. Options that are also part of the enclave env_behavior can
+// be overridden in config.
+type DeleteOpts struct {
+	DryRun         bool
+	NoOrphanDelete bool
+	FastDelete     bool
+	MaxParallel    int
+	Timeout        time.Duration
+}
+
+// AdoptOpts are the options for adopting stacks deployed outside of swiz into an environment. Stacks is the deployed
+// name of each stack to adopt by stack name. Force adopts stacks without checking them against their template.
+type AdoptOpts struct {
+	Stacks map[string]string
+	DryRun bool
+	Force  bool
+}
@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+// awsCredentials passes the credentials of a provider to the tools swiz runs. A profile is passed by name. A provider
+// that assumes a role gets temporary credentials instead, which are cached until they are about to expire.
+type awsCredentials struct {
+	provider *model.EncProvider
+	cfg      *aws.Config
+	mu       sync.Mutex
+}
+
+func newAwsCredentials(provider *model.EncProvider) *awsCredentials {
+	return &awsCredentials{
+		provider: provider,
+	}
+}
+
+// Env returns the AWS environment variables of the provider, or nothing if it isn't an AWS provider
+func (c *awsCredentials) Env(ctx context.Context) (map[string]string, error) {
+	if c.provider.ProviderId != model.EncProvAws {
+		return map[string]string{}, nil
+	}
+
+	if c.provider.RoleArn == "" {
+		return map[string]string{
+			"AWS_PROFILE": c.provider.GetProfile(),
+			"AWS_REGION":  c.provider.Region,
+		}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg == nil {
+		cfg, err := c.provider.ToAwsConfig().GenerateConfig()
+		if err != nil {
+			return nil, fmt.Errorf("provider %v: %w", c.provider.Name, err)
+		}
+		c.cfg = &cfg
+	}
+
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to assume role %v: %w", c.provider.RoleArn, err)
+	}
+
+	return map[string]string{
+		"AWS_ACCESS_KEY_ID":     creds.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY": creds.SecretAccessKey,
+		"AWS_SESSION_TOKEN":     creds.SessionToken,
+		"AWS_REGION":            c.provider.Region,
+	}, nil
+}
@@ -0,0 +1,229 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+var DefaultBuildLocation = "file://~/.swiz/build"
+
+// Directories that hold build output or dependencies are not part of the source hash
+var buildSkipDirs = map[string]bool{
+	".git":         true,
+	".aws-sam":     true,
+	"cdk.out":      true,
+	"node_modules": true,
+}
+
+// BuildRepo runs the synth step of stacks that are built from CDK, SAM or another tool. Each result is cached by a hash
+// of the source directory, the build config and the params, under <location>/<stack name>/<hash>.
+type BuildRepo struct {
+	location string
+	exec     execwrap.Execer
+	openUrl  fileutil.FileUrlHelper
+}
+
+func NewBuildRepo(location string) *BuildRepo {
+	return &BuildRepo{
+		location: location,
+		exec:     execwrap.NewExec(),
+		openUrl:  fileutil.NewFileUrlHelper(),
+	}
+}
+
+// Synth builds the stack template unless the same source was already built with the same params, and returns a file URL
+// to the template
+func (r *BuildRepo) Synth(ctx context.Context, stackName string, build *model.StackBuild,
+	params map[string]string) (string, error) {
+	sourceDir, err := r.openUrl.GetPathFromUrl(build.SourceDir, true)
+	if err != nil {
+		return "", err
+	}
+	sourceDir = filepath.Clean(sourceDir)
+
+	hash, err := r.hash(sourceDir, build, params)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash source directory: %w", err)
+	}
+
+	buildDir, err := r.openUrl.GetPathFromUrl(fmt.Sprintf("%v/%v/%v", r.location, stackName, hash), true)
+	if err != nil {
+		return "", err
+	}
+
+	template := filepath.Join(buildDir, build.TemplateName())
+	if _, err = os.Stat(template); err == nil {
+		// Already built
+		return "file://" + template, nil
+	}
+
+	err = os.MkdirAll(buildDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = r.run(ctx, sourceDir, buildDir, build, params)
+	if err == nil {
+		_, err = os.Stat(template)
+	}
+	if err != nil {
+		// Don't leave a partial build for the next run to pick up
+		_ = os.RemoveAll(buildDir)
+		return "", err
+	}
+
+	return "file://" + template, nil
+}
+
+// run runs the synth step with the params passed as context. Output from cdk and sam goes straight to the build dir,
+// the template from a command is copied in.
+func (r *BuildRepo) run(ctx context.Context, sourceDir string, buildDir string, build *model.StackBuild,
+	params map[string]string) error {
+	keys := r.sortedKeys(params)
+
+	cmd := execwrap.Cmd{
+		Dir: sourceDir,
+	}
+	switch build.Type {
+	case model.BuildTypeCdk:
+		cmd.Name = "cdk"
+		cmd.Args = []string{"synth", "--quiet", "--output", buildDir}
+		if build.Target != "" {
+			cmd.Args = append(cmd.Args, build.Target)
+		}
+		for _, k := range keys {
+			cmd.Args = append(cmd.Args, "--context", fmt.Sprintf("%v=%v", k, params[k]))
+		}
+	case model.BuildTypeSam:
+		cmd.Name = "sam"
+		cmd.Args = []string{"build", "--build-dir", buildDir}
+		if build.Target != "" {
+			cmd.Args = append(cmd.Args, "--template-file", build.Target)
+		}
+		if len(keys) > 0 {
+			overrides := []string{}
+			for _, k := range keys {
+				overrides = append(overrides, fmt.Sprintf("%v=%q", k, params[k]))
+			}
+			cmd.Args = append(cmd.Args, "--parameter-overrides", strings.Join(overrides, " "))
+		}
+	default:
+		cmd.Name = "sh"
+		cmd.Args = []string{"-c", build.Command}
+		cmd.Env = map[string]string{
+			"SWIZ_BUILD_DIR": buildDir,
+		}
+		for _, k := range keys {
+			cmd.Env["SWIZ_PARAM_"+k] = params[k]
+		}
+	}
+
+	_, err := r.exec.Run(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("build failed: %w", err)
+	}
+
+	if build.Type == model.BuildTypeCommand {
+		output := build.Output
+		if !filepath.IsAbs(output) {
+			output = filepath.Join(sourceDir, output)
+		}
+		return r.copyFile(output, filepath.Join(buildDir, build.TemplateName()))
+	}
+
+	return nil
+}
+
+// hash returns a hash of every file in the source directory along with the build config and params. The output of a
+// command build, or the directory it is written to, is left out so a build doesn't change its own hash.
+func (r *BuildRepo) hash(sourceDir string, build *model.StackBuild, params map[string]string) (string, error) {
+	h := sha256.New()
+
+	skipPath := ""
+	if build.Type == model.BuildTypeCommand {
+		skipPath = build.Output
+		if !filepath.IsAbs(skipPath) {
+			skipPath = filepath.Join(sourceDir, skipPath)
+		}
+		if filepath.Dir(skipPath) != sourceDir {
+			skipPath = filepath.Dir(skipPath)
+		}
+	}
+
+	buildCfg, err := json.Marshal(build)
+	if err != nil {
+		return "", err
+	}
+	h.Write(buildCfg)
+
+	for _, k := range r.sortedKeys(params) {
+		fmt.Fprintf(h, "\x00%v=%v", k, params[k])
+	}
+
+	err = filepath.WalkDir(sourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if (buildSkipDirs[d.Name()] || path == skipPath) && path != sourceDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || path == skipPath {
+			return nil
+		}
+
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "\x00%v\x00", rel)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+func (r *BuildRepo) copyFile(src string, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("unable to read build output: %w", err)
+	}
+
+	return os.WriteFile(dst, data, 0644)
+}
+
+func (r *BuildRepo) sortedKeys(params map[string]string) []string {
+	keys := []string{}
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,187 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+func newTestBuildRepo(t *testing.T, exec execwrap.Execer) *BuildRepo {
+	return &BuildRepo{
+		location: "file://" + t.TempDir(),
+		exec:     exec,
+		openUrl:  fileutil.NewFileUrlHelper(),
+	}
+}
+
+// newTestSourceDir returns a source directory with an app file and a node_modules dir
+func newTestSourceDir(t *testing.T) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "app.ts"), []byte("new Stack()"), 0600))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "node_modules", "dep"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "node_modules", "dep", "index.js"), []byte("v1"), 0600))
+	return dir
+}
+
+// synthTemplate answers a build by writing the template where the tool would
+func synthTemplate(cmd execwrap.Cmd) ([]byte, error) {
+	switch cmd.Name {
+	case "cdk":
+		return nil, os.WriteFile(filepath.Join(cmd.Args[3], cmd.Args[4]+".template.json"), []byte("{}"), 0600)
+	case "sam":
+		return nil, os.WriteFile(filepath.Join(cmd.Args[2], "template.yaml"), []byte("{}"), 0600)
+	default:
+		return nil, os.WriteFile(filepath.Join(cmd.Dir, "out", "template.yaml"), []byte("{}"), 0600)
+	}
+}
+
+func TestBuildRepo_Synth(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    model.StackBuild
+		wantName string
+		wantArgs func(buildDir string) []string
+		wantEnv  map[string]string
+	}{
+		{
+			name:     "cdk",
+			build:    model.StackBuild{Type: model.BuildTypeCdk, Target: "ApiStack"},
+			wantName: "cdk",
+			wantArgs: func(buildDir string) []string {
+				return []string{"synth", "--quiet", "--output", buildDir, "ApiStack", "--context", "Env=dev",
+					"--context", "Size=a b"}
+			},
+		},
+		{
+			name:     "sam",
+			build:    model.StackBuild{Type: model.BuildTypeSam, Target: "sam.yaml"},
+			wantName: "sam",
+			wantArgs: func(buildDir string) []string {
+				return []string{"build", "--build-dir", buildDir, "--template-file", "sam.yaml",
+					"--parameter-overrides", `Env="dev" Size="a b"`}
+			},
+		},
+		{
+			name:     "command",
+			build:    model.StackBuild{Type: model.BuildTypeCommand, Command: "make template", Output: "out/template.yaml"},
+			wantName: "sh",
+			wantArgs: func(buildDir string) []string {
+				return []string{"-c", "make template"}
+			},
+			wantEnv: map[string]string{
+				"SWIZ_PARAM_Env":  "dev",
+				"SWIZ_PARAM_Size": "a b",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := &fakeExec{respond: synthTemplate}
+			r := newTestBuildRepo(t, exec)
+			sourceDir := newTestSourceDir(t)
+			assert.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "out"), 0755))
+			tt.build.SourceDir = "file://" + sourceDir
+			params := map[string]string{"Size": "a b", "Env": "dev"}
+
+			template, err := r.Synth(context.Background(), "dev-api", &tt.build, params)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(template, "file://"))
+			assert.FileExists(t, strings.TrimPrefix(template, "file://"))
+
+			buildDir := filepath.Dir(strings.TrimPrefix(template, "file://"))
+			assert.Len(t, exec.cmds, 1)
+			assert.Equal(t, tt.wantName, exec.cmds[0].Name)
+			assert.Equal(t, sourceDir, exec.cmds[0].Dir)
+			assert.Equal(t, tt.wantArgs(buildDir), exec.cmds[0].Args)
+			for k, v := range tt.wantEnv {
+				assert.Equal(t, v, exec.cmds[0].Env[k])
+			}
+
+			// The same source and params are built once
+			cached, err := r.Synth(context.Background(), "dev-api", &tt.build, params)
+			assert.NoError(t, err)
+			assert.Equal(t, template, cached)
+			assert.Len(t, exec.cmds, 1)
+		})
+	}
+}
+
+func TestBuildRepo_SynthFailure(t *testing.T) {
+	t.Run("failed build leaves nothing behind", func(t *testing.T) {
+		r := newTestBuildRepo(t, &fakeExec{
+			respond: func(cmd execwrap.Cmd) ([]byte, error) {
+				return nil, errors.New("cdk synth failed: exit status 1")
+			},
+		})
+
+		_, err := r.Synth(context.Background(), "dev-api", &model.StackBuild{
+			Type:      model.BuildTypeCdk,
+			SourceDir: "file://" + newTestSourceDir(t),
+			Target:    "ApiStack",
+		}, nil)
+		assert.ErrorContains(t, err, "build failed")
+
+		buildDir, err := r.openUrl.GetPathFromUrl(r.location+"/dev-api", true)
+		assert.NoError(t, err)
+		entries, err := os.ReadDir(buildDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("build without a template", func(t *testing.T) {
+		r := newTestBuildRepo(t, &fakeExec{})
+
+		_, err := r.Synth(context.Background(), "dev-api", &model.StackBuild{
+			Type:      model.BuildTypeSam,
+			SourceDir: "file://" + newTestSourceDir(t),
+		}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestBuildRepo_Hash(t *testing.T) {
+	r := newTestBuildRepo(t, nil)
+	sourceDir := newTestSourceDir(t)
+	build := &model.StackBuild{Type: model.BuildTypeCommand, Command: "make", Output: "out/template.yaml"}
+	params := map[string]string{"Env": "dev"}
+
+	base, err := r.hash(sourceDir, build, params)
+	assert.NoError(t, err)
+
+	same := func(name string) {
+		got, err := r.hash(sourceDir, build, params)
+		assert.NoError(t, err)
+		assert.Equal(t, base, got, name)
+	}
+	changed := func(name string, got string, err error) {
+		assert.NoError(t, err)
+		assert.NotEqual(t, base, got, name)
+	}
+
+	// Dependencies and the build output don't change the hash
+	assert.NoError(t, os.WriteFile(filepath.Join(sourceDir, "node_modules", "dep", "index.js"), []byte("v2"), 0600))
+	same("node_modules")
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "out"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(sourceDir, "out", "template.yaml"), []byte("{}"), 0600))
+	same("build output")
+
+	got, err := r.hash(sourceDir, build, map[string]string{"Env": "prod"})
+	changed("params", got, err)
+
+	got, err = r.hash(sourceDir, &model.StackBuild{Type: model.BuildTypeCommand, Command: "make all",
+		Output: "out/template.yaml"}, params)
+	changed("build config", got, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(sourceDir, "app.ts"), []byte("new Stack(2)"), 0600))
+	got, err = r.hash(sourceDir, build, params)
+	changed("source", got, err)
+}
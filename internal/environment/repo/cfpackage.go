@@ -0,0 +1,458 @@
+package repo
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/swizzleio/swiz/pkg/drivers/awswrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+	"gopkg.in/yaml.v3"
+)
+
+// cfTemplateBodyLimit is the largest template CloudFormation accepts as a TemplateBody
+const cfTemplateBodyLimit = 51200
+
+// cfArtifactPrefix is the key prefix of everything swiz uploads to the artifact bucket
+const cfArtifactPrefix = "swiz/"
+
+// cfZipTime is the modified time of every zip entry, so zipping the same directory always gives the same key
+var cfZipTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type cfLocFormat int
+
+const (
+	// cfLocS3Uri writes the location as s3://bucket/key
+	cfLocS3Uri cfLocFormat = iota
+	// cfLocS3BucketKey writes the location as a map with S3Bucket and S3Key
+	cfLocS3BucketKey
+	// cfLocBucketKey writes the location as a map with Bucket and Key
+	cfLocBucketKey
+	// cfLocTemplateUrl packages the nested template and writes its https URL
+	cfLocTemplateUrl
+)
+
+// cfPackagedProp is a resource property that can point at a local file or directory. Zip properties take a zip of a
+// directory or file, the others take the file as is.
+type cfPackagedProp struct {
+	format cfLocFormat
+	zip    bool
+}
+
+// cfPackagedProps are the properties packaged for each resource type, these are the ones aws cloudformation package
+// handles that are set directly on the resource
+var cfPackagedProps = map[string]map[string]cfPackagedProp{
+	"AWS::CloudFormation::Stack":                {"TemplateURL": {format: cfLocTemplateUrl}},
+	"AWS::Serverless::Application":              {"Location": {format: cfLocTemplateUrl}},
+	"AWS::Lambda::Function":                     {"Code": {format: cfLocS3BucketKey, zip: true}},
+	"AWS::Lambda::LayerVersion":                 {"Content": {format: cfLocS3BucketKey, zip: true}},
+	"AWS::Serverless::Function":                 {"CodeUri": {format: cfLocS3Uri, zip: true}},
+	"AWS::Serverless::LayerVersion":             {"ContentUri": {format: cfLocS3Uri, zip: true}},
+	"AWS::Serverless::Api":                      {"DefinitionUri": {format: cfLocS3Uri}},
+	"AWS::Serverless::HttpApi":                  {"DefinitionUri": {format: cfLocS3Uri}},
+	"AWS::Serverless::StateMachine":             {"DefinitionUri": {format: cfLocS3Uri}},
+	"AWS::ElasticBeanstalk::ApplicationVersion": {"SourceBundle": {format: cfLocS3BucketKey, zip: true}},
+	"AWS::ApiGateway::RestApi":                  {"BodyS3Location": {format: cfLocBucketKey}},
+	"AWS::StepFunctions::StateMachine":          {"DefinitionS3Location": {format: cfLocBucketKey}},
+	"AWS::AppSync::GraphQLSchema":               {"DefinitionS3Location": {format: cfLocS3Uri}},
+	"AWS::AppSync::Resolver": {
+		"RequestMappingTemplateS3Location":  {format: cfLocS3Uri},
+		"ResponseMappingTemplateS3Location": {format: cfLocS3Uri},
+	},
+}
+
+// cfPackager uploads templates and the local files they refer to into the artifact bucket, like aws cloudformation
+// package does. Every upload is keyed by a hash of its content so unchanged files are not uploaded again.
+type cfPackager struct {
+	client   awswrap.S3er
+	bucket   string
+	region   string
+	openUrl  fileutil.FileUrlHelper
+	mu       sync.Mutex
+	uploaded map[string]bool
+}
+
+func newCfPackager(client awswrap.S3er, bucket string, region string) *cfPackager {
+	return &cfPackager{
+		client:   client,
+		bucket:   bucket,
+		region:   region,
+		openUrl:  fileutil.NewFileUrlHelper(),
+		uploaded: map[string]bool{},
+	}
+}
+
+// packageTemplate uploads the local files the template refers to and returns the template pointing at the uploads.
+// templatePath is where the template was read from, relative paths in the template are relative to its directory.
+func (p *cfPackager) packageTemplate(ctx context.Context, templatePath string, body []byte) ([]byte, error) {
+	return p.packageNested(ctx, templatePath, body, map[string]bool{})
+}
+
+func (p *cfPackager) packageNested(ctx context.Context, templatePath string, body []byte,
+	visiting map[string]bool) ([]byte, error) {
+	templatePath = filepath.Clean(templatePath)
+	if visiting[templatePath] {
+		return nil, fmt.Errorf("template %v includes itself", templatePath)
+	}
+	visiting[templatePath] = true
+	defer delete(visiting, templatePath)
+
+	// Nodes are used so CloudFormation short form tags such as !GetAtt are kept as they are
+	doc := yaml.Node{}
+	err := yaml.Unmarshal(body, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template %v: %w", templatePath, err)
+	}
+	if len(doc.Content) == 0 {
+		return body, nil
+	}
+
+	baseDir := filepath.Dir(templatePath)
+	changed := false
+
+	resources := p.mapValue(doc.Content[0], "Resources")
+	if resources != nil && resources.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(resources.Content); i += 2 {
+			resource := resources.Content[i+1]
+			props := p.mapValue(resource, "Properties")
+			typeNode := p.mapValue(resource, "Type")
+			if props == nil || typeNode == nil {
+				continue
+			}
+
+			for propName, prop := range cfPackagedProps[typeNode.Value] {
+				propNode := p.mapValue(props, propName)
+				localPath, ok := p.localPath(baseDir, propNode)
+				if !ok {
+					continue
+				}
+
+				err = p.packageProp(ctx, propNode, localPath, prop, visiting)
+				if err != nil {
+					return nil, fmt.Errorf("resource %v property %v: %w", resources.Content[i].Value, propName, err)
+				}
+				changed = true
+			}
+		}
+	}
+
+	includeChanged, err := p.packageIncludes(ctx, baseDir, doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed && !includeChanged {
+		return body, nil
+	}
+
+	return yaml.Marshal(&doc)
+}
+
+// packageIncludes uploads the local files of AWS::Include transforms anywhere in the template
+func (p *cfPackager) packageIncludes(ctx context.Context, baseDir string, node *yaml.Node) (bool, error) {
+	changed := false
+
+	var transform *yaml.Node
+	if node.Kind == yaml.MappingNode && node.Tag == "!Transform" {
+		transform = node
+	}
+	if node.Kind == yaml.MappingNode {
+		if v := p.mapValue(node, "Fn::Transform"); v != nil && v.Kind == yaml.MappingNode {
+			transform = v
+		}
+	}
+
+	if transform != nil {
+		name := p.mapValue(transform, "Name")
+		location := p.mapValue(p.mapValue(transform, "Parameters"), "Location")
+		if name != nil && name.Value == "AWS::Include" {
+			if localPath, ok := p.localPath(baseDir, location); ok {
+				err := p.packageProp(ctx, location, localPath, cfPackagedProp{format: cfLocS3Uri}, nil)
+				if err != nil {
+					return false, fmt.Errorf("include %v: %w", location.Value, err)
+				}
+				changed = true
+			}
+		}
+	}
+
+	for _, child := range node.Content {
+		childChanged, err := p.packageIncludes(ctx, baseDir, child)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || childChanged
+	}
+
+	return changed, nil
+}
+
+// packageProp uploads the file or directory at localPath and replaces node with its location
+func (p *cfPackager) packageProp(ctx context.Context, node *yaml.Node, localPath string, prop cfPackagedProp,
+	visiting map[string]bool) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	ext := filepath.Ext(localPath)
+	switch {
+	case info.IsDir() && prop.zip:
+		data, err = p.zipDir(localPath)
+		ext = ".zip"
+	case info.IsDir():
+		return fmt.Errorf("%v is a directory", localPath)
+	case prop.zip && ext != ".zip" && ext != ".jar":
+		data, err = p.zipFile(localPath)
+		ext = ".zip"
+	default:
+		data, err = os.ReadFile(localPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if prop.format == cfLocTemplateUrl {
+		data, err = p.packageNested(ctx, localPath, data, visiting)
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := p.upload(ctx, data, ext)
+	if err != nil {
+		return err
+	}
+
+	switch prop.format {
+	case cfLocS3BucketKey:
+		p.setMap(node, "S3Bucket", p.bucket, "S3Key", key)
+	case cfLocBucketKey:
+		p.setMap(node, "Bucket", p.bucket, "Key", key)
+	case cfLocTemplateUrl:
+		p.setScalar(node, p.objectUrl(key))
+	default:
+		p.setScalar(node, fmt.Sprintf("s3://%v/%v", p.bucket, key))
+	}
+
+	return nil
+}
+
+// uploadTemplate uploads a template that is too large to pass as a body and returns its URL
+func (p *cfPackager) uploadTemplate(ctx context.Context, body []byte) (string, error) {
+	key, err := p.upload(ctx, body, ".template")
+	if err != nil {
+		return "", err
+	}
+
+	return p.objectUrl(key), nil
+}
+
+// upload puts data in the bucket under a key made from its hash, unless it's already there
+func (p *cfPackager) upload(ctx context.Context, data []byte, ext string) (string, error) {
+	sum := sha256.Sum256(data)
+	key := cfArtifactPrefix + hex.EncodeToString(sum[:]) + ext
+	if p.isUploaded(key) {
+		return key, nil
+	}
+
+	// Without s3:ListBucket a missing object is reported as forbidden, so any error falls through to the upload
+	_, err := p.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		_, err = p.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(p.bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(data),
+		})
+		if err != nil {
+			return "", fmt.Errorf("unable to upload %v to bucket %v: %w", key, p.bucket, err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.uploaded[key] = true
+	return key, nil
+}
+
+// isUploaded returns true if key was uploaded by this packager. The packager is shared by the stacks of a deployer,
+// which are deployed in parallel.
+func (p *cfPackager) isUploaded(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.uploaded[key]
+}
+
+func (p *cfPackager) objectUrl(key string) string {
+	return fmt.Sprintf("https://%v.s3.%v.amazonaws.com/%v", p.bucket, p.region, key)
+}
+
+// localPath returns the path of a property that refers to a local file. Intrinsic functions, S3 and http locations are
+// left alone.
+func (p *cfPackager) localPath(baseDir string, node *yaml.Node) (string, bool) {
+	if node == nil || node.Kind != yaml.ScalarNode || node.Tag != "!!str" || node.Value == "" {
+		return "", false
+	}
+
+	scheme, err := p.openUrl.GetScheme(node.Value)
+	if err != nil {
+		return "", false
+	}
+
+	switch scheme {
+	case "":
+		if filepath.IsAbs(node.Value) {
+			return node.Value, true
+		}
+		return filepath.Join(baseDir, node.Value), true
+	case "file":
+		localPath, err := p.openUrl.GetPathFromUrl(node.Value, true)
+		return localPath, err == nil
+	}
+
+	return "", false
+}
+
+// zipDir zips every file in the directory. Entries are written in a fixed order with a fixed time so the same content
+// always gives the same zip.
+func (p *cfPackager) zipDir(dir string) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		return p.addZipEntry(w, path, filepath.ToSlash(rel))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// zipFile zips a single file, such as a Lambda handler
+func (p *cfPackager) zipFile(path string) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+
+	err := p.addZipEntry(w, path, filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (p *cfPackager) addZipEntry(w *zip.Writer, path string, name string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	header.Modified = cfZipTime
+
+	entry, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(entry, f)
+	return err
+}
+
+// mapValue returns the value of key in a mapping node, or nil if it isn't there
+func (p *cfPackager) mapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func (p *cfPackager) setScalar(node *yaml.Node, value string) {
+	*node = yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: value,
+	}
+}
+
+// setMap replaces node with a mapping of the key value pairs in kv
+func (p *cfPackager) setMap(node *yaml.Node, kv ...string) {
+	content := []*yaml.Node{}
+	for _, s := range kv {
+		content = append(content, &yaml.Node{
+			Kind:  yaml.ScalarNode,
+			Tag:   "!!str",
+			Value: s,
+		})
+	}
+
+	*node = yaml.Node{
+		Kind:    yaml.MappingNode,
+		Tag:     "!!map",
+		Content: content,
+	}
+}
@@ -0,0 +1,280 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeS3 keeps uploaded objects in memory and records the keys that were put
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    []string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}}
+}
+
+func (s *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objects[aws.ToString(params.Key)]; !ok {
+		return nil, errors.New("forbidden")
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (s *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput,
+	optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[aws.ToString(params.Key)] = data
+	s.puts = append(s.puts, aws.ToString(params.Key))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func writeTestFile(t *testing.T, path string, body string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(body), 0600))
+}
+
+func contentKey(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return cfArtifactPrefix + hex.EncodeToString(sum[:]) + ext
+}
+
+const cfPackageTemplate = `Resources:
+  Fn:
+    Type: AWS::Lambda::Function
+    Properties:
+      Code: ./src
+      Role: !GetAtt Role.Arn
+  SamFn:
+    Type: AWS::Serverless::Function
+    Properties:
+      CodeUri: src
+  RemoteFn:
+    Type: AWS::Serverless::Function
+    Properties:
+      CodeUri: s3://other-bucket/code.zip
+  Nested:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: sub/nested.yaml
+  Api:
+    Type: AWS::ApiGateway::RestApi
+    Properties:
+      BodyS3Location: api.yaml
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      Fn::Transform:
+        Name: AWS::Include
+        Parameters:
+          Location: file://INCLUDE
+`
+
+const cfNestedTemplate = `Resources:
+  Fn:
+    Type: AWS::Lambda::Function
+    Properties:
+      Code: ../src
+`
+
+func TestCfPackager_PackageTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "src", "index.js"), "exports.handler = () => {}")
+	writeTestFile(t, filepath.Join(dir, "src", "lib", "util.js"), "module.exports = {}")
+	writeTestFile(t, filepath.Join(dir, "sub", "nested.yaml"), cfNestedTemplate)
+	writeTestFile(t, filepath.Join(dir, "api.yaml"), "openapi: 3.0.0")
+	writeTestFile(t, filepath.Join(dir, "include", "queue.yaml"), "VisibilityTimeout: 30")
+	templatePath := filepath.Join(dir, "template.yaml")
+	body := []byte(strings.Replace(cfPackageTemplate, "INCLUDE", filepath.Join(dir, "include", "queue.yaml"), 1))
+
+	client := newFakeS3()
+	p := newCfPackager(client, "artifacts", "us-east-1")
+	packaged, err := p.packageTemplate(context.Background(), templatePath, body)
+	assert.NoError(t, err)
+
+	srcZip, err := p.zipDir(filepath.Join(dir, "src"))
+	assert.NoError(t, err)
+	srcKey := contentKey(srcZip, ".zip")
+	apiKey := contentKey([]byte("openapi: 3.0.0"), ".yaml")
+	includeKey := contentKey([]byte("VisibilityTimeout: 30"), ".yaml")
+
+	// The nested template is packaged before it is uploaded
+	nestedKey := ""
+	for _, key := range client.puts {
+		if strings.HasSuffix(key, ".yaml") && key != apiKey && key != includeKey {
+			nestedKey = key
+		}
+	}
+	nested := map[string]interface{}{}
+	assert.NoError(t, yaml.Unmarshal(client.objects[nestedKey], &nested))
+	assert.Equal(t, map[string]interface{}{"S3Bucket": "artifacts", "S3Key": srcKey},
+		nested["Resources"].(map[string]interface{})["Fn"].(map[string]interface{})["Properties"].(map[string]interface{})["Code"])
+
+	// The same directory is uploaded once, even when it's referred to from a nested template
+	assert.ElementsMatch(t, []string{srcKey, nestedKey, apiKey, includeKey}, client.puts)
+
+	tmpl := map[string]interface{}{}
+	assert.NoError(t, yaml.Unmarshal(packaged, &tmpl))
+	props := func(name string) map[string]interface{} {
+		return tmpl["Resources"].(map[string]interface{})[name].(map[string]interface{})["Properties"].(map[string]interface{})
+	}
+	assert.Equal(t, map[string]interface{}{"S3Bucket": "artifacts", "S3Key": srcKey}, props("Fn")["Code"])
+	assert.Equal(t, "s3://artifacts/"+srcKey, props("SamFn")["CodeUri"])
+	assert.Equal(t, "s3://other-bucket/code.zip", props("RemoteFn")["CodeUri"])
+	assert.Equal(t, "https://artifacts.s3.us-east-1.amazonaws.com/"+nestedKey, props("Nested")["TemplateURL"])
+	assert.Equal(t, map[string]interface{}{"Bucket": "artifacts", "Key": apiKey}, props("Api")["BodyS3Location"])
+	assert.Equal(t, "s3://artifacts/"+includeKey,
+		props("Queue")["Fn::Transform"].(map[string]interface{})["Parameters"].(map[string]interface{})["Location"])
+
+	// Short form intrinsic functions are kept
+	assert.Contains(t, string(packaged), "!GetAtt Role.Arn")
+
+	// Packaging again with nothing changed finds everything already in the bucket
+	again, err := newCfPackager(client, "artifacts", "us-east-1").packageTemplate(context.Background(), templatePath, body)
+	assert.NoError(t, err)
+	assert.Equal(t, packaged, again)
+	assert.Len(t, client.puts, 4)
+
+	// Changing the code changes its key
+	writeTestFile(t, filepath.Join(dir, "src", "index.js"), "exports.handler = async () => {}")
+	_, err = newCfPackager(client, "artifacts", "us-east-1").packageTemplate(context.Background(), templatePath, body)
+	assert.NoError(t, err)
+	assert.Len(t, client.puts, 6)
+	assert.NotContains(t, client.puts[4:], srcKey)
+}
+
+func TestCfPackager_PackageTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "template includes itself",
+			files: map[string]string{
+				"template.yaml": "Resources:\n  Nested:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: nested.yaml\n",
+				"nested.yaml":   "Resources:\n  Loop:\n    Type: AWS::CloudFormation::Stack\n    Properties:\n      TemplateURL: ./template.yaml\n",
+			},
+			wantErr: "includes itself",
+		},
+		{
+			name: "missing local file",
+			files: map[string]string{
+				"template.yaml": "Resources:\n  Fn:\n    Type: AWS::Lambda::Function\n    Properties:\n      Code: ./missing\n",
+			},
+			wantErr: "resource Fn property Code",
+		},
+		{
+			name: "directory where a file is expected",
+			files: map[string]string{
+				"template.yaml": "Resources:\n  Api:\n    Type: AWS::ApiGateway::RestApi\n    Properties:\n      BodyS3Location: ./api\n",
+				"api/spec.yaml": "openapi: 3.0.0",
+			},
+			wantErr: "is a directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, body := range tt.files {
+				writeTestFile(t, filepath.Join(dir, name), body)
+			}
+
+			p := newCfPackager(newFakeS3(), "artifacts", "us-east-1")
+			_, err := p.packageTemplate(context.Background(), filepath.Join(dir, "template.yaml"),
+				[]byte(tt.files["template.yaml"]))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCfPackager_Unchanged(t *testing.T) {
+	client := newFakeS3()
+	p := newCfPackager(client, "artifacts", "us-east-1")
+
+	// Nothing local to upload leaves the template exactly as it was written
+	body := []byte("Resources:\n  Fn:\n    Type: AWS::Lambda::Function\n    Properties:\n      Code: {S3Bucket: b, S3Key: k}   # remote\n" +
+		"      Role: !GetAtt Role.Arn\n")
+	packaged, err := p.packageTemplate(context.Background(), filepath.Join(t.TempDir(), "template.yaml"), body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, packaged)
+	assert.Empty(t, client.puts)
+}
+
+func TestCfPackager_ZipDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "index.js"), "exports.handler = () => {}")
+	writeTestFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main")
+	p := newCfPackager(newFakeS3(), "artifacts", "us-east-1")
+
+	first, err := p.zipDir(dir)
+	assert.NoError(t, err)
+
+	// Touching a file or changing the git dir keeps the zip, and so its key, the same
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "index.js"), later, later))
+	writeTestFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/other")
+	second, err := p.zipDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	key, err := p.upload(context.Background(), first, ".zip")
+	assert.NoError(t, err)
+	assert.Equal(t, contentKey(first, ".zip"), key)
+}
+
+func TestCfPackager_ParallelUploads(t *testing.T) {
+	client := newFakeS3()
+	p := newCfPackager(client, "artifacts", "us-east-1")
+
+	// Stacks on the same deployer share the packager and deploy at the same time
+	wg := sync.WaitGroup{}
+	start := make(chan struct{})
+	urls := make([]string, 32)
+	for i := range urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			url, err := p.uploadTemplate(context.Background(), []byte(fmt.Sprintf("Resources: {} # %v", i%2)))
+			assert.NoError(t, err)
+			urls[i] = url
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Len(t, client.objects, 2)
+	for i, url := range urls {
+		assert.Equal(t, urls[i%2], url)
+	}
+}
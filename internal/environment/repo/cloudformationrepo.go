@@ -4,43 +4,76 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/smithy-go"
 	"github.com/swizzleio/swiz/internal/appconfig"
 	"github.com/swizzleio/swiz/internal/apperr"
 	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/backoff"
 	"github.com/swizzleio/swiz/pkg/drivers/awswrap"
 	"github.com/swizzleio/swiz/pkg/fileutil"
+	"gopkg.in/yaml.v3"
 )
 
-const CfPollTimeSec = 5
+// cfNoEchoValue is what CloudFormation returns in place of NoEcho parameter values
+const cfNoEchoValue = "****"
+
+// cfMaxFailedEventPages is how many pages of events are searched for the resource that made a stack fail
+const cfMaxFailedEventPages = 10
 
 type CloudFormationRepo struct {
 	client                     awswrap.Cloudformationer
 	openUrl                    fileutil.FileUrlHelper
 	newDescribeStacksPaginator awswrap.CfDescribeStacksPaginatorNewer
+	retry                      model.EncRetry
+	packager                   *cfPackager
+	cfConfig                   *model.CloudFormationConfig
+}
+
+func NewCloudFormationRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider) (IacDeployer, error) {
+	return newCloudFormationRepo(config, enclave, provider)
 }
 
-func NewCloudFormationRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider) IacDeployer {
-	cfg := provider.ToAwsConfig()
+func newCloudFormationRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider) (*CloudFormationRepo, error) {
+	cfg, err := provider.ToAwsConfig().GenerateConfig()
+	if err != nil {
+		return nil, fmt.Errorf("provider %v: %w", provider.Name, err)
+	}
+
+	// Templates are only packaged when there is a bucket to upload them to in the region
+	var packager *cfPackager
+	if bucket := enclave.GetArtifactBucket(provider.Name, provider.Region); bucket != "" {
+		s3Client := awswrap.NewRetryS3(s3.NewFromConfig(cfg, awswrap.NoS3SdkRetry), enclave.Retry.ToRetryOpts())
+		packager = newCfPackager(s3Client, bucket, cfg.Region)
+	}
 
 	return &CloudFormationRepo{
-		client:                     cloudformation.NewFromConfig(cfg.GenerateConfig()),
+		client:                     awswrap.NewRetryCloudformation(cloudformation.NewFromConfig(cfg, awswrap.NoSdkRetry), enclave.Retry.ToRetryOpts()),
 		openUrl:                    fileutil.NewFileUrlHelper(),
 		newDescribeStacksPaginator: cloudformation.NewDescribeStacksPaginator,
-	}
+		retry:                      enclave.Retry,
+		packager:                   packager,
+		cfConfig:                   enclave.CfConfig,
+	}, nil
 }
 
-func (r *CloudFormationRepo) CreateStack(ctx context.Context, name string, template string,
+func (r *CloudFormationRepo) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
 	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
 	var stackInfo *model.StackInfo
 
-	templateBody, templateUrl, err := r.templateOrUrl(template)
+	cfg, err := r.stackCfConfig(stack)
+	if err != nil {
+		return nil, err
+	}
+
+	templateBody, templateUrl, err := r.templateOrUrl(ctx, stack.TemplateFile)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get template body: %w", err)
 	}
@@ -62,17 +95,35 @@ func (r *CloudFormationRepo) CreateStack(ctx context.Context, name string, templ
 		cfParams := r.generateParams(params, templateResp.Parameters)
 		tags := r.generateTags(metadata)
 
+		var policyBody, policyUrl *string
+		policyBody, policyUrl, err = r.stackPolicy(cfg.StackPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get stack policy: %w", err)
+		}
+
+		// CloudFormation takes either on failure or disable rollback
+		var disableRollback *bool
+		if cfg.IsRollbackDisabled() {
+			disableRollback = aws.Bool(true)
+		}
+
 		var resp *cloudformation.CreateStackOutput
 		resp, err = r.client.CreateStack(ctx, &cloudformation.CreateStackInput{
-			StackName:    &name,
-			TemplateURL:  templateUrl,
-			TemplateBody: templateBody,
-			Parameters:   cfParams,
-			Tags:         tags,
-			OnFailure:    types.OnFailureDelete,
-			Capabilities: []types.Capability{
-				types.CapabilityCapabilityNamedIam,
-			},
+			StackName:                   &name,
+			TemplateURL:                 templateUrl,
+			TemplateBody:                templateBody,
+			Parameters:                  cfParams,
+			Tags:                        tags,
+			OnFailure:                   types.OnFailure(cfg.GetOnFailure()),
+			DisableRollback:             disableRollback,
+			TimeoutInMinutes:            r.timeoutInMinutes(stack.Timeout),
+			Capabilities:                r.capabilities(cfg.GetCapabilities()),
+			RoleARN:                     r.strOrNil(cfg.RoleArn),
+			StackPolicyBody:             policyBody,
+			StackPolicyURL:              policyUrl,
+			EnableTerminationProtection: cfg.TerminationProtection,
+			NotificationARNs:            cfg.NotificationArns,
+			RollbackConfiguration:       r.rollbackConfig(cfg.RollbackTriggers),
 		})
 
 		if resp != nil {
@@ -136,15 +187,26 @@ func (r *CloudFormationRepo) DeleteStack(ctx context.Context, name string, dryRu
 	return stackInfo, nil
 }
 
-func (r *CloudFormationRepo) UpdateStack(ctx context.Context, name string, template string,
+func (r *CloudFormationRepo) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
 	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.updateStack(ctx, name, stack, params, metadata, dryRun, nil)
+}
 
-	// Get the current timestamp
-	t := time.Now()
-	timestamp := t.Format("20060102150405")
-	changeSetName := fmt.Sprintf("Swz-%s-%s", name, timestamp)
+// ReviewUpdateStack creates the change set of an update and only executes it once the changes are approved
+func (r *CloudFormationRepo) ReviewUpdateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, approve model.ChangeApprover) (*model.StackInfo, error) {
+	return r.updateStack(ctx, name, stack, params, metadata, false, approve)
+}
+
+func (r *CloudFormationRepo) updateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool, approve model.ChangeApprover) (*model.StackInfo, error) {
+
+	cfg, err := r.stackCfConfig(stack)
+	if err != nil {
+		return nil, err
+	}
 
-	templateBody, templateUrl, err := r.templateOrUrl(template)
+	templateBody, templateUrl, err := r.templateOrUrl(ctx, stack.TemplateFile)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get template body: %w", err)
 	}
@@ -160,22 +222,161 @@ func (r *CloudFormationRepo) UpdateStack(ctx context.Context, name string, templ
 	// Create change set
 	cfParams := r.generateParams(params, templateResp.Parameters)
 	tags := r.generateTags(metadata)
-	_, err = r.client.CreateChangeSet(ctx, &cloudformation.CreateChangeSetInput{
-		ChangeSetName: &changeSetName,
+
+	return r.applyChangeSet(ctx, name, templateBody, templateUrl, cfParams, tags, cfg, dryRun, approve)
+}
+
+func (r *CloudFormationRepo) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	resp, err := r.client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{
+		StackName: &name,
+	})
+	if err != nil {
+		if r.isNotFound(err) {
+			return nil, apperr.NewNotFoundError("stack", name)
+		}
+		return nil, fmt.Errorf("unable to describe stack: %w", err)
+	}
+	if len(resp.Stacks) == 0 {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+
+	templateResp, err := r.client.GetTemplate(ctx, &cloudformation.GetTemplateInput{
 		StackName:     &name,
-		TemplateURL:   templateUrl,
-		TemplateBody:  templateBody,
-		Parameters:    cfParams,
-		Tags:          tags,
-		Capabilities: []types.Capability{
-			types.CapabilityCapabilityNamedIam,
+		TemplateStage: types.TemplateStageOriginal,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get template: %w", err)
+	}
+
+	params := map[string]string{}
+	for _, param := range resp.Stacks[0].Parameters {
+		params[r.strOrEmpty(param.ParameterKey)] = r.strOrEmpty(param.ParameterValue)
+	}
+
+	capabilities := []string{}
+	for _, capability := range resp.Stacks[0].Capabilities {
+		capabilities = append(capabilities, string(capability))
+	}
+
+	return &model.StackSnapshot{
+		Name:         name,
+		TemplateBody: r.strOrEmpty(templateResp.TemplateBody),
+		Parameters:   params,
+		Capabilities: capabilities,
+		RoleArn:      r.strOrEmpty(resp.Stacks[0].RoleARN),
+	}, nil
+}
+
+func (r *CloudFormationRepo) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	resp, err := r.client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{
+		StackName: &name,
+	})
+	if err != nil {
+		if r.isNotFound(err) {
+			return nil, apperr.NewNotFoundError("stack", name)
+		}
+		return nil, fmt.Errorf("unable to describe stack: %w", err)
+	}
+	if len(resp.Stacks) == 0 {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+
+	stack := resp.Stacks[0]
+	stackInfo := &model.StackInfo{
+		Name:       name,
+		NextAction: model.NextActionUpdate,
+		DeployStatus: model.DeployStatus{
+			Name:    name,
+			State:   r.cfStatusToState(stack.StackStatus),
+			Reason:  r.strOrEmpty(stack.StackStatusReason),
+			Details: r.strOrEmpty(stack.StackId),
 		},
+		Resources: []string{},
+	}
+
+	switch {
+	case stack.StackStatus == types.StackStatusUpdateInProgress:
+		// Cancelling an in progress update makes CloudFormation roll it back
+		_, err = r.client.CancelUpdateStack(ctx, &cloudformation.CancelUpdateStackInput{
+			StackName: &name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to cancel stack update: %w", err)
+		}
+
+		stackInfo.DeployStatus.State = model.StateRollingBack
+		stackInfo.DeployStatus.Reason = "Cloudformation CancelUpdateStack"
+	case stackInfo.DeployStatus.State == model.StateUpdating:
+		// Such as the cleanup after an update, which can't be cancelled and leaves the stack on the new version
+		return nil, fmt.Errorf("stack %v is %v and can't be rolled back until it finishes", name, stack.StackStatus)
+	case stackInfo.DeployStatus.State == model.StateComplete && snapshot != nil:
+		// The update finished, restore the previous template and params
+		cfParams := []types.Parameter{}
+		for k, v := range snapshot.Parameters {
+			param := types.Parameter{
+				ParameterKey: aws.String(k),
+			}
+			if v == cfNoEchoValue {
+				// NoEcho values can't be read back, keep whatever is deployed
+				param.UsePreviousValue = aws.Bool(true)
+			} else {
+				param.ParameterValue = aws.String(v)
+			}
+			cfParams = append(cfParams, param)
+		}
+
+		var templateBody, templateUrl *string
+		templateBody, templateUrl, err = r.bodyOrUrl(ctx, []byte(snapshot.TemplateBody))
+		if err != nil {
+			return nil, err
+		}
+
+		// The previous version is deployed with the role and capabilities it was deployed with
+		cfg := model.CloudFormationConfig{
+			RoleArn:      snapshot.RoleArn,
+			Capabilities: snapshot.Capabilities,
+		}
+
+		stackInfo, err = r.applyChangeSet(ctx, name, templateBody, templateUrl, cfParams, nil, cfg, false, nil)
+		if err != nil {
+			return nil, err
+		}
+		stackInfo.DeployStatus.Reason = "Cloudformation RollbackStack"
+	}
+
+	return stackInfo, nil
+}
+
+// applyChangeSet creates a change set and executes it. If this is a dry run, there are no changes or approve doesn't
+// approve them, the change set is deleted instead. The stack policy and termination protection of cfg are set unless
+// this is a dry run or the changes aren't approved.
+func (r *CloudFormationRepo) applyChangeSet(ctx context.Context, name string, templateBody *string, templateUrl *string,
+	cfParams []types.Parameter, tags []types.Tag, cfg model.CloudFormationConfig, dryRun bool,
+	approve model.ChangeApprover) (*model.StackInfo, error) {
+
+	// Get the current timestamp
+	t := time.Now()
+	timestamp := t.Format("20060102150405")
+	changeSetName := fmt.Sprintf("Swz-%s-%s", name, timestamp)
+
+	_, err := r.client.CreateChangeSet(ctx, &cloudformation.CreateChangeSetInput{
+		ChangeSetName:         &changeSetName,
+		StackName:             &name,
+		TemplateURL:           templateUrl,
+		TemplateBody:          templateBody,
+		Parameters:            cfParams,
+		Tags:                  tags,
+		Capabilities:          r.capabilities(cfg.GetCapabilities()),
+		RoleARN:               r.strOrNil(cfg.RoleArn),
+		NotificationARNs:      cfg.NotificationArns,
+		RollbackConfiguration: r.rollbackConfig(cfg.RollbackTriggers),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create change set, %w", err)
 	}
 
 	// Wait for change set and fetch info
+	interval := r.retry.PollInterval()
 	notReady := true
 	var resp *cloudformation.DescribeChangeSetOutput
 	for notReady {
@@ -187,28 +388,66 @@ func (r *CloudFormationRepo) UpdateStack(ctx context.Context, name string, templ
 			return nil, fmt.Errorf("failed to describe change set, %w", err)
 		}
 
-		if len(resp.Changes) == 0 {
-			// Empty change set, set dry run to true so we don't execute
-			dryRun = true
+		switch resp.Status {
+		case types.ChangeSetStatusCreateComplete:
 			notReady = false
-		}
+		case types.ChangeSetStatusFailed:
+			if !r.isEmptyChangeSet(resp) {
+				// Don't leave the failed change set behind
+				_, _ = r.client.DeleteChangeSet(ctx, &cloudformation.DeleteChangeSetInput{
+					ChangeSetName: &changeSetName,
+					StackName:     &name,
+				})
+				return nil, fmt.Errorf("failed to create change set, %v", r.strOrEmpty(resp.StatusReason))
+			}
 
-		if resp.ExecutionStatus == types.ExecutionStatusAvailable {
+			// Empty change set, set dry run to true so we don't execute. The stack settings may still have changed.
+			if !dryRun {
+				err = r.updateStackSettings(ctx, name, cfg)
+				if err != nil {
+					return nil, err
+				}
+			}
+			dryRun = true
 			notReady = false
-		} else {
-			time.Sleep(CfPollTimeSec * time.Second)
+		default:
+			err = backoff.Sleep(ctx, interval.Next(false))
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	resourceChanges := []string{}
+	changes := []model.ResourceChange{}
 	for _, change := range resp.Changes {
-		resourceChanges = append(resourceChanges, *change.ResourceChange.ResourceType)
+		if change.ResourceChange == nil {
+			continue
+		}
+		resourceChanges = append(resourceChanges, r.strOrEmpty(change.ResourceChange.ResourceType))
+		changes = append(changes, r.resourceChange(change.ResourceChange))
 	}
 
 	state := model.StateDryRun
 	reason := "Dry Run"
 	details := ""
 
+	if !dryRun && approve != nil {
+		approved, approveErr := approve(name, changes)
+		if approveErr != nil {
+			// Don't leave the change set behind
+			_, _ = r.client.DeleteChangeSet(ctx, &cloudformation.DeleteChangeSetInput{
+				ChangeSetName: &changeSetName,
+				StackName:     &name,
+			})
+			return nil, fmt.Errorf("unable to review changes: %w", approveErr)
+		}
+		if !approved {
+			dryRun = true
+			reason = "Changes not approved"
+		}
+	}
+
 	// If this is a dry run, delete the change set
 	if dryRun {
 		_, err = r.client.DeleteChangeSet(ctx, &cloudformation.DeleteChangeSetInput{
@@ -219,10 +458,17 @@ func (r *CloudFormationRepo) UpdateStack(ctx context.Context, name string, templ
 			return nil, fmt.Errorf("failed to delete change set, %w", err)
 		}
 	} else {
+		// The stack policy is set first so it covers the update
+		err = r.updateStackSettings(ctx, name, cfg)
+		if err != nil {
+			return nil, err
+		}
+
 		// Apply change set
 		_, err = r.client.ExecuteChangeSet(ctx, &cloudformation.ExecuteChangeSetInput{
-			ChangeSetName: &changeSetName,
-			StackName:     &name,
+			ChangeSetName:   &changeSetName,
+			StackName:       &name,
+			DisableRollback: cfg.DisableRollback,
 		})
 
 		if err != nil {
@@ -244,17 +490,39 @@ func (r *CloudFormationRepo) UpdateStack(ctx context.Context, name string, templ
 			Details: details,
 		},
 		Resources: resourceChanges,
+		Changes:   changes,
 	}, nil
 }
 
+// isEmptyChangeSet returns true if the change set failed only because there was nothing to change. Any other failure,
+// such as an invalid template or a missing capability, is a real error.
+func (r *CloudFormationRepo) isEmptyChangeSet(resp *cloudformation.DescribeChangeSetOutput) bool {
+	reason := r.strOrEmpty(resp.StatusReason)
+	return strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, "No updates are to be performed")
+}
+
+func (r *CloudFormationRepo) resourceChange(change *types.ResourceChange) model.ResourceChange {
+	scope := []string{}
+	for _, attr := range change.Scope {
+		scope = append(scope, string(attr))
+	}
+
+	return model.ResourceChange{
+		Action:       string(change.Action),
+		LogicalId:    r.strOrEmpty(change.LogicalResourceId),
+		ResourceType: r.strOrEmpty(change.ResourceType),
+		Replacement:  string(change.Replacement),
+		Scope:        scope,
+	}
+}
+
 func (r *CloudFormationRepo) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
 	resp, err := r.client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{
 		StackName: &name,
 	})
 
 	if err != nil {
-		var apiError *smithy.GenericAPIError
-		if errors.As(err, &apiError) && apiError.Code == "ValidationError" {
+		if r.isNotFound(err) {
 			return nil, apperr.NewNotFoundError("stack", name)
 		}
 		return nil, fmt.Errorf("fetching stack info: %w", err)
@@ -296,6 +564,9 @@ func (r *CloudFormationRepo) GetStackOutputs(ctx context.Context, name string) (
 	})
 
 	if err != nil {
+		if r.isNotFound(err) {
+			return nil, apperr.NewNotFoundError("stack", name)
+		}
 		return nil, fmt.Errorf("unable to find resource: %w", err)
 	}
 
@@ -326,6 +597,7 @@ func (r *CloudFormationRepo) ListStacks(ctx context.Context, envName string) ([]
 					Details: r.strOrEmpty(stack.StackId),
 				},
 				Resources: []string{}, // This is left blank because it's an expensive call
+				AdoptedAs: r.tagValue(stack.Tags, model.StackKeyStackName),
 			})
 
 			return true, nil
@@ -405,6 +677,11 @@ func (r *CloudFormationRepo) IsEnvironmentInState(ctx context.Context, envName s
 		input := &cloudformation.DescribeStacksInput{StackName: &stackName}
 		resp, err := r.client.DescribeStacks(ctx, input)
 		if err != nil {
+			if r.isNotFound(err) && r.hasState(states, model.StateDeleted) {
+				// Deleted stacks can no longer be described by name
+				stackCompleteList = append(stackCompleteList, stackName)
+				continue
+			}
 			return false, stackCompleteList, fmt.Errorf("failed to describe stack %s: %v", stackName, err)
 		}
 
@@ -417,8 +694,8 @@ func (r *CloudFormationRepo) IsEnvironmentInState(ctx context.Context, envName s
 				}
 			}
 
-			if state == model.StateFailed {
-				return false, nil, fmt.Errorf("stack %v failed", stackName)
+			if state == model.StateFailed || (r.isRollback(state) && !r.hasState(states, model.StateRolledBack)) {
+				return false, nil, r.stackFailedErr(ctx, stackName, r.strOrEmpty(stack.StackId))
 			}
 		}
 	}
@@ -426,26 +703,522 @@ func (r *CloudFormationRepo) IsEnvironmentInState(ctx context.Context, envName s
 	return len(stackCompleteList) == len(stacks), stackCompleteList, nil
 }
 
-func (r *CloudFormationRepo) templateOrUrl(template string) (templateBody *string, templateUrl *string, err error) {
+func (r *CloudFormationRepo) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	resp, err := r.client.DetectStackDrift(ctx, &cloudformation.DetectStackDriftInput{
+		StackName: &name,
+	})
+	if err != nil {
+		if r.isNotFound(err) {
+			return "", apperr.NewNotFoundError("stack", name)
+		}
+		return "", fmt.Errorf("unable to detect stack drift: %w", err)
+	}
+
+	return r.strOrEmpty(resp.StackDriftDetectionId), nil
+}
+
+// GetStackDrift returns the status of a drift detection. Once it's done, the resources that were modified or deleted
+// are listed with their property differences.
+func (r *CloudFormationRepo) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	resp, err := r.client.DescribeStackDriftDetectionStatus(ctx, &cloudformation.DescribeStackDriftDetectionStatusInput{
+		StackDriftDetectionId: &detectionId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to describe stack drift detection: %w", err)
+	}
+
+	drift := &model.StackDrift{
+		Name:            name,
+		Status:          string(resp.StackDriftStatus),
+		DetectionStatus: string(resp.DetectionStatus),
+		Reason:          r.strOrEmpty(resp.DetectionStatusReason),
+		Resources:       []model.ResourceDrift{},
+	}
+	if resp.DetectionStatus == types.StackDriftDetectionStatusDetectionInProgress {
+		return drift, nil
+	}
+	drift.Complete = true
+
+	// A failed detection still has results for the resources it could check
+	paginator := cloudformation.NewDescribeStackResourceDriftsPaginator(r.client, &cloudformation.DescribeStackResourceDriftsInput{
+		StackName: &name,
+		StackResourceDriftStatusFilters: []types.StackResourceDriftStatus{
+			types.StackResourceDriftStatusModified,
+			types.StackResourceDriftStatusDeleted,
+		},
+	})
+	for paginator.HasMorePages() {
+		page, pageErr := paginator.NextPage(ctx)
+		if pageErr != nil {
+			return nil, fmt.Errorf("unable to describe stack resource drifts: %w", pageErr)
+		}
+
+		for _, resourceDrift := range page.StackResourceDrifts {
+			drift.Resources = append(drift.Resources, r.resourceDrift(resourceDrift))
+		}
+	}
+
+	return drift, nil
+}
+
+func (r *CloudFormationRepo) resourceDrift(resourceDrift types.StackResourceDrift) model.ResourceDrift {
+	differences := []model.PropertyDifference{}
+	for _, diff := range resourceDrift.PropertyDifferences {
+		differences = append(differences, model.PropertyDifference{
+			Path:     r.strOrEmpty(diff.PropertyPath),
+			Type:     string(diff.DifferenceType),
+			Expected: r.strOrEmpty(diff.ExpectedValue),
+			Actual:   r.strOrEmpty(diff.ActualValue),
+		})
+	}
+
+	return model.ResourceDrift{
+		LogicalId:    r.strOrEmpty(resourceDrift.LogicalResourceId),
+		PhysicalId:   r.strOrEmpty(resourceDrift.PhysicalResourceId),
+		ResourceType: r.strOrEmpty(resourceDrift.ResourceType),
+		Status:       string(resourceDrift.StackResourceDriftStatus),
+		Differences:  differences,
+	}
+}
+
+// AdoptStack checks that a stack deployed outside of swiz has the resources of the stack template and tags it with
+// metadata. The template and parameters of the stack are kept as they are. With force set, the stack is adopted
+// without checking it.
+func (r *CloudFormationRepo) AdoptStack(ctx context.Context, name string, stack *model.StackConfig,
+	metadata map[string]string, force bool, dryRun bool) (*model.StackInfo, error) {
+	resp, err := r.client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{
+		StackName: &name,
+	})
+	if err != nil {
+		if r.isNotFound(err) {
+			return nil, apperr.NewNotFoundError("stack", name)
+		}
+		return nil, fmt.Errorf("unable to describe stack: %w", err)
+	}
+	if len(resp.Stacks) == 0 {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+
+	cfStack := resp.Stacks[0]
+	state := r.cfStatusToState(cfStack.StackStatus)
+	if state != model.StateComplete && state != model.StateRolledBack {
+		return nil, fmt.Errorf("stack %v is %v, only stacks that are not changing can be adopted", name,
+			cfStack.StackStatus)
+	}
+
+	// A stack can't be moved to another environment
+	envName := r.tagValue(cfStack.Tags, model.StackKeyEnvName)
+	if envName != "" && envName != metadata[model.StackKeyEnvName] {
+		return nil, fmt.Errorf("stack %v already belongs to environment %v", name, envName)
+	}
+
+	if !force {
+		diffs, diffErr := r.compareTemplate(ctx, name, stack.TemplateFile)
+		if diffErr != nil {
+			return nil, diffErr
+		}
+		if len(diffs) > 0 {
+			return nil, fmt.Errorf("stack %v doesn't match template %v:\n  %v", name, stack.TemplateFile,
+				strings.Join(diffs, "\n  "))
+		}
+	}
+
+	stackInfo := &model.StackInfo{
+		Name:       name,
+		NextAction: model.NextActionUpdate,
+		DeployStatus: model.DeployStatus{
+			Name:    name,
+			State:   model.StateDryRun,
+			Reason:  "Dry Run",
+			Details: r.strOrEmpty(cfStack.StackId),
+		},
+		Resources: []string{},
+	}
+	if dryRun {
+		return stackInfo, nil
+	}
+
+	// The tags of the stack are kept, swiz only adds its own
+	tags := map[string]string{}
+	for _, tag := range cfStack.Tags {
+		tags[r.strOrEmpty(tag.Key)] = r.strOrEmpty(tag.Value)
+	}
+	changed := false
+	for k, v := range metadata {
+		if tags[k] != v {
+			tags[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		stackInfo.DeployStatus.State = model.StateComplete
+		stackInfo.DeployStatus.Reason = "Already adopted"
+		return stackInfo, nil
+	}
+
+	cfParams := []types.Parameter{}
+	for _, param := range cfStack.Parameters {
+		cfParams = append(cfParams, types.Parameter{
+			ParameterKey:     param.ParameterKey,
+			UsePreviousValue: aws.Bool(true),
+		})
+	}
+
+	// Only the tags change, so the stack is updated with the template, capabilities and role it was deployed with
+	_, err = r.client.UpdateStack(ctx, &cloudformation.UpdateStackInput{
+		StackName:           &name,
+		UsePreviousTemplate: aws.Bool(true),
+		Parameters:          cfParams,
+		Capabilities:        cfStack.Capabilities,
+		Tags:                r.generateTags(tags),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to tag stack: %w", err)
+	}
+
+	stackInfo.DeployStatus.State = model.StateUpdating
+	stackInfo.DeployStatus.Reason = "Cloudformation UpdateStack"
+
+	return stackInfo, nil
+}
+
+// compareTemplate compares the resources of a deployed stack with the resources of a template. It returns a line for
+// each resource that is missing on either side or has a different type.
+func (r *CloudFormationRepo) compareTemplate(ctx context.Context, name string, template string) ([]string, error) {
+	if template == "" {
+		return nil, fmt.Errorf("stack %v has no template_file to check against", name)
+	}
+
+	b, err := r.openUrl.OpenUrl(template)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read template %v: %w", template, err)
+	}
+	expected, err := r.templateResources(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template %v: %w", template, err)
+	}
+
+	templateResp, err := r.client.GetTemplate(ctx, &cloudformation.GetTemplateInput{
+		StackName:     &name,
+		TemplateStage: types.TemplateStageOriginal,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get template: %w", err)
+	}
+	deployed, err := r.templateResources([]byte(r.strOrEmpty(templateResp.TemplateBody)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the template of stack %v: %w", name, err)
+	}
+
+	logicalIds := []string{}
+	for logicalId := range expected {
+		logicalIds = append(logicalIds, logicalId)
+	}
+	for logicalId := range deployed {
+		if _, ok := expected[logicalId]; !ok {
+			logicalIds = append(logicalIds, logicalId)
+		}
+	}
+	sort.Strings(logicalIds)
+
+	diffs := []string{}
+	for _, logicalId := range logicalIds {
+		expectedType, inTemplate := expected[logicalId]
+		deployedType, inStack := deployed[logicalId]
+		switch {
+		case !inStack:
+			diffs = append(diffs, fmt.Sprintf("%v (%v) is not deployed", logicalId, expectedType))
+		case !inTemplate:
+			diffs = append(diffs, fmt.Sprintf("%v (%v) is not in the template", logicalId, deployedType))
+		case expectedType != deployedType:
+			diffs = append(diffs, fmt.Sprintf("%v is a %v, the template has a %v", logicalId, deployedType,
+				expectedType))
+		}
+	}
+
+	return diffs, nil
+}
+
+// templateResources returns the type of each resource of a template by logical id. YAML and JSON templates are both
+// read as YAML.
+func (r *CloudFormationRepo) templateResources(body []byte) (map[string]string, error) {
+	doc := yaml.Node{}
+	err := yaml.Unmarshal(body, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := map[string]string{}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return retVal, nil
+	}
+
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "Resources" || root.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+
+		resources := root.Content[i+1]
+		for j := 0; j+1 < len(resources.Content); j += 2 {
+			resource := resources.Content[j+1]
+			resourceType := ""
+			for k := 0; k+1 < len(resource.Content); k += 2 {
+				if resource.Content[k].Value == "Type" {
+					resourceType = resource.Content[k+1].Value
+				}
+			}
+			retVal[resources.Content[j].Value] = resourceType
+		}
+	}
+
+	return retVal, nil
+}
+
+// GetStackEvents returns the events of a stack at or after since, oldest first
+func (r *CloudFormationRepo) GetStackEvents(ctx context.Context, name string, since time.Time) ([]model.StackEvent, error) {
+	events := []model.StackEvent{}
+
+	// Events are listed newest first
+	paginator := cloudformation.NewDescribeStackEventsPaginator(r.client, &cloudformation.DescribeStackEventsInput{
+		StackName: &name,
+	})
+	for done := false; !done && paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			if r.isNotFound(err) {
+				return nil, apperr.NewNotFoundError("stack", name)
+			}
+			return nil, fmt.Errorf("unable to describe stack events: %w", err)
+		}
+
+		for _, event := range page.StackEvents {
+			if event.Timestamp == nil || event.Timestamp.Before(since) {
+				done = true
+				break
+			}
+			events = append(events, r.stackEvent(name, event))
+		}
+	}
+
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+
+	return events, nil
+}
+
+// stackFailedErr returns the error for a failed stack with the first resource that failed in the latest operation.
+// The stack id is used so the events of a stack that was deleted after failing to create can still be read.
+func (r *CloudFormationRepo) stackFailedErr(ctx context.Context, name string, stackId string) error {
+	if stackId == "" {
+		stackId = name
+	}
+
+	var firstFailed *types.StackEvent
+	paginator := cloudformation.NewDescribeStackEventsPaginator(r.client, &cloudformation.DescribeStackEventsInput{
+		StackName: &stackId,
+	})
+	for done, pages := false, 0; !done && pages < cfMaxFailedEventPages && paginator.HasMorePages(); pages++ {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			break
+		}
+
+		for i, event := range page.StackEvents {
+			if strings.HasSuffix(string(event.ResourceStatus), "_FAILED") {
+				firstFailed = &page.StackEvents[i]
+			}
+
+			// Stop at the start of the operation
+			if r.strOrEmpty(event.LogicalResourceId) == r.strOrEmpty(event.StackName) &&
+				r.strOrEmpty(event.ResourceStatusReason) == "User Initiated" {
+				done = true
+				break
+			}
+		}
+	}
+
+	if firstFailed == nil {
+		return fmt.Errorf("stack %v failed", name)
+	}
+
+	event := r.stackEvent(name, *firstFailed)
+	return fmt.Errorf("stack %v failed: %v %v (%v): %v", name, event.LogicalId, event.Status, event.ResourceType,
+		event.Reason)
+}
+
+func (r *CloudFormationRepo) stackEvent(name string, event types.StackEvent) model.StackEvent {
+	stackEvent := model.StackEvent{
+		Id:           r.strOrEmpty(event.EventId),
+		StackName:    name,
+		LogicalId:    r.strOrEmpty(event.LogicalResourceId),
+		ResourceType: r.strOrEmpty(event.ResourceType),
+		Status:       string(event.ResourceStatus),
+		Reason:       r.strOrEmpty(event.ResourceStatusReason),
+	}
+	if event.Timestamp != nil {
+		stackEvent.Timestamp = *event.Timestamp
+	}
+
+	return stackEvent
+}
+
+// timeoutInMinutes converts a stack timeout to whole minutes, rounding up. nil means no timeout.
+func (r *CloudFormationRepo) timeoutInMinutes(timeout time.Duration) *int32 {
+	if timeout <= 0 {
+		return nil
+	}
+
+	minutes := int32((timeout + time.Minute - 1) / time.Minute)
+	return &minutes
+}
+
+// stackCfConfig returns the CloudFormation options of the stack with the enclave defaults filled in
+func (r *CloudFormationRepo) stackCfConfig(stack *model.StackConfig) (model.CloudFormationConfig, error) {
+	cfg := stack.CfConfig.Merge(r.cfConfig)
+	err := cfg.Validate()
+	if err != nil {
+		return cfg, fmt.Errorf("stack %v: %w", stack.Name, err)
+	}
+
+	return cfg, nil
+}
+
+// updateStackSettings sets the stack policy and termination protection of an existing stack, which change sets don't
+// include
+func (r *CloudFormationRepo) updateStackSettings(ctx context.Context, name string, cfg model.CloudFormationConfig) error {
+	if cfg.StackPolicy != "" {
+		policyBody, policyUrl, err := r.stackPolicy(cfg.StackPolicy)
+		if err != nil {
+			return fmt.Errorf("unable to get stack policy: %w", err)
+		}
+
+		_, err = r.client.SetStackPolicy(ctx, &cloudformation.SetStackPolicyInput{
+			StackName:       &name,
+			StackPolicyBody: policyBody,
+			StackPolicyURL:  policyUrl,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to set stack policy: %w", err)
+		}
+	}
+
+	if cfg.TerminationProtection != nil {
+		_, err := r.client.UpdateTerminationProtection(ctx, &cloudformation.UpdateTerminationProtectionInput{
+			StackName:                   &name,
+			EnableTerminationProtection: cfg.TerminationProtection,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to update termination protection: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// stackPolicy returns the body of a local stack policy, or the URL of a remote one. Both are nil without a policy.
+func (r *CloudFormationRepo) stackPolicy(policy string) (policyBody *string, policyUrl *string, err error) {
+	if policy == "" {
+		return nil, nil, nil
+	}
+
+	scheme, err := r.openUrl.GetScheme(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if scheme != "file" {
+		return nil, &policy, nil
+	}
+
+	b, err := r.openUrl.OpenUrl(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	str := string(b)
+	return &str, nil, nil
+}
+
+func (r *CloudFormationRepo) capabilities(capabilities []string) []types.Capability {
+	retVal := []types.Capability{}
+	for _, capability := range capabilities {
+		retVal = append(retVal, types.Capability(capability))
+	}
+
+	return retVal
+}
+
+func (r *CloudFormationRepo) rollbackConfig(triggers []model.RollbackTrigger) *types.RollbackConfiguration {
+	if len(triggers) == 0 {
+		return nil
+	}
+
+	retVal := &types.RollbackConfiguration{}
+	for _, trigger := range triggers {
+		retVal.RollbackTriggers = append(retVal.RollbackTriggers, types.RollbackTrigger{
+			Arn:  aws.String(trigger.Arn),
+			Type: aws.String(trigger.GetType()),
+		})
+	}
+
+	return retVal
+}
+
+// templateOrUrl returns the body of a local template, or the URL of a remote one. With an artifact bucket, the local
+// files a template refers to are uploaded and a template that is too large for a body is uploaded as well.
+func (r *CloudFormationRepo) templateOrUrl(ctx context.Context, template string) (templateBody *string,
+	templateUrl *string, err error) {
 	scheme, err := r.openUrl.GetScheme(template)
 	if err != nil {
 		return
 	}
 
-	if scheme == "file" {
-		var b []byte
-		b, err = r.openUrl.OpenUrl(template)
+	if scheme != "file" {
+		templateUrl = &template
+		return
+	}
+
+	b, err := r.openUrl.OpenUrl(template)
+	if err != nil {
+		return
+	}
+
+	if r.packager != nil {
+		var templatePath string
+		templatePath, err = r.openUrl.GetPathFromUrl(template, true)
 		if err != nil {
 			return
 		}
 
-		str := string(b)
-		templateBody = &str
-	} else {
-		templateUrl = &template
+		b, err = r.packager.packageTemplate(ctx, templatePath, b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to package template: %w", err)
+		}
 	}
 
-	return
+	return r.bodyOrUrl(ctx, b)
+}
+
+// bodyOrUrl returns the template as a body, or uploads it to the artifact bucket if it's over the body limit
+func (r *CloudFormationRepo) bodyOrUrl(ctx context.Context, template []byte) (templateBody *string,
+	templateUrl *string, err error) {
+	if len(template) <= cfTemplateBodyLimit {
+		str := string(template)
+		return &str, nil, nil
+	}
+
+	if r.packager == nil {
+		return nil, nil, fmt.Errorf("template is %v bytes, over the CloudFormation limit of %v, set artifact_bucket "+
+			"or an artifact_buckets entry for the region in the enclave to upload it", len(template), cfTemplateBodyLimit)
+	}
+
+	url, err := r.packager.uploadTemplate(ctx, template)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nil, &url, nil
 }
 
 func (r *CloudFormationRepo) iterateAllStacks(ctx context.Context,
@@ -487,6 +1260,42 @@ func (r *CloudFormationRepo) generateTags(metadata map[string]string) []types.Ta
 	return tags
 }
 
+func (r *CloudFormationRepo) tagValue(tags []types.Tag, key string) string {
+	for _, tag := range tags {
+		if r.strOrEmpty(tag.Key) == key {
+			return r.strOrEmpty(tag.Value)
+		}
+	}
+	return ""
+}
+
+// isNotFound returns true if the error is CloudFormation reporting that a stack does not exist
+func (r *CloudFormationRepo) isNotFound(err error) bool {
+	var apiError *smithy.GenericAPIError
+	return errors.As(err, &apiError) && apiError.Code == "ValidationError"
+}
+
+// isRollback returns true if an update was rolled back or is rolling back. The stack is left on its previous version.
+func (r *CloudFormationRepo) isRollback(state model.State) bool {
+	return state == model.StateRollingBack || state == model.StateRolledBack
+}
+
+func (r *CloudFormationRepo) hasState(states []model.State, state model.State) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CloudFormationRepo) strOrNil(str string) *string {
+	if str == "" {
+		return nil
+	}
+	return &str
+}
+
 func (r *CloudFormationRepo) strOrEmpty(str *string) string {
 	if str == nil {
 		return ""
@@ -538,9 +1347,9 @@ func (r *CloudFormationRepo) cfStatusToState(stackStatus types.StackStatus) mode
 	case types.StackStatusUpdateInProgress:
 		return model.StateUpdating
 	case types.StackStatusUpdateRollbackComplete:
-		return model.StateFailed
+		return model.StateRolledBack
 	case types.StackStatusUpdateRollbackInProgress:
-		return model.StateFailed
+		return model.StateRollingBack
 	case types.StackStatusUpdateRollbackFailed:
 		return model.StateFailed
 	case types.StackStatusReviewInProgress:
@@ -550,17 +1359,17 @@ func (r *CloudFormationRepo) cfStatusToState(stackStatus types.StackStatus) mode
 	case types.StackStatusUpdateFailed:
 		return model.StateFailed
 	case types.StackStatusUpdateRollbackCompleteCleanupInProgress:
-		return model.StateFailed
+		return model.StateRollingBack
 	case types.StackStatusImportInProgress:
 		return model.StateUpdating
 	case types.StackStatusImportComplete:
 		return model.StateComplete
 	case types.StackStatusImportRollbackInProgress:
-		return model.StateFailed
+		return model.StateRollingBack
 	case types.StackStatusImportRollbackFailed:
 		return model.StateFailed
 	case types.StackStatusImportRollbackComplete:
-		return model.StateFailed
+		return model.StateRolledBack
 	default:
 		return model.StateUnknown
 
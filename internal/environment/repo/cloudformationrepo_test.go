@@ -0,0 +1,700 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	mockaws "github.com/swizzleio/swiz/mocks/ext/aws"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+const cfTestTemplate = `Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+  Queue:
+    Type: AWS::SQS::Queue
+`
+
+func newTestCloudFormationRepo(client *mockaws.Cloudformationer) *CloudFormationRepo {
+	return &CloudFormationRepo{
+		client:  client,
+		openUrl: fileutil.NewFileUrlHelper(),
+		retry: model.EncRetry{
+			MinPollInterval: time.Millisecond,
+			MaxPollInterval: time.Millisecond,
+		},
+	}
+}
+
+// newTestCfStack returns a stack config with a local template
+func newTestCfStack(t *testing.T, template string) *model.StackConfig {
+	templateFile := filepath.Join(t.TempDir(), "template.yaml")
+	assert.NoError(t, os.WriteFile(templateFile, []byte(template), 0600))
+
+	return &model.StackConfig{
+		Name:         "app",
+		TemplateFile: "file://" + templateFile,
+	}
+}
+
+// onChangeSet sets up a change set that finishes with status and reason
+func onChangeSet(client *mockaws.Cloudformationer, status types.ChangeSetStatus, reason string, changes ...types.Change) {
+	client.On("GetTemplateSummary", mock.Anything, mock.Anything).Return(&cloudformation.GetTemplateSummaryOutput{}, nil)
+	client.On("CreateChangeSet", mock.Anything, mock.Anything).Return(&cloudformation.CreateChangeSetOutput{}, nil)
+	client.On("DescribeChangeSet", mock.Anything, mock.Anything).Return(&cloudformation.DescribeChangeSetOutput{
+		Status:       status,
+		StatusReason: aws.String(reason),
+		Changes:      changes,
+	}, nil)
+}
+
+func TestCloudFormationRepo_UpdateStackChangeSetFailed(t *testing.T) {
+	tests := []struct {
+		name    string
+		reason  string
+		wantErr string
+	}{
+		{
+			name:   "no changes",
+			reason: "The submitted information didn't contain changes. Submit different information to create a change set.",
+		},
+		{
+			name:   "no updates",
+			reason: "No updates are to be performed.",
+		},
+		{
+			name:    "invalid template",
+			reason:  "Template format error: Unresolved resource dependencies [Vpc] in the Resources block of the template",
+			wantErr: "Template format error",
+		},
+		{
+			name:    "missing capability",
+			reason:  "Requires capabilities : [CAPABILITY_IAM]",
+			wantErr: "CAPABILITY_IAM",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mockaws.NewCloudformationer(t)
+			onChangeSet(client, types.ChangeSetStatusFailed, tt.reason)
+			client.On("DeleteChangeSet", mock.Anything, mock.Anything).Return(&cloudformation.DeleteChangeSetOutput{}, nil)
+			r := newTestCloudFormationRepo(client)
+
+			stackInfo, err := r.UpdateStack(context.Background(), "dev-app", newTestCfStack(t, cfTestTemplate), nil, nil, false)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, model.StateDryRun, stackInfo.DeployStatus.State)
+			client.AssertNotCalled(t, "ExecuteChangeSet", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestCloudFormationRepo_GetStackDrift(t *testing.T) {
+	tests := []struct {
+		name            string
+		detectionStatus types.StackDriftDetectionStatus
+		driftStatus     types.StackDriftStatus
+		wantComplete    bool
+		wantFailed      bool
+	}{
+		{
+			name:            "in progress",
+			detectionStatus: types.StackDriftDetectionStatusDetectionInProgress,
+		},
+		{
+			name:            "in sync",
+			detectionStatus: types.StackDriftDetectionStatusDetectionComplete,
+			driftStatus:     types.StackDriftStatusInSync,
+			wantComplete:    true,
+		},
+		{
+			name:            "detection failed",
+			detectionStatus: types.StackDriftDetectionStatusDetectionFailed,
+			driftStatus:     types.StackDriftStatusInSync,
+			wantComplete:    true,
+			wantFailed:      true,
+		},
+		{
+			name:            "unknown",
+			detectionStatus: types.StackDriftDetectionStatusDetectionComplete,
+			driftStatus:     types.StackDriftStatusUnknown,
+			wantComplete:    true,
+			wantFailed:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mockaws.NewCloudformationer(t)
+			client.On("DescribeStackDriftDetectionStatus", mock.Anything, mock.Anything).Return(
+				&cloudformation.DescribeStackDriftDetectionStatusOutput{
+					DetectionStatus:  tt.detectionStatus,
+					StackDriftStatus: tt.driftStatus,
+				}, nil)
+			if tt.wantComplete {
+				client.On("DescribeStackResourceDrifts", mock.Anything, mock.Anything).Return(
+					&cloudformation.DescribeStackResourceDriftsOutput{}, nil)
+			}
+			r := newTestCloudFormationRepo(client)
+
+			drift, err := r.GetStackDrift(context.Background(), "dev-app", "detection-1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantComplete, drift.Complete)
+			assert.Equal(t, string(tt.detectionStatus), drift.DetectionStatus)
+			assert.Equal(t, tt.wantFailed, drift.IsDetectionFailed())
+		})
+	}
+}
+
+func TestCloudFormationRepo_ReviewUpdateStack(t *testing.T) {
+	tests := []struct {
+		name        string
+		approved    bool
+		approveErr  error
+		wantState   model.State
+		wantReason  string
+		wantExecute bool
+		wantErr     bool
+	}{
+		{
+			name:        "approved",
+			approved:    true,
+			wantState:   model.StateUpdating,
+			wantReason:  "Cloudformation UpdateStack",
+			wantExecute: true,
+		},
+		{
+			name:       "not approved",
+			wantState:  model.StateDryRun,
+			wantReason: "Changes not approved",
+		},
+		{
+			name:       "review failed",
+			approveErr: errors.New("no terminal"),
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mockaws.NewCloudformationer(t)
+			onChangeSet(client, types.ChangeSetStatusCreateComplete, "", types.Change{
+				ResourceChange: &types.ResourceChange{
+					Action:            types.ChangeActionModify,
+					LogicalResourceId: aws.String("Bucket"),
+					ResourceType:      aws.String("AWS::S3::Bucket"),
+					Replacement:       types.ReplacementTrue,
+					Scope:             []types.ResourceAttribute{types.ResourceAttributeProperties},
+				},
+			})
+			if tt.wantExecute {
+				client.On("ExecuteChangeSet", mock.Anything, mock.Anything).Return(&cloudformation.ExecuteChangeSetOutput{}, nil)
+			} else {
+				client.On("DeleteChangeSet", mock.Anything, mock.Anything).Return(&cloudformation.DeleteChangeSetOutput{}, nil)
+			}
+			r := newTestCloudFormationRepo(client)
+
+			var reviewed []model.ResourceChange
+			approve := func(stackName string, changes []model.ResourceChange) (bool, error) {
+				reviewed = changes
+				return tt.approved, tt.approveErr
+			}
+
+			stackInfo, err := r.ReviewUpdateStack(context.Background(), "dev-app", newTestCfStack(t, cfTestTemplate), nil,
+				nil, approve)
+			assert.Equal(t, []model.ResourceChange{
+				{
+					Action:       "Modify",
+					LogicalId:    "Bucket",
+					ResourceType: "AWS::S3::Bucket",
+					Replacement:  "True",
+					Scope:        []string{"Properties"},
+				},
+			}, reviewed)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "no terminal")
+				client.AssertNotCalled(t, "ExecuteChangeSet", mock.Anything, mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantState, stackInfo.DeployStatus.State)
+			assert.Equal(t, tt.wantReason, stackInfo.DeployStatus.Reason)
+			assert.Len(t, stackInfo.Changes, 1)
+		})
+	}
+}
+
+var cfTestStart = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// cfTestEvent returns a stack event, minutes after the test start time
+func cfTestEvent(id string, logicalId string, status types.ResourceStatus, reason string, minutes int) types.StackEvent {
+	return types.StackEvent{
+		EventId:              aws.String(id),
+		StackName:            aws.String("dev-app"),
+		LogicalResourceId:    aws.String(logicalId),
+		ResourceType:         aws.String("AWS::S3::Bucket"),
+		ResourceStatus:       status,
+		ResourceStatusReason: aws.String(reason),
+		Timestamp:            aws.Time(cfTestStart.Add(time.Duration(minutes) * time.Minute)),
+	}
+}
+
+func TestCloudFormationRepo_GetStackEvents(t *testing.T) {
+	client := mockaws.NewCloudformationer(t)
+	client.On("DescribeStackEvents", mock.Anything, mock.MatchedBy(func(input *cloudformation.DescribeStackEventsInput) bool {
+		return input.NextToken == nil
+	})).Return(&cloudformation.DescribeStackEventsOutput{
+		StackEvents: []types.StackEvent{
+			cfTestEvent("4", "Bucket", types.ResourceStatusCreateComplete, "", 4),
+			cfTestEvent("3", "Bucket", types.ResourceStatusCreateInProgress, "", 3),
+		},
+		NextToken: aws.String("page2"),
+	}, nil).Once()
+	client.On("DescribeStackEvents", mock.Anything, mock.MatchedBy(func(input *cloudformation.DescribeStackEventsInput) bool {
+		return aws.ToString(input.NextToken) == "page2"
+	})).Return(&cloudformation.DescribeStackEventsOutput{
+		StackEvents: []types.StackEvent{
+			cfTestEvent("2", "dev-app", types.ResourceStatusCreateInProgress, "User Initiated", 2),
+			cfTestEvent("1", "dev-app", types.ResourceStatusDeleteComplete, "", 1),
+		},
+		NextToken: aws.String("page3"),
+	}, nil).Once()
+	r := newTestCloudFormationRepo(client)
+
+	// The third page is older than since, so it isn't read
+	events, err := r.GetStackEvents(context.Background(), "dev-app", cfTestStart.Add(2*time.Minute))
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	assert.Equal(t, []string{"2", "3", "4"}, ids)
+	assert.Equal(t, "dev-app", events[0].StackName)
+	assert.Equal(t, cfTestStart.Add(2*time.Minute), events[0].Timestamp)
+}
+
+func TestCloudFormationRepo_StackFailedErr(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []types.StackEvent
+		err     error
+		wantErr string
+	}{
+		{
+			name: "first failed resource",
+			events: []types.StackEvent{
+				cfTestEvent("6", "dev-app", types.ResourceStatusRollbackInProgress, "The following resource(s) failed", 6),
+				cfTestEvent("5", "Queue", types.ResourceStatusCreateFailed, "Resource creation cancelled", 5),
+				cfTestEvent("4", "Bucket", types.ResourceStatusCreateFailed, "app-bucket already exists", 4),
+				cfTestEvent("3", "Bucket", types.ResourceStatusCreateInProgress, "", 3),
+				cfTestEvent("2", "dev-app", types.ResourceStatusCreateInProgress, "User Initiated", 2),
+				cfTestEvent("1", "Topic", types.ResourceStatusUpdateFailed, "from an older operation", 1),
+			},
+			wantErr: "stack dev-app failed: Bucket CREATE_FAILED (AWS::S3::Bucket): app-bucket already exists",
+		},
+		{
+			name: "no failed resource",
+			events: []types.StackEvent{
+				cfTestEvent("2", "dev-app", types.ResourceStatusRollbackInProgress, "", 2),
+				cfTestEvent("1", "dev-app", types.ResourceStatusCreateInProgress, "User Initiated", 1),
+			},
+			wantErr: "stack dev-app failed",
+		},
+		{
+			name:    "events not readable",
+			err:     errors.New("access denied"),
+			wantErr: "stack dev-app failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mockaws.NewCloudformationer(t)
+			client.On("DescribeStackEvents", mock.Anything, mock.MatchedBy(func(input *cloudformation.DescribeStackEventsInput) bool {
+				return aws.ToString(input.StackName) == "stack-id"
+			})).Return(&cloudformation.DescribeStackEventsOutput{StackEvents: tt.events}, tt.err)
+			r := newTestCloudFormationRepo(client)
+
+			err := r.stackFailedErr(context.Background(), "dev-app", "stack-id")
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCloudFormationRepo_CreateStackCfConfig(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	assert.NoError(t, os.WriteFile(policyFile, []byte(`{"Statement":[]}`), 0600))
+	alarmArn := "arn:aws:cloudwatch:us-east-1:111111111111:alarm:errors"
+
+	tests := []struct {
+		name     string
+		defaults *model.CloudFormationConfig
+		cfConfig *model.CloudFormationConfig
+		want     cloudformation.CreateStackInput
+		wantErr  bool
+	}{
+		{
+			name: "defaults",
+			want: cloudformation.CreateStackInput{
+				OnFailure:    types.OnFailureDelete,
+				Capabilities: []types.Capability{types.CapabilityCapabilityNamedIam},
+			},
+		},
+		{
+			name: "enclave defaults",
+			defaults: &model.CloudFormationConfig{
+				RoleArn:          "arn:aws:iam::111111111111:role/Deploy",
+				NotificationArns: []string{"arn:aws:sns:us-east-1:111111111111:deploys"},
+			},
+			want: cloudformation.CreateStackInput{
+				OnFailure:        types.OnFailureDelete,
+				Capabilities:     []types.Capability{types.CapabilityCapabilityNamedIam},
+				RoleARN:          aws.String("arn:aws:iam::111111111111:role/Deploy"),
+				NotificationARNs: []string{"arn:aws:sns:us-east-1:111111111111:deploys"},
+			},
+		},
+		{
+			name: "stack settings",
+			defaults: &model.CloudFormationConfig{
+				RoleArn:          "arn:aws:iam::111111111111:role/Deploy",
+				NotificationArns: []string{"arn:aws:sns:us-east-1:111111111111:deploys"},
+			},
+			cfConfig: &model.CloudFormationConfig{
+				RoleArn:               "arn:aws:iam::111111111111:role/App",
+				Capabilities:          []string{model.CfCapabilityIam, model.CfCapabilityAutoExpand},
+				OnFailure:             model.CfOnFailureRollback,
+				StackPolicy:           "file://" + policyFile,
+				TerminationProtection: aws.Bool(true),
+				RollbackTriggers:      []model.RollbackTrigger{{Arn: alarmArn}},
+			},
+			want: cloudformation.CreateStackInput{
+				OnFailure: types.OnFailureRollback,
+				Capabilities: []types.Capability{
+					types.CapabilityCapabilityIam,
+					types.CapabilityCapabilityAutoExpand,
+				},
+				RoleARN:                     aws.String("arn:aws:iam::111111111111:role/App"),
+				NotificationARNs:            []string{"arn:aws:sns:us-east-1:111111111111:deploys"},
+				StackPolicyBody:             aws.String(`{"Statement":[]}`),
+				EnableTerminationProtection: aws.Bool(true),
+				RollbackConfiguration: &types.RollbackConfiguration{
+					RollbackTriggers: []types.RollbackTrigger{
+						{Arn: aws.String(alarmArn), Type: aws.String(model.CfRollbackTriggerAlarm)},
+					},
+				},
+			},
+		},
+		{
+			name: "disable rollback",
+			cfConfig: &model.CloudFormationConfig{
+				DisableRollback: aws.Bool(true),
+			},
+			want: cloudformation.CreateStackInput{
+				DisableRollback: aws.Bool(true),
+				Capabilities:    []types.Capability{types.CapabilityCapabilityNamedIam},
+			},
+		},
+		{
+			name: "invalid",
+			cfConfig: &model.CloudFormationConfig{
+				OnFailure:       model.CfOnFailureRollback,
+				DisableRollback: aws.Bool(true),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mockaws.NewCloudformationer(t)
+			var input *cloudformation.CreateStackInput
+			if !tt.wantErr {
+				client.On("GetTemplateSummary", mock.Anything, mock.Anything).Return(&cloudformation.GetTemplateSummaryOutput{}, nil)
+				client.On("CreateStack", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+					input = args.Get(1).(*cloudformation.CreateStackInput)
+				}).Return(&cloudformation.CreateStackOutput{StackId: aws.String("stack-id")}, nil)
+			}
+			r := newTestCloudFormationRepo(client)
+			r.cfConfig = tt.defaults
+			stack := newTestCfStack(t, cfTestTemplate)
+			stack.CfConfig = tt.cfConfig
+
+			_, err := r.CreateStack(context.Background(), "dev-app", stack, nil, nil, false)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.OnFailure, input.OnFailure)
+			assert.Equal(t, tt.want.DisableRollback, input.DisableRollback)
+			assert.Equal(t, tt.want.Capabilities, input.Capabilities)
+			assert.Equal(t, tt.want.RoleARN, input.RoleARN)
+			assert.Equal(t, tt.want.NotificationARNs, input.NotificationARNs)
+			assert.Equal(t, tt.want.StackPolicyBody, input.StackPolicyBody)
+			assert.Equal(t, tt.want.EnableTerminationProtection, input.EnableTerminationProtection)
+			assert.Equal(t, tt.want.RollbackConfiguration, input.RollbackConfiguration)
+		})
+	}
+}
+
+func TestCloudFormationRepo_UpdateStackCfConfig(t *testing.T) {
+	alarmArn := "arn:aws:cloudwatch:us-east-1:111111111111:alarm:errors"
+	client := mockaws.NewCloudformationer(t)
+	calls := []string{}
+	client.On("GetTemplateSummary", mock.Anything, mock.Anything).Return(&cloudformation.GetTemplateSummaryOutput{}, nil)
+	client.On("CreateChangeSet", mock.Anything, mock.MatchedBy(func(input *cloudformation.CreateChangeSetInput) bool {
+		return aws.ToString(input.RoleARN) == "arn:aws:iam::111111111111:role/App" &&
+			assert.ObjectsAreEqual([]types.Capability{types.CapabilityCapabilityIam}, input.Capabilities) &&
+			assert.ObjectsAreEqual([]string{"arn:aws:sns:us-east-1:111111111111:deploys"}, input.NotificationARNs) &&
+			aws.ToString(input.RollbackConfiguration.RollbackTriggers[0].Arn) == alarmArn
+	})).Return(&cloudformation.CreateChangeSetOutput{}, nil)
+	client.On("DescribeChangeSet", mock.Anything, mock.Anything).Return(&cloudformation.DescribeChangeSetOutput{
+		Status: types.ChangeSetStatusCreateComplete,
+	}, nil)
+	client.On("SetStackPolicy", mock.Anything, mock.MatchedBy(func(input *cloudformation.SetStackPolicyInput) bool {
+		return aws.ToString(input.StackPolicyURL) == "https://example.com/policy.json"
+	})).Run(func(args mock.Arguments) {
+		calls = append(calls, "SetStackPolicy")
+	}).Return(&cloudformation.SetStackPolicyOutput{}, nil)
+	client.On("UpdateTerminationProtection", mock.Anything, mock.MatchedBy(func(input *cloudformation.UpdateTerminationProtectionInput) bool {
+		return !aws.ToBool(input.EnableTerminationProtection)
+	})).Run(func(args mock.Arguments) {
+		calls = append(calls, "UpdateTerminationProtection")
+	}).Return(&cloudformation.UpdateTerminationProtectionOutput{}, nil)
+	client.On("ExecuteChangeSet", mock.Anything, mock.MatchedBy(func(input *cloudformation.ExecuteChangeSetInput) bool {
+		return aws.ToBool(input.DisableRollback)
+	})).Run(func(args mock.Arguments) {
+		calls = append(calls, "ExecuteChangeSet")
+	}).Return(&cloudformation.ExecuteChangeSetOutput{}, nil)
+	r := newTestCloudFormationRepo(client)
+	r.cfConfig = &model.CloudFormationConfig{
+		RoleArn:          "arn:aws:iam::111111111111:role/Deploy",
+		NotificationArns: []string{"arn:aws:sns:us-east-1:111111111111:deploys"},
+	}
+	stack := newTestCfStack(t, cfTestTemplate)
+	stack.CfConfig = &model.CloudFormationConfig{
+		RoleArn:               "arn:aws:iam::111111111111:role/App",
+		Capabilities:          []string{model.CfCapabilityIam},
+		StackPolicy:           "https://example.com/policy.json",
+		TerminationProtection: aws.Bool(false),
+		RollbackTriggers:      []model.RollbackTrigger{{Arn: alarmArn}},
+		DisableRollback:       aws.Bool(true),
+	}
+
+	stackInfo, err := r.UpdateStack(context.Background(), "dev-app", stack, nil, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateUpdating, stackInfo.DeployStatus.State)
+
+	// The stack settings are applied before the change set so they cover the update
+	assert.Equal(t, []string{"SetStackPolicy", "UpdateTerminationProtection", "ExecuteChangeSet"}, calls)
+}
+
+func TestCloudFormationRepo_CompareTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		deployed string
+		want     []string
+	}{
+		{
+			name:     "same resources",
+			deployed: cfTestTemplate,
+			want:     []string{},
+		},
+		{
+			name:     "json template",
+			deployed: `{"Resources": {"Queue": {"Type": "AWS::SQS::Queue"}, "Bucket": {"Type": "AWS::S3::Bucket"}}}`,
+			want:     []string{},
+		},
+		{
+			name: "different resources",
+			deployed: `Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+  Queue:
+    Type: AWS::SNS::Topic
+  Table:
+    Type: AWS::DynamoDB::Table
+`,
+			want: []string{
+				"Queue is a AWS::SNS::Topic, the template has a AWS::SQS::Queue",
+				"Table (AWS::DynamoDB::Table) is not in the template",
+			},
+		},
+		{
+			name: "missing resource",
+			deployed: `Resources:
+  Queue:
+    Type: AWS::SQS::Queue
+`,
+			want: []string{"Bucket (AWS::S3::Bucket) is not deployed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mockaws.NewCloudformationer(t)
+			client.On("GetTemplate", mock.Anything, mock.Anything).Return(&cloudformation.GetTemplateOutput{
+				TemplateBody: aws.String(tt.deployed),
+			}, nil)
+			r := newTestCloudFormationRepo(client)
+
+			diffs, err := r.compareTemplate(context.Background(), "app-stack", newTestCfStack(t, cfTestTemplate).TemplateFile)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, diffs)
+		})
+	}
+}
+
+func TestCloudFormationRepo_AdoptStack(t *testing.T) {
+	metadata := map[string]string{
+		model.StackKeyEnvName:   "dev",
+		model.StackKeyStackName: "app",
+	}
+
+	tests := []struct {
+		name       string
+		status     types.StackStatus
+		tags       map[string]string
+		deployed   string
+		force      bool
+		dryRun     bool
+		wantState  model.State
+		wantUpdate bool
+		wantErr    string
+	}{
+		{
+			name:       "adopt",
+			status:     types.StackStatusCreateComplete,
+			tags:       map[string]string{"team": "web"},
+			deployed:   cfTestTemplate,
+			wantState:  model.StateUpdating,
+			wantUpdate: true,
+		},
+		{
+			name:      "dry run",
+			status:    types.StackStatusUpdateComplete,
+			deployed:  cfTestTemplate,
+			dryRun:    true,
+			wantState: model.StateDryRun,
+		},
+		{
+			name:      "already adopted",
+			status:    types.StackStatusUpdateRollbackComplete,
+			tags:      metadata,
+			deployed:  cfTestTemplate,
+			wantState: model.StateComplete,
+		},
+		{
+			name:   "template mismatch",
+			status: types.StackStatusCreateComplete,
+			deployed: `Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+`,
+			wantErr: "Queue (AWS::SQS::Queue) is not deployed",
+		},
+		{
+			name:       "forced without checking the template",
+			status:     types.StackStatusCreateComplete,
+			force:      true,
+			wantState:  model.StateUpdating,
+			wantUpdate: true,
+		},
+		{
+			name:    "stack in progress",
+			status:  types.StackStatusUpdateInProgress,
+			wantErr: "only stacks that are not changing can be adopted",
+		},
+		{
+			name:    "other environment",
+			status:  types.StackStatusCreateComplete,
+			tags:    map[string]string{model.StackKeyEnvName: "prod"},
+			wantErr: "already belongs to environment prod",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := []types.Tag{}
+			for k, v := range tt.tags {
+				tags = append(tags, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+			}
+
+			client := mockaws.NewCloudformationer(t)
+			client.On("DescribeStacks", mock.Anything, mock.Anything).Return(&cloudformation.DescribeStacksOutput{
+				Stacks: []types.Stack{
+					{
+						StackName:    aws.String("app-stack"),
+						StackId:      aws.String("stack-id"),
+						StackStatus:  tt.status,
+						Tags:         tags,
+						Capabilities: []types.Capability{types.CapabilityCapabilityIam},
+						Parameters: []types.Parameter{
+							{ParameterKey: aws.String("Size"), ParameterValue: aws.String("small")},
+						},
+					},
+				},
+			}, nil)
+			if tt.deployed != "" {
+				client.On("GetTemplate", mock.Anything, mock.Anything).Return(&cloudformation.GetTemplateOutput{
+					TemplateBody: aws.String(tt.deployed),
+				}, nil)
+			}
+			var input *cloudformation.UpdateStackInput
+			if tt.wantUpdate {
+				client.On("UpdateStack", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+					input = args.Get(1).(*cloudformation.UpdateStackInput)
+				}).Return(&cloudformation.UpdateStackOutput{}, nil)
+			}
+			r := newTestCloudFormationRepo(client)
+
+			stackInfo, err := r.AdoptStack(context.Background(), "app-stack", newTestCfStack(t, cfTestTemplate), metadata,
+				tt.force, tt.dryRun)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantState, stackInfo.DeployStatus.State)
+			if !tt.wantUpdate {
+				return
+			}
+
+			// Only the tags change, the existing tags are kept
+			assert.True(t, aws.ToBool(input.UsePreviousTemplate))
+			assert.Equal(t, []types.Parameter{{ParameterKey: aws.String("Size"), UsePreviousValue: aws.Bool(true)}},
+				input.Parameters)
+			assert.Equal(t, []types.Capability{types.CapabilityCapabilityIam}, input.Capabilities)
+			gotTags := map[string]string{}
+			for _, tag := range input.Tags {
+				gotTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+			wantTags := map[string]string{}
+			for k, v := range tt.tags {
+				wantTags[k] = v
+			}
+			for k, v := range metadata {
+				wantTags[k] = v
+			}
+			assert.Equal(t, wantTags, gotTags)
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+const (
+	composeAttrProject = "project"
+	// ComposeOutputLabel is the prefix of container labels that are returned as stack outputs
+	ComposeOutputLabel = "swiz.output."
+)
+
+var composeInvalidName = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// composeContainer is a container from docker compose ps
+type composeContainer struct {
+	ID         string `json:"ID"`
+	Service    string `json:"Service"`
+	State      string `json:"State"`
+	Health     string `json:"Health"`
+	ExitCode   int    `json:"ExitCode"`
+	Publishers []struct {
+		TargetPort    int `json:"TargetPort"`
+		PublishedPort int `json:"PublishedPort"`
+	} `json:"Publishers"`
+}
+
+// ComposeRepo runs each stack as a docker compose project so environments can be deployed locally. Compose has no
+// notion of an environment, so deployed stacks are kept in a swiz-managed state index. The state of a stack comes from
+// the health of its containers.
+type ComposeRepo struct {
+	index   *StateIndex
+	exec    execwrap.Execer
+	openUrl fileutil.FileUrlHelper
+}
+
+func NewComposeRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider) IacDeployer {
+	return &ComposeRepo{
+		index:   NewEnclaveStateIndex(enclave, model.IacTypeCompose),
+		exec:    execwrap.NewExec(),
+		openUrl: fileutil.NewFileUrlHelper(),
+	}
+}
+
+func (r *ComposeRepo) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.apply(ctx, name, stack, params, metadata, model.NextActionCreate, dryRun)
+}
+
+func (r *ComposeRepo) DeleteStack(ctx context.Context, name string, dryRun bool) (*model.StackInfo, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		if errors.Is(err, apperr.GenNotFoundError) {
+			// Nothing was deployed
+			return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Stack does not exist", ""), nil
+		}
+		return nil, err
+	}
+
+	if dryRun {
+		return newStackInfo(name, model.NextActionDelete, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	_, err = r.compose(ctx, rec, "down", "--volumes", "--remove-orphans")
+	if err != nil {
+		// Leave the failure in the index, waiting on the stack reports it
+		rec.State = model.StateFailed
+		rec.Reason = err.Error()
+		return newStackInfo(name, model.NextActionDelete, model.StateFailed, rec.Reason, ""), r.index.Put(rec)
+	}
+
+	err = r.index.Delete(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Project removed", ""), nil
+}
+
+func (r *ComposeRepo) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.apply(ctx, name, stack, params, metadata, model.NextActionUpdate, dryRun)
+}
+
+func (r *ComposeRepo) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.liveStackInfo(ctx, rec), nil
+}
+
+// GetStackOutputs returns the published port of each container port as <service>_<port>, and the value of each
+// swiz.output.<name> label as <name>
+func (r *ComposeRepo) GetStackOutputs(ctx context.Context, name string) (map[string]string, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := r.containers(ctx, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := map[string]string{}
+	ids := []string{}
+	for _, c := range containers {
+		for _, p := range c.Publishers {
+			if p.PublishedPort != 0 {
+				retVal[fmt.Sprintf("%v_%v", c.Service, p.TargetPort)] = fmt.Sprint(p.PublishedPort)
+			}
+		}
+		ids = append(ids, c.ID)
+	}
+
+	labels, err := r.labels(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range labels {
+		if strings.HasPrefix(k, ComposeOutputLabel) {
+			retVal[strings.TrimPrefix(k, ComposeOutputLabel)] = v
+		}
+	}
+
+	return retVal, nil
+}
+
+func (r *ComposeRepo) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.StackSnapshot{
+		Name:       name,
+		Parameters: rec.Params,
+	}, nil
+}
+
+func (r *ComposeRepo) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	if snapshot != nil {
+		return nil, apperr.NewUnsupportedError("rolling back an update", model.IacTypeCompose)
+	}
+
+	// Compose runs to completion, there is never an update in progress to cancel
+	return r.GetStackInfo(ctx, name)
+}
+
+func (r *ComposeRepo) ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error) {
+	records, err := r.index.List(envName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stacks: %w", err)
+	}
+
+	retVal := []model.StackInfo{}
+	for i := range records {
+		retVal = append(retVal, *r.liveStackInfo(ctx, &records[i]))
+	}
+
+	return retVal, nil
+}
+
+func (r *ComposeRepo) ListEnvironments(ctx context.Context) ([]string, error) {
+	return r.index.ListEnvironments()
+}
+
+func (r *ComposeRepo) GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error) {
+	stacks, err := r.ListStacks(ctx, envName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get environment: %w", err)
+	}
+
+	return newEnvironmentInfo(envName, stacks)
+}
+
+// IsEnvironmentInState checks the live state of each stack, the same as GetStackInfo, so a container that stopped or
+// became unhealthy after the deploy is reported
+func (r *ComposeRepo) IsEnvironmentInState(ctx context.Context, envName string, stacks []string, states []model.State) (bool, []string, error) {
+	stackCompleteList := []string{}
+
+	for _, stackName := range stacks {
+		stackInfo, err := r.GetStackInfo(ctx, stackName)
+		if err != nil {
+			if errors.Is(err, apperr.GenNotFoundError) && r.index.hasState(states, model.StateDeleted) {
+				// Deleted stacks are removed from the index
+				stackCompleteList = append(stackCompleteList, stackName)
+				continue
+			}
+			return false, stackCompleteList, err
+		}
+
+		if r.index.hasState(states, stackInfo.DeployStatus.State) {
+			stackCompleteList = append(stackCompleteList, stackName)
+		} else if stackInfo.DeployStatus.State == model.StateFailed {
+			return false, nil, fmt.Errorf("stack %v failed: %v", stackName, stackInfo.DeployStatus.Reason)
+		}
+	}
+
+	return len(stackCompleteList) == len(stacks), stackCompleteList, nil
+}
+
+func (r *ComposeRepo) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	return "", apperr.NewUnsupportedError("drift detection", model.IacTypeCompose)
+}
+
+func (r *ComposeRepo) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	return nil, apperr.NewUnsupportedError("drift detection", model.IacTypeCompose)
+}
+
+// apply starts the project and waits for the containers to be running or healthy. A failure is recorded in the index
+// and reported when waiting on the stack.
+func (r *ComposeRepo) apply(ctx context.Context, name string, stack *model.StackConfig, params map[string]string,
+	metadata map[string]string, action model.NextAction, dryRun bool) (*model.StackInfo, error) {
+	rec := &model.StackRecord{
+		Name:     name,
+		EnvName:  metadata[model.StackKeyEnvName],
+		Template: stack.TemplateFile,
+		Params:   params,
+		Metadata: map[string]string{},
+		Outputs:  map[string]string{},
+		Attributes: map[string]string{
+			composeAttrProject: r.projectName(name),
+		},
+		State:  model.StateComplete,
+		Reason: "Running",
+	}
+
+	if dryRun {
+		_, err := r.compose(ctx, rec, "config", "--quiet")
+		if err != nil {
+			return nil, fmt.Errorf("invalid compose file: %w", err)
+		}
+		return newStackInfo(name, action, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	// Keep the create metadata on update
+	existing, err := r.index.Get(name)
+	if err == nil {
+		for k, v := range existing.Metadata {
+			rec.Metadata[k] = v
+		}
+	}
+	for k, v := range metadata {
+		rec.Metadata[k] = v
+	}
+
+	args := []string{"up", "--detach", "--wait", "--remove-orphans"}
+	if stack.Timeout > 0 {
+		args = append(args, "--wait-timeout", fmt.Sprint(int(stack.Timeout.Seconds())))
+	}
+
+	_, err = r.compose(ctx, rec, args...)
+	if err != nil {
+		rec.State = model.StateFailed
+		rec.Reason = err.Error()
+	}
+
+	err = r.index.Put(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, action, rec.State, rec.Reason, stack.TemplateFile), nil
+}
+
+// liveStackInfo returns the stack info with the state taken from the containers. A failed deploy keeps its reason.
+func (r *ComposeRepo) liveStackInfo(ctx context.Context, rec *model.StackRecord) *model.StackInfo {
+	if rec.State != model.StateFailed {
+		containers, err := r.containers(ctx, rec)
+		if err != nil {
+			rec.State = model.StateUnknown
+			rec.Reason = err.Error()
+		} else {
+			rec.State, rec.Reason = r.containerState(containers)
+		}
+	}
+
+	stackInfo := rec.ToStackInfo()
+	return &stackInfo
+}
+
+// containerState sums up the health of the containers in a project
+func (r *ComposeRepo) containerState(containers []composeContainer) (model.State, string) {
+	if len(containers) == 0 {
+		return model.StateDeleted, "No containers"
+	}
+
+	state := model.StateComplete
+	unhealthy := []string{}
+	for _, c := range containers {
+		cState := model.StateComplete
+		switch {
+		case c.Health == "unhealthy", c.State == "dead", c.State == "exited" && c.ExitCode != 0:
+			cState = model.StateFailed
+		case c.Health == "starting", c.State == "created", c.State == "restarting":
+			cState = model.StateCreating
+		case c.State == "paused":
+			cState = model.StateUnknown
+		}
+
+		if cState != model.StateComplete {
+			state = state.GetPriority(cState)
+			unhealthy = append(unhealthy, fmt.Sprintf("%v[%v]", c.Service, strings.TrimSpace(c.State+" "+c.Health)))
+		}
+	}
+
+	if len(unhealthy) == 0 {
+		return state, "Running"
+	}
+
+	return state, strings.Join(unhealthy, ", ")
+}
+
+func (r *ComposeRepo) containers(ctx context.Context, rec *model.StackRecord) ([]composeContainer, error) {
+	out, err := r.compose(ctx, rec, "ps", "--all", "--format", "json")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list containers: %w", err)
+	}
+
+	// Older versions of compose print an array, newer ones a container per line
+	containers := []composeContainer{}
+	out = bytes.TrimSpace(out)
+	if bytes.HasPrefix(out, []byte("[")) {
+		err = json.Unmarshal(out, &containers)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse containers: %w", err)
+		}
+		return containers, nil
+	}
+
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		c := composeContainer{}
+		err = json.Unmarshal(line, &c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse containers: %w", err)
+		}
+		containers = append(containers, c)
+	}
+
+	return containers, nil
+}
+
+// labels returns the labels of the containers. docker compose ps joins the labels with commas, which can't be told
+// apart from commas in the values, so they are read with docker inspect instead.
+func (r *ComposeRepo) labels(ctx context.Context, ids []string) (map[string]string, error) {
+	retVal := map[string]string{}
+	if len(ids) == 0 {
+		return retVal, nil
+	}
+
+	out, err := r.exec.Run(ctx, execwrap.Cmd{
+		Name: "docker",
+		Args: append([]string{"inspect", "--type", "container", "--format", "{{json .Config.Labels}}"}, ids...),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to inspect containers: %w", err)
+	}
+
+	// A line of labels per container
+	for _, line := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		labels := map[string]string{}
+		err = json.Unmarshal(line, &labels)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse container labels: %w", err)
+		}
+		for k, v := range labels {
+			retVal[k] = v
+		}
+	}
+
+	return retVal, nil
+}
+
+// compose runs docker compose on the project with the params as environment variables for interpolation
+func (r *ComposeRepo) compose(ctx context.Context, rec *model.StackRecord, args ...string) ([]byte, error) {
+	file, err := r.composeFile(rec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.exec.Run(ctx, execwrap.Cmd{
+		Name: "docker",
+		Args: append([]string{"compose", "--project-name", rec.Attributes[composeAttrProject], "--file", file}, args...),
+		Env:  rec.Params,
+	})
+}
+
+func (r *ComposeRepo) composeFile(template string) (string, error) {
+	scheme, err := r.openUrl.GetScheme(template)
+	if err != nil {
+		return "", err
+	}
+	if scheme != "file" {
+		return "", fmt.Errorf("compose files must be local, got %v", template)
+	}
+
+	return r.openUrl.GetPathFromUrl(template, true)
+}
+
+// projectName makes a stack name valid as a compose project name
+func (r *ComposeRepo) projectName(name string) string {
+	return strings.Trim(composeInvalidName.ReplaceAllString(strings.ToLower(name), "-"), "-_")
+}
@@ -0,0 +1,203 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+func newTestComposeRepo(t *testing.T, exec execwrap.Execer) *ComposeRepo {
+	return &ComposeRepo{
+		index:   NewStateIndex("file://" + t.TempDir() + "/compose.json"),
+		exec:    exec,
+		openUrl: fileutil.NewFileUrlHelper(),
+	}
+}
+
+// composePs answers docker compose ps with out and any other compose command with no output
+func composePs(out string) func(cmd execwrap.Cmd) ([]byte, error) {
+	return func(cmd execwrap.Cmd) ([]byte, error) {
+		for _, arg := range cmd.Args {
+			if arg == "ps" {
+				return []byte(out), nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+func TestComposeRepo_ContainerState(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []composeContainer
+		wantState  model.State
+		wantReason string
+	}{
+		{
+			name:       "no containers",
+			wantState:  model.StateDeleted,
+			wantReason: "No containers",
+		},
+		{
+			name: "running and healthy",
+			containers: []composeContainer{
+				{Service: "web", State: "running", Health: "healthy"},
+				{Service: "db", State: "running"},
+				{Service: "migrate", State: "exited", ExitCode: 0},
+			},
+			wantState:  model.StateComplete,
+			wantReason: "Running",
+		},
+		{
+			name: "starting",
+			containers: []composeContainer{
+				{Service: "web", State: "running", Health: "starting"},
+				{Service: "db", State: "running"},
+			},
+			wantState:  model.StateCreating,
+			wantReason: "web[running starting]",
+		},
+		{
+			name: "failed wins over starting",
+			containers: []composeContainer{
+				{Service: "web", State: "running", Health: "starting"},
+				{Service: "migrate", State: "exited", ExitCode: 1},
+			},
+			wantState:  model.StateFailed,
+			wantReason: "web[running starting], migrate[exited]",
+		},
+		{
+			name: "unhealthy",
+			containers: []composeContainer{
+				{Service: "web", State: "running", Health: "unhealthy"},
+			},
+			wantState:  model.StateFailed,
+			wantReason: "web[running unhealthy]",
+		},
+	}
+
+	r := &ComposeRepo{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, reason := r.containerState(tt.containers)
+			assert.Equal(t, tt.wantState, state)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+// composeInspect answers docker inspect with labels and the rest like composePs
+func composeInspect(ps string, labels string) func(cmd execwrap.Cmd) ([]byte, error) {
+	return func(cmd execwrap.Cmd) ([]byte, error) {
+		if cmd.Args[0] == "inspect" {
+			return []byte(labels), nil
+		}
+		return composePs(ps)(cmd)
+	}
+}
+
+func TestComposeRepo_GetStackOutputs(t *testing.T) {
+	labels := `{"swiz.output.url":"http://localhost/?a=1,b=2","com.docker.compose.project":"dev-app"}
+null
+`
+	tests := []struct {
+		name string
+		ps   string
+	}{
+		{
+			name: "container per line",
+			ps: `{"ID":"a1","Service":"web","State":"running","Labels":"swiz.output.url=http://localhost/?a=1,b=2,com.docker.compose.project=dev-app","Publishers":[{"TargetPort":80,"PublishedPort":8080},{"TargetPort":443,"PublishedPort":0}]}
+{"ID":"b2","Service":"db","State":"running","Labels":"","Publishers":[{"TargetPort":5432,"PublishedPort":15432}]}
+`,
+		},
+		{
+			name: "array",
+			ps: `[{"ID":"a1","Service":"web","State":"running","Labels":"swiz.output.url=http://localhost/?a=1,b=2,com.docker.compose.project=dev-app","Publishers":[{"TargetPort":80,"PublishedPort":8080},{"TargetPort":443,"PublishedPort":0}]},
+{"ID":"b2","Service":"db","State":"running","Labels":"","Publishers":[{"TargetPort":5432,"PublishedPort":15432}]}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := &fakeExec{respond: composeInspect(tt.ps, labels)}
+			r := newTestComposeRepo(t, exec)
+			_, err := r.CreateStack(context.Background(), "Dev-App", &model.StackConfig{
+				Name:         "app",
+				TemplateFile: "file://" + t.TempDir() + "/compose.yaml",
+			}, nil, nil, false)
+			assert.NoError(t, err)
+
+			outputs, err := r.GetStackOutputs(context.Background(), "Dev-App")
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{
+				"web_80":  "8080",
+				"db_5432": "15432",
+				"url":     "http://localhost/?a=1,b=2",
+			}, outputs)
+			assert.Equal(t, []string{"inspect", "--type", "container", "--format", "{{json .Config.Labels}}", "a1", "b2"},
+				exec.find("inspect").Args)
+		})
+	}
+}
+
+func TestComposeRepo_IsEnvironmentInState(t *testing.T) {
+	tests := []struct {
+		name         string
+		ps           string
+		states       []model.State
+		wantComplete bool
+		wantErr      bool
+	}{
+		{
+			name:         "healthy containers are complete",
+			ps:           `{"Service":"web","State":"running","Health":"healthy"}`,
+			states:       []model.State{model.StateComplete},
+			wantComplete: true,
+		},
+		{
+			name:   "starting containers are not complete",
+			ps:     `{"Service":"web","State":"running","Health":"starting"}`,
+			states: []model.State{model.StateComplete},
+		},
+		{
+			name:    "container that stopped after the deploy fails",
+			ps:      `{"Service":"web","State":"exited","ExitCode":137}`,
+			states:  []model.State{model.StateComplete},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := &fakeExec{respond: composePs(tt.ps)}
+			r := newTestComposeRepo(t, exec)
+			_, err := r.CreateStack(context.Background(), "dev-app", &model.StackConfig{
+				Name:         "app",
+				TemplateFile: "file://" + t.TempDir() + "/compose.yaml",
+			}, nil, nil, false)
+			assert.NoError(t, err)
+
+			complete, _, err := r.IsEnvironmentInState(context.Background(), "dev", []string{"dev-app"}, tt.states)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantComplete, complete)
+
+			// The state comes from the containers, not the index
+			cmds := exec.commands()
+			assert.Contains(t, cmds[len(cmds)-1], "--project-name dev-app")
+			assert.Contains(t, cmds[len(cmds)-1], "ps --all --format json")
+		})
+	}
+
+	t.Run("deleted stacks are removed from the index", func(t *testing.T) {
+		r := newTestComposeRepo(t, &fakeExec{})
+		complete, list, err := r.IsEnvironmentInState(context.Background(), "dev", []string{"dev-app"},
+			[]model.State{model.StateDeleted})
+		assert.NoError(t, err)
+		assert.True(t, complete)
+		assert.Equal(t, []string{"dev-app"}, list)
+	})
+}
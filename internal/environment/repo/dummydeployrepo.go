@@ -5,6 +5,7 @@ import (
 	"fmt"
 	appcli "github.com/swizzleio/swiz/pkg/cli"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/swizzleio/swiz/internal/appconfig"
@@ -22,6 +23,7 @@ type DummyDeployRepo struct {
 	stacks  map[string]*DummyStack
 	enclave model.Enclave
 	cl      appcli.SwizClier
+	mu      sync.Mutex
 }
 
 func NewDummyDeployRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider) IacDeployer {
@@ -41,9 +43,12 @@ func (r *DummyDeployRepo) outputParams(params map[string]string) string {
 	return output
 }
 
-func (r *DummyDeployRepo) CreateStack(ctx context.Context, name string, template string,
+func (r *DummyDeployRepo) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
 	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
-	r.cl.Info("CreateStack: %v with template %v in enclave %v. Params:\n", name, template, r.enclave.Name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cl.Info("CreateStack: %v with template %v in enclave %v. Params:\n", name, stack.TemplateFile, r.enclave.Name)
 	r.cl.Info("Metadata:\n%v\n", r.outputParams(metadata))
 
 	/*
@@ -128,9 +133,9 @@ func (r *DummyDeployRepo) DeleteStack(ctx context.Context, name string, dryRun b
 	}, nil
 }
 
-func (r *DummyDeployRepo) UpdateStack(ctx context.Context, name string, template string,
+func (r *DummyDeployRepo) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
 	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
-	r.cl.Info("UpdateStack: %v with template %v in enclave %v. Params: \n", name, template, r.enclave.Name)
+	r.cl.Info("UpdateStack: %v with template %v in enclave %v. Params: \n", name, stack.TemplateFile, r.enclave.Name)
 	r.cl.Info("Metadata:\n%v\n", r.outputParams(metadata))
 
 	return &model.StackInfo{
@@ -147,6 +152,9 @@ func (r *DummyDeployRepo) UpdateStack(ctx context.Context, name string, template
 }
 
 func (r *DummyDeployRepo) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.cl.Info("GetStackInfo: %v in enclave %v\n", name, r.enclave.Name)
 
 	if r.stacks[name] == nil {
@@ -169,6 +177,9 @@ func (r *DummyDeployRepo) GetStackInfo(ctx context.Context, name string) (*model
 }
 
 func (r *DummyDeployRepo) GetStackOutputs(ctx context.Context, name string) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.cl.Info("GetStackOutputs: %v in enclave %v\n", name, r.enclave.Name)
 
 	if r.stacks[name] == nil {
@@ -181,6 +192,39 @@ func (r *DummyDeployRepo) GetStackOutputs(ctx context.Context, name string) (map
 	return outputs, nil
 }
 
+func (r *DummyDeployRepo) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cl.Info("GetStackSnapshot: %v in enclave %v\n", name, r.enclave.Name)
+
+	if r.stacks[name] == nil {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+
+	return &model.StackSnapshot{
+		Name:         name,
+		TemplateBody: "",
+		Parameters:   map[string]string{},
+	}, nil
+}
+
+func (r *DummyDeployRepo) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	r.cl.Info("RollbackStack: %v in enclave %v\n", name, r.enclave.Name)
+
+	return &model.StackInfo{
+		Name: name,
+		DeployStatus: model.DeployStatus{
+			Name:    name,
+			State:   model.StateRolledBack,
+			Reason:  "It's done",
+			Details: "An awesome stack has been rolled back",
+		},
+		NextAction: model.NextActionUpdate,
+		Resources:  []string{},
+	}, nil
+}
+
 func (r *DummyDeployRepo) ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error) {
 	r.cl.Info("ListStacks: %v in enclave %v\n", envName, r.enclave.Name)
 
@@ -224,6 +268,9 @@ func (r *DummyDeployRepo) ListStacks(ctx context.Context, envName string) ([]mod
 }
 
 func (r *DummyDeployRepo) ListEnvironments(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.cl.Info("ListEnvironments in enclave %v\n", r.enclave.Name)
 
 	envList := []string{}
@@ -240,6 +287,9 @@ func (r *DummyDeployRepo) ListEnvironments(ctx context.Context) ([]string, error
 }
 
 func (r *DummyDeployRepo) GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.cl.Info("GetEnvironment: %v in enclave %v\n", envName, r.enclave.Name)
 
 	env := r.envs[envName]
@@ -288,6 +338,9 @@ func (r *DummyDeployRepo) GetEnvironment(ctx context.Context, envName string) (*
 }
 
 func (r *DummyDeployRepo) IsEnvironmentInState(ctx context.Context, envName string, stacks []string, states []model.State) (bool, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	// check to see if r.deployTime[name] is past the current time
 	// if it is, then set the state to complete
 	// if it isn't, then set the state to in progress
@@ -318,3 +371,20 @@ func (r *DummyDeployRepo) IsEnvironmentInState(ctx context.Context, envName stri
 
 	return len(stackCompleteList) == len(stacks), stackCompleteList, nil
 }
+
+func (r *DummyDeployRepo) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	r.cl.Info("DetectStackDrift: %v in enclave %v\n", name, r.enclave.Name)
+
+	return name, nil
+}
+
+func (r *DummyDeployRepo) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	r.cl.Info("GetStackDrift: %v in enclave %v\n", name, r.enclave.Name)
+
+	return &model.StackDrift{
+		Name:            name,
+		Complete:        true,
+		Status:          model.DriftStatusInSync,
+		DetectionStatus: model.DriftDetectionComplete,
+	}, nil
+}
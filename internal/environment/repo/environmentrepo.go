@@ -2,11 +2,16 @@ package repo
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
 	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/configutil"
 	"github.com/swizzleio/swiz/pkg/errtype"
 	"github.com/swizzleio/swiz/pkg/fileutil"
+	"github.com/swizzleio/swiz/pkg/preprocessor"
+	"gopkg.in/yaml.v3"
 )
 
 type EnvironmentRepo struct {
@@ -36,8 +41,8 @@ func (r *EnvironmentRepo) Bootstrap() error {
 		if err != nil {
 			// There is an error in the environment definition, this should not be fatal
 			errList.Add(err)
-		} else {
-
+		} else if err = r.resolveEnclaves(yamlData); err != nil {
+			errList.Add(err)
 		}
 
 		yamlData.EnvDefName = envDef.Name
@@ -61,7 +66,7 @@ func (r *EnvironmentRepo) GetEnvironmentByDef(envDef string) (*model.Environment
 
 	// Populate stack definition
 	if envCfg.Stacks == nil {
-		envCfg.Stacks = map[string]*model.StackConfig{}
+		stacks := map[string]*model.StackConfig{}
 
 		// Load stack files
 		for _, stackCfg := range envCfg.StackCfgDef {
@@ -78,12 +83,218 @@ func (r *EnvironmentRepo) GetEnvironmentByDef(envDef string) (*model.Environment
 			}
 
 			stack.TemplateFile = templateFile
+			if stack.Build != nil {
+				err = stack.Build.Validate()
+				if err != nil {
+					return nil, fmt.Errorf("stack %v: %w", stackCfg.Name, err)
+				}
+
+				stack.Build.SourceDir, err = r.openUrl.UrlWithBaseDir(r.config.BaseDir,
+					configutil.SetOrDefault(stack.Build.SourceDir, "file://."))
+				if err != nil {
+					return nil, err
+				}
+			}
+			if stack.CfConfig != nil {
+				err = r.resolveCfConfig(stack.CfConfig)
+				if err != nil {
+					return nil, fmt.Errorf("stack %v: %w", stackCfg.Name, err)
+				}
+			}
+			if stack.Script != nil {
+				stack.Script.Dir, err = r.openUrl.UrlWithBaseDir(r.config.BaseDir,
+					configutil.SetOrDefault(stack.Script.Dir, "file://."))
+				if err != nil {
+					return nil, err
+				}
+			}
 			stack.Name = stackCfg.Name
 			stack.RawName = stackCfg.Name
 			stack.Order = stackCfg.Order
-			envCfg.Stacks[stackCfg.Name] = stack
+			stack.DependsOn = stackCfg.DependsOn
+			stack.Timeout = stackCfg.Timeout
+			stack.Iac = stackCfg.Iac
+			stack.Provider = stackCfg.Provider
+			stack.Region = stackCfg.Region
+			stack.Regions = stackCfg.Regions
+			if stack.StackSet != nil {
+				err = stack.StackSet.Validate()
+				if err != nil {
+					return nil, fmt.Errorf("stack %v: %w", stackCfg.Name, err)
+				}
+				if len(stack.Regions) > 0 {
+					return nil, fmt.Errorf("stack %v: a stack set sets its regions in the stack_set block", stackCfg.Name)
+				}
+
+				// A stack set block picks the stack set deployer unless the IaC type is set
+				stack.Iac = configutil.SetOrDefault(stack.Iac, model.IacTypeCfSet)
+			}
+			stacks[stackCfg.Name] = stack
+		}
+
+		// Stacks deployed to several regions get a copy per region
+		stacks, err := model.ExpandRegions(stacks)
+		if err != nil {
+			return nil, err
+		}
+
+		// Validate the graph before it is used
+		err = r.validateOutputRefs(envCfg, stacks)
+		if err != nil {
+			return nil, err
 		}
+
+		_, err = model.NewDependencyGraph(stacks)
+		if err != nil {
+			return nil, err
+		}
+
+		envCfg.Stacks = stacks
 	}
 
 	return envCfg, nil
 }
+
+// validateOutputRefs checks every {{stack_name.output_name}} param. The referenced stack must exist and must not
+// depend on the stack using it, through depends_on or the order buckets. If the referenced stack's template can be
+// read, the output must be declared in it.
+func (r *EnvironmentRepo) validateOutputRefs(envCfg *model.EnvironmentConfig, stacks map[string]*model.StackConfig) error {
+	templateOutputs := map[string]map[string]bool{}
+
+	// References are left out of the graph since each one adds an edge from the referenced stack
+	ordered := map[string]*model.StackConfig{}
+	for name, stack := range stacks {
+		copied := *stack
+		copied.Parameters = nil
+		ordered[name] = &copied
+	}
+	graph, err := model.NewDependencyGraph(ordered)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range r.sortedStackNames(stacks) {
+		stack := stacks[name]
+		for paramName, value := range stack.Parameters {
+			refStack, refOutput, ok := preprocessor.ParseOutputRef(value)
+			if !ok {
+				continue
+			}
+
+			producer, ok := stacks[refStack]
+			if !ok {
+				if r.isEnclaveParam(envCfg, preprocessor.CleanTemplateParam(value)) {
+					// Dotted global param, not an output reference
+					continue
+				}
+				return fmt.Errorf("stack %v param %v: %w", name, paramName, apperr.NewNotFoundError("stack", refStack))
+			}
+
+			for _, upstream := range graph.Upstream([]string{refStack}) {
+				if upstream == name {
+					return fmt.Errorf("stack %v uses outputs from stack %v which depends on it", name, refStack)
+				}
+			}
+
+			if _, ok = templateOutputs[refStack]; !ok {
+				templateOutputs[refStack] = r.getTemplateOutputs(producer)
+			}
+
+			outputs := templateOutputs[refStack]
+			if outputs != nil && !outputs[refOutput] {
+				return fmt.Errorf("stack %v param %v: %w", name, paramName,
+					apperr.NewNotFoundError("output", fmt.Sprintf("%v.%v", refStack, refOutput)))
+			}
+		}
+	}
+
+	return nil
+}
+
+// getTemplateOutputs returns the outputs declared in the stack config, or else in a local CloudFormation template. nil is
+// returned if the outputs cannot be determined, such as for remote templates or templates for other IaC types.
+func (r *EnvironmentRepo) getTemplateOutputs(stack *model.StackConfig) map[string]bool {
+	if len(stack.Outputs) > 0 {
+		retVal := map[string]bool{}
+		for k := range stack.Outputs {
+			retVal[k] = true
+		}
+		return retVal
+	}
+
+	templateFile := stack.TemplateFile
+	scheme, err := r.openUrl.GetScheme(templateFile)
+	if err != nil || scheme != "file" {
+		return nil
+	}
+
+	data, err := r.openUrl.OpenUrl(templateFile)
+	if err != nil {
+		return nil
+	}
+
+	// Nodes are used so CloudFormation short form tags such as !GetAtt don't need to be understood
+	template := struct {
+		Resources yaml.Node            `yaml:"Resources"`
+		Outputs   map[string]yaml.Node `yaml:"Outputs"`
+	}{}
+	if err = yaml.Unmarshal(data, &template); err != nil || template.Resources.Kind == 0 {
+		return nil
+	}
+
+	retVal := map[string]bool{}
+	for k := range template.Outputs {
+		retVal[k] = true
+	}
+
+	return retVal
+}
+
+// resolveEnclaves checks the CloudFormation defaults of each enclave and makes their stack policy relative to the base
+// directory
+func (r *EnvironmentRepo) resolveEnclaves(envCfg *model.EnvironmentConfig) error {
+	for _, enclave := range envCfg.EnclaveDefinition {
+		if enclave.CfConfig == nil {
+			continue
+		}
+
+		err := r.resolveCfConfig(enclave.CfConfig)
+		if err != nil {
+			return fmt.Errorf("enclave %v: %w", enclave.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *EnvironmentRepo) resolveCfConfig(cfConfig *model.CloudFormationConfig) error {
+	err := cfConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	if cfConfig.StackPolicy != "" {
+		cfConfig.StackPolicy, err = r.openUrl.UrlWithBaseDir(r.config.BaseDir, cfConfig.StackPolicy)
+	}
+
+	return err
+}
+
+func (r *EnvironmentRepo) isEnclaveParam(envCfg *model.EnvironmentConfig, paramName string) bool {
+	for _, enclave := range envCfg.EnclaveDefinition {
+		if _, ok := enclave.Parameters[paramName]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *EnvironmentRepo) sortedStackNames(stacks map[string]*model.StackConfig) []string {
+	names := []string{}
+	for name := range stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
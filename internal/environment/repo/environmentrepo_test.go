@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+func TestEnvironmentRepo_ValidateOutputRefs(t *testing.T) {
+	dir := t.TempDir()
+	templateFile := filepath.Join(dir, "boot.yaml")
+	err := os.WriteFile(templateFile, []byte(`Resources:
+  Vpc:
+    Type: AWS::EC2::VPC
+Outputs:
+  VpcId:
+    Value: !Ref Vpc
+`), 0600)
+	assert.NoError(t, err)
+
+	envCfg := &model.EnvironmentConfig{
+		EnclaveDefinition: []model.Enclave{
+			{
+				Name:       "dev",
+				Parameters: map[string]string{"vpc.id": "vpc-0123"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		stacks       map[string]*model.StackConfig
+		wantErr      bool
+		wantNotFound bool
+	}{
+		{
+			name: "reference to an earlier order",
+			stacks: map[string]*model.StackConfig{
+				"boot": {Order: 1, TemplateFile: "file://" + templateFile},
+				"app":  {Order: 2, Parameters: map[string]string{"VpcId": "{{boot.VpcId}}"}},
+			},
+		},
+		{
+			name: "depends_on with default orders",
+			stacks: map[string]*model.StackConfig{
+				"boot": {DependsOn: []string{}, TemplateFile: "file://" + templateFile},
+				"app": {DependsOn: []string{"boot"},
+					Parameters: map[string]string{"VpcId": "{{boot.VpcId}}"}},
+			},
+		},
+		{
+			name: "reference without depends_on in the same order",
+			stacks: map[string]*model.StackConfig{
+				"boot": {TemplateFile: "file://" + templateFile},
+				"app":  {Parameters: map[string]string{"VpcId": "{{boot.VpcId}}"}},
+			},
+		},
+		{
+			name: "unknown producer stack",
+			stacks: map[string]*model.StackConfig{
+				"app": {Parameters: map[string]string{"VpcId": "{{nope.VpcId}}"}},
+			},
+			wantErr:      true,
+			wantNotFound: true,
+		},
+		{
+			name: "missing template output",
+			stacks: map[string]*model.StackConfig{
+				"boot": {Order: 1, TemplateFile: "file://" + templateFile},
+				"app":  {Order: 2, Parameters: map[string]string{"SubnetId": "{{boot.SubnetId}}"}},
+			},
+			wantErr:      true,
+			wantNotFound: true,
+		},
+		{
+			name: "missing declared output",
+			stacks: map[string]*model.StackConfig{
+				"boot": {Order: 1, Outputs: map[string]string{"VpcId": ""}},
+				"app":  {Order: 2, Parameters: map[string]string{"SubnetId": "{{boot.SubnetId}}"}},
+			},
+			wantErr:      true,
+			wantNotFound: true,
+		},
+		{
+			name: "declared output",
+			stacks: map[string]*model.StackConfig{
+				"boot": {Order: 1, Outputs: map[string]string{"VpcId": ""}},
+				"app":  {Order: 2, Parameters: map[string]string{"VpcId": "{{boot.VpcId}}"}},
+			},
+		},
+		{
+			name: "remote template outputs are not checked",
+			stacks: map[string]*model.StackConfig{
+				"boot": {Order: 1, TemplateFile: "https://example.com/boot.yaml"},
+				"app":  {Order: 2, Parameters: map[string]string{"SubnetId": "{{boot.SubnetId}}"}},
+			},
+		},
+		{
+			name: "order contradiction",
+			stacks: map[string]*model.StackConfig{
+				"boot": {Order: 2, TemplateFile: "file://" + templateFile},
+				"app":  {Order: 1, Parameters: map[string]string{"VpcId": "{{boot.VpcId}}"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "depends_on contradiction",
+			stacks: map[string]*model.StackConfig{
+				"boot": {DependsOn: []string{"app"}, TemplateFile: "file://" + templateFile},
+				"app":  {DependsOn: []string{}, Parameters: map[string]string{"VpcId": "{{boot.VpcId}}"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "dotted enclave param",
+			stacks: map[string]*model.StackConfig{
+				"app": {Parameters: map[string]string{"VpcId": "{{vpc.id}}"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewEnvironmentRepo(appconfig.AppConfig{})
+			err := r.validateOutputRefs(envCfg, tt.stacks)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.Error(t, err)
+			assert.Equal(t, tt.wantNotFound, errors.Is(err, apperr.GenNotFoundError))
+		})
+	}
+}
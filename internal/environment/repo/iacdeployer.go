@@ -2,6 +2,10 @@ package repo
 
 import (
 	"context"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/swizzleio/swiz/internal/appconfig"
 	"github.com/swizzleio/swiz/internal/apperr"
 	"github.com/swizzleio/swiz/internal/environment/model"
@@ -10,25 +14,50 @@ import (
 const defaultIacType = model.IacTypeCf
 
 type IacDeployer interface {
-	CreateStack(ctx context.Context, name string, template string, params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error)
+	CreateStack(ctx context.Context, name string, stack *model.StackConfig, params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error)
 	DeleteStack(ctx context.Context, name string, dryRun bool) (*model.StackInfo, error)
-	UpdateStack(ctx context.Context, name string, template string, params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error)
+	UpdateStack(ctx context.Context, name string, stack *model.StackConfig, params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error)
 	GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error)
 	GetStackOutputs(ctx context.Context, name string) (map[string]string, error)
+	GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error)
+	RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error)
 	ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error)
 	ListEnvironments(ctx context.Context) ([]string, error)
 	GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error)
 	IsEnvironmentInState(ctx context.Context, envName string, stacks []string, states []model.State) (bool, []string, error)
+	DetectStackDrift(ctx context.Context, name string) (string, error)
+	GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error)
+}
+
+// ChangeReviewer is implemented by deployers that can list the changes of an update before applying them. The update
+// is only applied if approve approves the changes, otherwise the stack is left as is with a DryRun state.
+type ChangeReviewer interface {
+	ReviewUpdateStack(ctx context.Context, name string, stack *model.StackConfig, params map[string]string, metadata map[string]string, approve model.ChangeApprover) (*model.StackInfo, error)
+}
+
+// StackEventer is implemented by deployers that report the events of a stack while an operation is in progress.
+// GetStackEvents returns the events at or after since, oldest first.
+type StackEventer interface {
+	GetStackEvents(ctx context.Context, name string, since time.Time) ([]model.StackEvent, error)
+}
+
+// StackAdopter is implemented by deployers that can take over stacks that were deployed outside of swiz. AdoptStack
+// checks a stack against the template of the stack config, unless force is set, and tags it with metadata without
+// changing anything else. ListStacks reports the stack an adopted stack was adopted as.
+type StackAdopter interface {
+	AdoptStack(ctx context.Context, name string, stack *model.StackConfig, metadata map[string]string, force bool, dryRun bool) (*model.StackInfo, error)
 }
 
 type iacRepoMapping struct {
 	provider string
+	region   string
 	iacType  string
 }
 
 type IacRepoFactory struct {
 	config appconfig.AppConfig
 	iacMap map[iacRepoMapping]IacDeployer
+	mu     sync.Mutex
 }
 
 func NewIacRepoFactory(config appconfig.AppConfig) *IacRepoFactory {
@@ -38,12 +67,18 @@ func NewIacRepoFactory(config appconfig.AppConfig) *IacRepoFactory {
 	}
 }
 
-func (f IacRepoFactory) GetDeployer(enclave model.Enclave, providerName string, iacType string) (IacDeployer, error) {
+// GetDeployer returns the deployer for an IaC type and provider. Empty values use the enclave defaults, and a region
+// overrides the region of the provider.
+func (f *IacRepoFactory) GetDeployer(enclave model.Enclave, providerName string, iacType string,
+	region string) (IacDeployer, error) {
 
 	provider := enclave.GetProvider(providerName)
 	if provider == nil {
 		return nil, apperr.NewNotFoundError("provider", providerName)
 	}
+	if region != "" {
+		provider.Region = region
+	}
 
 	if iacType == "" {
 		iacType = enclave.DefaultIac
@@ -53,18 +88,46 @@ func (f IacRepoFactory) GetDeployer(enclave model.Enclave, providerName string,
 	}
 
 	mapping := iacRepoMapping{
-		provider: providerName,
+		provider: provider.Name,
+		region:   provider.Region,
 		iacType:  iacType,
 	}
 
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	if f.iacMap[mapping] == nil {
 		switch iacType {
 		case model.IacTypeCf:
-			f.iacMap[mapping] = NewCloudFormationRepo(f.config, enclave, provider)
+			iacDeploy, err := NewCloudFormationRepo(f.config, enclave, provider)
+			if err != nil {
+				return nil, err
+			}
+			f.iacMap[mapping] = iacDeploy
+		case model.IacTypeCfSet:
+			iacDeploy, err := NewStackSetRepo(f.config, enclave, provider)
+			if err != nil {
+				return nil, err
+			}
+			f.iacMap[mapping] = iacDeploy
 		case model.IacTypeDummy:
 			f.iacMap[mapping] = NewDummyDeployRepo(f.config, enclave, provider)
+		case model.IacTypeTerraform:
+			f.iacMap[mapping] = NewTerraformRepo(f.config, enclave, provider, iacType, TerraformBinary)
+		case model.IacTypeOpenTofu:
+			f.iacMap[mapping] = NewTerraformRepo(f.config, enclave, provider, iacType, OpenTofuBinary)
+		case model.IacTypeK8s:
+			f.iacMap[mapping] = NewKubernetesRepo(f.config, enclave, provider)
+		case model.IacTypeScript:
+			f.iacMap[mapping] = NewScriptRepo(f.config, enclave, provider)
+		case model.IacTypeCompose:
+			f.iacMap[mapping] = NewComposeRepo(f.config, enclave, provider)
 		default:
-			return nil, apperr.NewNotFoundError("iac type", iacType)
+			pluginName, isPlugin := strings.CutPrefix(iacType, model.IacTypePlugin)
+			if !isPlugin || pluginName == "" {
+				return nil, apperr.NewNotFoundError("iac type", iacType)
+			}
+			f.iacMap[mapping] = NewPluginRepo(f.config, enclave, provider, pluginName)
 		}
 	}
 
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+var DefaultRunLocation = "file://~/.swiz/runs"
+
+const journalFileName = "deploy.json"
+
+// JournalRepo stores the deploy journal of each environment under <location>/<env name>/deploy.json
+type JournalRepo struct {
+	location string
+	openUrl  fileutil.FileUrlHelper
+	fh       fileutil.FileHelper
+}
+
+func NewJournalRepo(location string) *JournalRepo {
+	return &JournalRepo{
+		location: location,
+		openUrl:  fileutil.NewFileUrlHelper(),
+		fh:       fileutil.NewFileHelper(),
+	}
+}
+
+func (r *JournalRepo) GetJournal(envName string) (*model.DeployJournal, error) {
+	data, err := r.openUrl.OpenUrl(r.journalUrl(envName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, apperr.NewNotFoundError("deploy journal", envName)
+		}
+		return nil, fmt.Errorf("unable to open deploy journal: %w", err)
+	}
+
+	journal := &model.DeployJournal{}
+	err = json.Unmarshal(data, journal)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse deploy journal: %w", err)
+	}
+
+	if journal.Stacks == nil {
+		journal.Stacks = map[string]*model.JournalStack{}
+	}
+
+	return journal, nil
+}
+
+func (r *JournalRepo) SaveJournal(journal *model.DeployJournal) error {
+	location := r.journalUrl(journal.EnvName)
+	err := r.fh.CreateDirIfNotExist(location)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return r.openUrl.WriteUrl(location, data)
+}
+
+func (r *JournalRepo) journalUrl(envName string) string {
+	return fmt.Sprintf("%v/%v/%v", r.location, envName, journalFileName)
+}
@@ -0,0 +1,605 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+const (
+	k8sKindHelm      = "helm"
+	k8sKindKustomize = "kustomize"
+	k8sAttrKind      = "kind"
+	k8sAttrNamespace = "namespace"
+	k8sAttrRelease   = "release"
+)
+
+var k8sInvalidName = regexp.MustCompile(`[^a-z0-9-]+`)
+var k8sInvalidLabel = regexp.MustCompile(`[^A-Za-z0-9-_.]+`)
+
+// KubernetesRepo deploys each stack as a Helm release or a kustomize directory in a namespace per environment. Helm
+// tracks releases but not environments, so deployed stacks are also kept in a swiz-managed state index.
+type KubernetesRepo struct {
+	provider *model.EncProvider
+	creds    *awsCredentials
+	index    *StateIndex
+	exec     execwrap.Execer
+	openUrl  fileutil.FileUrlHelper
+}
+
+func NewKubernetesRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider) IacDeployer {
+	return &KubernetesRepo{
+		provider: provider,
+		creds:    newAwsCredentials(provider),
+		index:    NewEnclaveStateIndex(enclave, model.IacTypeK8s),
+		exec:     execwrap.NewExec(),
+		openUrl:  fileutil.NewFileUrlHelper(),
+	}
+}
+
+func (r *KubernetesRepo) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.apply(ctx, name, stack, params, metadata, model.NextActionCreate, dryRun)
+}
+
+func (r *KubernetesRepo) DeleteStack(ctx context.Context, name string, dryRun bool) (*model.StackInfo, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		if errors.Is(err, apperr.GenNotFoundError) {
+			// Nothing was deployed
+			return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Stack does not exist", ""), nil
+		}
+		return nil, err
+	}
+
+	ns := rec.Attributes[k8sAttrNamespace]
+	if rec.Attributes[k8sAttrKind] == k8sKindHelm {
+		args := []string{"uninstall", rec.Attributes[k8sAttrRelease], "--namespace", ns}
+		if dryRun {
+			args = append(args, "--dry-run")
+		}
+		_, err = r.helm(ctx, nil, args...)
+		if r.isReleaseNotFound(err) {
+			// Already uninstalled outside of swiz
+			err = nil
+		}
+	} else {
+		var manifests []byte
+		manifests, err = r.render(ctx, rec.Template, rec.Metadata)
+		if err == nil {
+			args := []string{"delete", "--namespace", ns, "--ignore-not-found", "-f", "-"}
+			if dryRun {
+				args = append(args, "--dry-run=client")
+			}
+			_, err = r.kubectl(ctx, manifests, args...)
+		}
+	}
+
+	if dryRun {
+		if err != nil {
+			return nil, fmt.Errorf("unable to plan stack delete: %w", err)
+		}
+		return newStackInfo(name, model.NextActionDelete, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	if err != nil {
+		// Leave the failure in the index, waiting on the stack reports it
+		rec.State = model.StateFailed
+		rec.Reason = err.Error()
+		return newStackInfo(name, model.NextActionDelete, model.StateFailed, rec.Reason, ""), r.index.Put(rec)
+	}
+
+	// The namespace is left in place, it may hold resources that swiz did not create
+	err = r.index.Delete(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Uninstalled", ""), nil
+}
+
+func (r *KubernetesRepo) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.apply(ctx, name, stack, params, metadata, model.NextActionUpdate, dryRun)
+}
+
+func (r *KubernetesRepo) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Helm knows the live state of the release. A release that is gone is not found, so it is created again.
+	if rec.Attributes[k8sAttrKind] == k8sKindHelm && rec.State != model.StateFailed {
+		rec.State, rec.Reason, err = r.releaseStatus(ctx, rec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stackInfo := rec.ToStackInfo()
+	return &stackInfo, nil
+}
+
+func (r *KubernetesRepo) GetStackOutputs(ctx context.Context, name string) (map[string]string, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := map[string]string{}
+	for output, ref := range rec.OutputRefs {
+		retVal[output], err = r.lookupOutput(ctx, rec.Attributes[k8sAttrNamespace], ref)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get output %v: %w", output, err)
+		}
+	}
+
+	return retVal, nil
+}
+
+func (r *KubernetesRepo) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// A release that is gone has nothing to roll back to
+	if rec.Attributes[k8sAttrKind] == k8sKindHelm {
+		_, _, err = r.releaseStatus(ctx, rec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &model.StackSnapshot{
+		Name:       name,
+		Parameters: rec.Params,
+	}, nil
+}
+
+func (r *KubernetesRepo) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot == nil {
+		// Upgrades run to completion, there is never an update in progress to cancel
+		stackInfo := rec.ToStackInfo()
+		return &stackInfo, nil
+	}
+
+	if rec.Attributes[k8sAttrKind] != k8sKindHelm {
+		return nil, apperr.NewUnsupportedError("rolling back an update", "kustomize directories")
+	}
+
+	// Revision 0 is the revision before the current one
+	_, err = r.helm(ctx, nil, "rollback", rec.Attributes[k8sAttrRelease], "0", "--namespace", rec.Attributes[k8sAttrNamespace])
+	if err != nil {
+		return nil, fmt.Errorf("unable to roll back release: %w", err)
+	}
+
+	rec.Params = snapshot.Parameters
+	rec.State = model.StateComplete
+	rec.Reason = "Rollback complete"
+	err = r.index.Put(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, model.NextActionUpdate, model.StateRolledBack, rec.Reason, rec.Template), nil
+}
+
+func (r *KubernetesRepo) ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error) {
+	return r.index.ListStacks(envName)
+}
+
+func (r *KubernetesRepo) ListEnvironments(ctx context.Context) ([]string, error) {
+	return r.index.ListEnvironments()
+}
+
+func (r *KubernetesRepo) GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error) {
+	return r.index.GetEnvironment(envName)
+}
+
+func (r *KubernetesRepo) IsEnvironmentInState(ctx context.Context, envName string, stacks []string, states []model.State) (bool, []string, error) {
+	return r.index.IsEnvironmentInState(stacks, states)
+}
+
+func (r *KubernetesRepo) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	return "", apperr.NewUnsupportedError("drift detection", model.IacTypeK8s)
+}
+
+func (r *KubernetesRepo) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	return nil, apperr.NewUnsupportedError("drift detection", model.IacTypeK8s)
+}
+
+// apply installs or upgrades the release, or applies the kustomize directory. Both run to completion, a failure is
+// recorded in the index and reported when waiting on the stack.
+func (r *KubernetesRepo) apply(ctx context.Context, name string, stack *model.StackConfig, params map[string]string,
+	metadata map[string]string, action model.NextAction, dryRun bool) (*model.StackInfo, error) {
+	dir, kind, err := r.sourceDir(stack.TemplateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &model.StackRecord{
+		Name:       name,
+		EnvName:    metadata[model.StackKeyEnvName],
+		Template:   stack.TemplateFile,
+		Params:     params,
+		Metadata:   map[string]string{},
+		Outputs:    map[string]string{},
+		OutputRefs: stack.Outputs,
+		Attributes: map[string]string{
+			k8sAttrKind:      kind,
+			k8sAttrNamespace: r.dnsName(metadata[model.StackKeyEnvName], 63),
+			k8sAttrRelease:   r.dnsName(name, 53),
+		},
+		State:  model.StateComplete,
+		Reason: "Deployed",
+	}
+
+	// Keep the create metadata on update
+	existing, err := r.index.Get(name)
+	if err == nil {
+		for k, v := range existing.Metadata {
+			rec.Metadata[k] = v
+		}
+	}
+	for k, v := range metadata {
+		rec.Metadata[k] = v
+	}
+
+	ns := rec.Attributes[k8sAttrNamespace]
+	if !dryRun {
+		err = r.createNamespace(ctx, ns, rec.Metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if kind == k8sKindHelm {
+		err = r.upgradeRelease(ctx, rec, dir, stack, dryRun)
+	} else {
+		var manifests []byte
+		manifests, err = r.render(ctx, stack.TemplateFile, rec.Metadata)
+		if err == nil {
+			args := []string{"apply", "--namespace", ns, "-f", "-"}
+			if dryRun {
+				args = append(args, "--dry-run=client")
+			}
+			_, err = r.kubectl(ctx, manifests, args...)
+		}
+	}
+
+	if dryRun {
+		if err != nil {
+			return nil, fmt.Errorf("unable to plan stack: %w", err)
+		}
+		return newStackInfo(name, action, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	if err == nil && kind == k8sKindHelm {
+		rec.State, rec.Reason, err = r.releaseStatus(ctx, rec)
+	}
+	if err == nil && kind == k8sKindKustomize && len(params) > 0 {
+		// Kustomize has no values to set, the params are kept for the record only
+		rec.Reason = "Deployed, params are ignored by kustomize directories"
+	}
+	if err != nil {
+		rec.State = model.StateFailed
+		rec.Reason = err.Error()
+	}
+
+	err = r.index.Put(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, action, rec.State, rec.Reason, stack.TemplateFile), nil
+}
+
+// upgradeRelease installs or upgrades the chart with the params as values. With a stack timeout, Helm waits for the
+// resources to be ready.
+func (r *KubernetesRepo) upgradeRelease(ctx context.Context, rec *model.StackRecord, dir string,
+	stack *model.StackConfig, dryRun bool) error {
+	values, err := json.Marshal(rec.Params)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"upgrade", rec.Attributes[k8sAttrRelease], dir, "--install",
+		"--namespace", rec.Attributes[k8sAttrNamespace], "--values", "-", "--labels", r.labelList(rec.Metadata)}
+	if stack.Timeout > 0 {
+		args = append(args, "--wait", "--timeout", stack.Timeout.String())
+	}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+
+	_, err = r.helm(ctx, values, args...)
+	return err
+}
+
+func (r *KubernetesRepo) releaseStatus(ctx context.Context, rec *model.StackRecord) (model.State, string, error) {
+	out, err := r.helm(ctx, nil, "status", rec.Attributes[k8sAttrRelease], "--namespace", rec.Attributes[k8sAttrNamespace],
+		"--output", "json")
+	if err != nil {
+		if r.isReleaseNotFound(err) {
+			return model.StateUnknown, "", apperr.NewNotFoundError("release", rec.Attributes[k8sAttrRelease])
+		}
+		return model.StateUnknown, "", fmt.Errorf("unable to get release status: %w", err)
+	}
+
+	status := struct {
+		Info struct {
+			Status      string `json:"status"`
+			Description string `json:"description"`
+		} `json:"info"`
+	}{}
+	err = json.Unmarshal(out, &status)
+	if err != nil {
+		return model.StateUnknown, "", fmt.Errorf("unable to parse release status: %w", err)
+	}
+
+	return r.mapReleaseStatus(status.Info.Status), status.Info.Description, nil
+}
+
+func (r *KubernetesRepo) isReleaseNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "release: not found")
+}
+
+func (r *KubernetesRepo) mapReleaseStatus(status string) model.State {
+	switch status {
+	case "deployed", "superseded":
+		return model.StateComplete
+	case "failed":
+		return model.StateFailed
+	case "pending-install":
+		return model.StateCreating
+	case "pending-upgrade":
+		return model.StateUpdating
+	case "pending-rollback":
+		return model.StateRollingBack
+	case "uninstalling":
+		return model.StateDeleting
+	case "uninstalled":
+		return model.StateDeleted
+	default:
+		return model.StateUnknown
+	}
+}
+
+// createNamespace creates the environment namespace if it doesn't exist and labels it with the metadata
+func (r *KubernetesRepo) createNamespace(ctx context.Context, ns string, metadata map[string]string) error {
+	manifest, err := r.kubectl(ctx, nil, "create", "namespace", ns, "--dry-run=client", "--output", "yaml")
+	if err == nil {
+		manifest, err = r.label(ctx, manifest, metadata)
+	}
+	if err == nil {
+		_, err = r.kubectl(ctx, manifest, "apply", "-f", "-")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create namespace %v: %w", ns, err)
+	}
+
+	return nil
+}
+
+// render builds the kustomize directory and labels every resource with the metadata
+func (r *KubernetesRepo) render(ctx context.Context, template string, metadata map[string]string) ([]byte, error) {
+	dir, _, err := r.sourceDir(template)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := r.kubectl(ctx, nil, "kustomize", dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build kustomize directory: %w", err)
+	}
+
+	return r.label(ctx, manifests, metadata)
+}
+
+func (r *KubernetesRepo) label(ctx context.Context, manifests []byte, metadata map[string]string) ([]byte, error) {
+	if len(metadata) == 0 {
+		return manifests, nil
+	}
+
+	args := []string{"label", "--local", "--overwrite", "--output", "yaml", "-f", "-"}
+	args = append(args, strings.Split(r.labelList(metadata), ",")...)
+
+	return r.kubectl(ctx, manifests, args...)
+}
+
+// lookupOutput reads an output from a reference of configmap/<name>/<key> or service/<name>[/<port>]
+func (r *KubernetesRepo) lookupOutput(ctx context.Context, ns string, ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("invalid output reference %v", ref)
+	}
+
+	out, err := r.kubectl(ctx, nil, "get", parts[0], parts[1], "--namespace", ns, "--output", "json")
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "configmap", "cm":
+		cm := struct {
+			Data map[string]string `json:"data"`
+		}{}
+		err = json.Unmarshal(out, &cm)
+		if err != nil {
+			return "", err
+		}
+		if len(parts) != 3 {
+			return "", fmt.Errorf("config map output %v needs a key", ref)
+		}
+		value, ok := cm.Data[parts[2]]
+		if !ok {
+			return "", apperr.NewNotFoundError("config map key", ref)
+		}
+		return value, nil
+	case "service", "svc":
+		return r.serviceEndpoint(out, parts)
+	default:
+		return "", fmt.Errorf("output reference %v must be a configmap or service", ref)
+	}
+}
+
+// serviceEndpoint returns the load balancer address of a service, or its cluster IP. A port name or number in the
+// reference adds the port.
+func (r *KubernetesRepo) serviceEndpoint(data []byte, parts []string) (string, error) {
+	svc := struct {
+		Spec struct {
+			ClusterIP string `json:"clusterIP"`
+			Ports     []struct {
+				Name string `json:"name"`
+				Port int    `json:"port"`
+			} `json:"ports"`
+		} `json:"spec"`
+		Status struct {
+			LoadBalancer struct {
+				Ingress []struct {
+					Hostname string `json:"hostname"`
+					IP       string `json:"ip"`
+				} `json:"ingress"`
+			} `json:"loadBalancer"`
+		} `json:"status"`
+	}{}
+	err := json.Unmarshal(data, &svc)
+	if err != nil {
+		return "", err
+	}
+
+	host := svc.Spec.ClusterIP
+	if len(svc.Status.LoadBalancer.Ingress) > 0 {
+		ingress := svc.Status.LoadBalancer.Ingress[0]
+		host = ingress.IP
+		if ingress.Hostname != "" {
+			host = ingress.Hostname
+		}
+	}
+
+	if len(parts) == 2 {
+		return host, nil
+	}
+
+	for _, port := range svc.Spec.Ports {
+		if port.Name == parts[2] || fmt.Sprint(port.Port) == parts[2] {
+			return fmt.Sprintf("%v:%v", host, port.Port), nil
+		}
+	}
+
+	return "", apperr.NewNotFoundError("service port", strings.Join(parts, "/"))
+}
+
+// sourceDir returns the local directory of a chart or kustomize directory and which of the two it is
+func (r *KubernetesRepo) sourceDir(template string) (string, string, error) {
+	scheme, err := r.openUrl.GetScheme(template)
+	if err != nil {
+		return "", "", err
+	}
+	if scheme != "file" {
+		return "", "", fmt.Errorf("kubernetes templates must be a local directory, got %v", template)
+	}
+
+	dir, err := r.openUrl.GetPathFromUrl(template, true)
+	if err != nil {
+		return "", "", err
+	}
+
+	if r.fileExists(filepath.Join(dir, "Chart.yaml")) {
+		return dir, k8sKindHelm, nil
+	}
+	for _, f := range []string{"kustomization.yaml", "kustomization.yml", "Kustomization"} {
+		if r.fileExists(filepath.Join(dir, f)) {
+			return dir, k8sKindKustomize, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("%v is not a Helm chart or kustomize directory", template)
+}
+
+func (r *KubernetesRepo) fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func (r *KubernetesRepo) helm(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	if r.provider.ProviderId == model.EncProvK8s {
+		args = append(args, "--kube-context", r.provider.Name)
+	}
+
+	// AWS credentials for clusters that authenticate with them, such as EKS
+	env, err := r.creds.Env(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.exec.Run(ctx, execwrap.Cmd{
+		Name:  "helm",
+		Args:  args,
+		Env:   env,
+		Stdin: stdin,
+	})
+}
+
+func (r *KubernetesRepo) kubectl(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	if r.provider.ProviderId == model.EncProvK8s {
+		args = append(args, "--context", r.provider.Name)
+	}
+
+	// AWS credentials for clusters that authenticate with them, such as EKS
+	env, err := r.creds.Env(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.exec.Run(ctx, execwrap.Cmd{
+		Name:  "kubectl",
+		Args:  args,
+		Env:   env,
+		Stdin: stdin,
+	})
+}
+
+// labelList returns the metadata as a sorted list of key=value labels with the values made valid
+func (r *KubernetesRepo) labelList(metadata map[string]string) string {
+	labels := []string{}
+	for k, v := range metadata {
+		v = strings.Trim(k8sInvalidLabel.ReplaceAllString(v, "-"), "-_.")
+		if len(v) > 63 {
+			v = strings.Trim(v[:63], "-_.")
+		}
+		labels = append(labels, fmt.Sprintf("%v=%v", k, v))
+	}
+	sort.Strings(labels)
+
+	return strings.Join(labels, ",")
+}
+
+// dnsName makes a name valid as a namespace or release name
+func (r *KubernetesRepo) dnsName(name string, maxLen int) string {
+	name = strings.Trim(k8sInvalidName.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(name) > maxLen {
+		name = strings.Trim(name[:maxLen], "-")
+	}
+
+	return name
+}
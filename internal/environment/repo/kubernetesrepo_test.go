@@ -0,0 +1,257 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+func newTestKubernetesRepo(t *testing.T, exec execwrap.Execer) *KubernetesRepo {
+	provider := &model.EncProvider{Name: "kind-dev", ProviderId: model.EncProvK8s}
+	return &KubernetesRepo{
+		provider: provider,
+		creds:    newAwsCredentials(provider),
+		index:    NewStateIndex("file://" + t.TempDir() + "/kubernetes.json"),
+		exec:     exec,
+		openUrl:  fileutil.NewFileUrlHelper(),
+	}
+}
+
+// newTestK8sSource returns the URI of a directory with the given file in it
+func newTestK8sSource(t *testing.T, file string) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte{}, 0600))
+	return "file://" + dir
+}
+
+func TestKubernetesRepo_GetStackInfo(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusOut    string
+		statusErr    error
+		wantState    model.State
+		wantNotFound bool
+	}{
+		{
+			name:      "deployed release",
+			statusOut: `{"info": {"status": "deployed", "description": "Upgrade complete"}}`,
+			wantState: model.StateComplete,
+		},
+		{
+			name:      "pending upgrade",
+			statusOut: `{"info": {"status": "pending-upgrade"}}`,
+			wantState: model.StateUpdating,
+		},
+		{
+			name:         "release uninstalled outside of swiz",
+			statusErr:    errors.New("helm status failed: exit status 1: Error: release: not found"),
+			wantNotFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployed := false
+			exec := &fakeExec{
+				respond: func(cmd execwrap.Cmd) ([]byte, error) {
+					if cmd.Name == "helm" && cmd.Args[0] == "status" {
+						if !deployed {
+							return []byte(`{"info": {"status": "deployed"}}`), nil
+						}
+						return []byte(tt.statusOut), tt.statusErr
+					}
+					return nil, nil
+				},
+			}
+			r := newTestKubernetesRepo(t, exec)
+			_, err := r.CreateStack(context.Background(), "dev-api", &model.StackConfig{
+				Name:         "api",
+				TemplateFile: newTestK8sSource(t, "Chart.yaml"),
+			}, nil, map[string]string{model.StackKeyEnvName: "dev"}, false)
+			assert.NoError(t, err)
+			deployed = true
+
+			stackInfo, err := r.GetStackInfo(context.Background(), "dev-api")
+			assert.Equal(t, tt.wantNotFound, errors.Is(err, apperr.GenNotFoundError))
+			if tt.wantNotFound {
+				// Nothing to roll back to either
+				_, err = r.GetStackSnapshot(context.Background(), "dev-api")
+				assert.True(t, errors.Is(err, apperr.GenNotFoundError))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantState, stackInfo.DeployStatus.State)
+		})
+	}
+}
+
+func TestKubernetesRepo_CreateStack(t *testing.T) {
+	t.Run("helm chart gets the params as values", func(t *testing.T) {
+		exec := &fakeExec{
+			respond: func(cmd execwrap.Cmd) ([]byte, error) {
+				if cmd.Name == "helm" && cmd.Args[0] == "status" {
+					return []byte(`{"info": {"status": "deployed", "description": "Install complete"}}`), nil
+				}
+				return nil, nil
+			},
+		}
+		r := newTestKubernetesRepo(t, exec)
+		chart := newTestK8sSource(t, "Chart.yaml")
+
+		stackInfo, err := r.CreateStack(context.Background(), "Dev_API", &model.StackConfig{
+			Name:         "api",
+			TemplateFile: chart,
+		}, map[string]string{"replicas": "2"}, map[string]string{model.StackKeyEnvName: "Dev"}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StateComplete, stackInfo.DeployStatus.State)
+
+		upgrade := exec.find("upgrade")
+		assert.Equal(t, []string{"upgrade", "dev-api", chart[len("file://"):], "--install", "--namespace", "dev",
+			"--values", "-", "--labels", "SwzEnv=Dev", "--kube-context", "kind-dev"}, upgrade.Args)
+		assert.JSONEq(t, `{"replicas": "2"}`, string(upgrade.Stdin))
+	})
+
+	t.Run("kustomize directory ignores params", func(t *testing.T) {
+		exec := &fakeExec{}
+		r := newTestKubernetesRepo(t, exec)
+
+		stackInfo, err := r.CreateStack(context.Background(), "dev-web", &model.StackConfig{
+			Name:         "web",
+			TemplateFile: newTestK8sSource(t, "kustomization.yaml"),
+		}, map[string]string{"DomainName": "example.com"}, map[string]string{model.StackKeyEnvName: "dev"}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StateComplete, stackInfo.DeployStatus.State)
+		assert.Contains(t, stackInfo.DeployStatus.Reason, "params are ignored")
+		assert.NotNil(t, exec.find("apply --namespace dev -f -"))
+	})
+}
+
+func TestKubernetesRepo_DeleteStack(t *testing.T) {
+	exec := &fakeExec{
+		respond: func(cmd execwrap.Cmd) ([]byte, error) {
+			if cmd.Name == "helm" && cmd.Args[0] == "uninstall" {
+				return nil, errors.New("helm uninstall failed: exit status 1: Error: uninstall: Release not loaded: dev-api: release: not found")
+			}
+			if cmd.Name == "helm" && cmd.Args[0] == "status" {
+				return []byte(`{"info": {"status": "deployed"}}`), nil
+			}
+			return nil, nil
+		},
+	}
+	r := newTestKubernetesRepo(t, exec)
+	_, err := r.CreateStack(context.Background(), "dev-api", &model.StackConfig{
+		Name:         "api",
+		TemplateFile: newTestK8sSource(t, "Chart.yaml"),
+	}, nil, map[string]string{model.StackKeyEnvName: "dev"}, false)
+	assert.NoError(t, err)
+
+	// A release that is already gone is deleted
+	stackInfo, err := r.DeleteStack(context.Background(), "dev-api", false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateDeleted, stackInfo.DeployStatus.State)
+}
+
+func TestKubernetesRepo_MapReleaseStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   model.State
+	}{
+		{status: "deployed", want: model.StateComplete},
+		{status: "superseded", want: model.StateComplete},
+		{status: "failed", want: model.StateFailed},
+		{status: "pending-install", want: model.StateCreating},
+		{status: "pending-upgrade", want: model.StateUpdating},
+		{status: "pending-rollback", want: model.StateRollingBack},
+		{status: "uninstalling", want: model.StateDeleting},
+		{status: "uninstalled", want: model.StateDeleted},
+		{status: "unknown", want: model.StateUnknown},
+	}
+
+	r := &KubernetesRepo{}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.mapReleaseStatus(tt.status))
+		})
+	}
+}
+
+func TestKubernetesRepo_LookupOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     string
+		out     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "config map key",
+			ref:  "configmap/api/url",
+			out:  `{"data": {"url": "http://api"}}`,
+			want: "http://api",
+		},
+		{
+			name:    "missing config map key",
+			ref:     "cm/api/host",
+			out:     `{"data": {"url": "http://api"}}`,
+			wantErr: true,
+		},
+		{
+			name: "service cluster ip",
+			ref:  "service/api",
+			out:  `{"spec": {"clusterIP": "10.0.0.1"}}`,
+			want: "10.0.0.1",
+		},
+		{
+			name: "load balancer hostname and named port",
+			ref:  "svc/api/http",
+			out: `{"spec": {"clusterIP": "10.0.0.1", "ports": [{"name": "http", "port": 80}]},
+				"status": {"loadBalancer": {"ingress": [{"hostname": "lb.example.com", "ip": "1.2.3.4"}]}}}`,
+			want: "lb.example.com:80",
+		},
+		{
+			name:    "unsupported kind",
+			ref:     "deployment/api",
+			out:     `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid reference",
+			ref:     "api",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestKubernetesRepo(t, &fakeExec{
+				respond: func(cmd execwrap.Cmd) ([]byte, error) {
+					return []byte(tt.out), nil
+				},
+			})
+
+			got, err := r.lookupOutput(context.Background(), "dev", tt.ref)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestKubernetesRepo_Names(t *testing.T) {
+	r := &KubernetesRepo{}
+
+	assert.Equal(t, "my-env-stack", r.dnsName("My_Env.Stack", 63))
+	assert.Equal(t, "abc", r.dnsName("abc-def", 4))
+	assert.Equal(t, "SwzEnv=dev,SwzStack=my-stack", r.labelList(map[string]string{
+		"SwzStack": "my stack!",
+		"SwzEnv":   "dev",
+	}))
+}
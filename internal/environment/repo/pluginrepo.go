@@ -0,0 +1,358 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/configutil"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+const PluginExecPrefix = "swiz-iac-"
+
+// PluginRepo hands each IacDeployer call to an external swiz-iac-<name> executable. The plugin is run once per call,
+// with a JSON request on stdin and a JSON response on stdout. The first call is a handshake that checks the protocol
+// version and returns the methods the plugin supports.
+type PluginRepo struct {
+	name      string
+	baseDir   string
+	pluginDir string
+	enclave   model.Enclave
+	provider  model.PluginProvider
+	exec      execwrap.Execer
+	openUrl   fileutil.FileUrlHelper
+
+	mu        sync.Mutex
+	path      string
+	handshake *model.PluginResponse
+}
+
+func NewPluginRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider, name string) IacDeployer {
+	return &PluginRepo{
+		name:      name,
+		baseDir:   config.BaseDir,
+		pluginDir: configutil.SetOrDefault(config.PluginDir, appconfig.DefaultPluginLocation),
+		enclave:   enclave,
+		provider:  model.NewPluginProvider(*provider),
+		exec:      execwrap.NewExec(),
+		openUrl:   fileutil.NewFileUrlHelper(),
+	}
+}
+
+func (r *PluginRepo) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.callStack(ctx, r.deployRequest(model.PluginMethodCreateStack, name, stack, params, metadata, dryRun))
+}
+
+func (r *PluginRepo) DeleteStack(ctx context.Context, name string, dryRun bool) (*model.StackInfo, error) {
+	return r.callStack(ctx, model.PluginRequest{
+		Method: model.PluginMethodDeleteStack,
+		Name:   name,
+		DryRun: dryRun,
+	})
+}
+
+func (r *PluginRepo) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.callStack(ctx, r.deployRequest(model.PluginMethodUpdateStack, name, stack, params, metadata, dryRun))
+}
+
+func (r *PluginRepo) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	return r.callStack(ctx, model.PluginRequest{
+		Method: model.PluginMethodGetStackInfo,
+		Name:   name,
+	})
+}
+
+func (r *PluginRepo) GetStackOutputs(ctx context.Context, name string) (map[string]string, error) {
+	resp, err := r.call(ctx, model.PluginRequest{
+		Method: model.PluginMethodGetStackOutputs,
+		Name:   name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Outputs == nil {
+		return map[string]string{}, nil
+	}
+
+	return resp.Outputs, nil
+}
+
+func (r *PluginRepo) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	resp, err := r.call(ctx, model.PluginRequest{
+		Method: model.PluginMethodGetStackSnapshot,
+		Name:   name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Snapshot == nil {
+		return nil, fmt.Errorf("plugin %v returned no snapshot for stack %v", r.name, name)
+	}
+
+	return resp.Snapshot.ToStackSnapshot(name), nil
+}
+
+func (r *PluginRepo) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	return r.callStack(ctx, model.PluginRequest{
+		Method:   model.PluginMethodRollbackStack,
+		Name:     name,
+		Snapshot: model.NewPluginSnapshot(snapshot),
+	})
+}
+
+func (r *PluginRepo) ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error) {
+	resp, err := r.call(ctx, model.PluginRequest{
+		Method:  model.PluginMethodListStacks,
+		EnvName: envName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := []model.StackInfo{}
+	for _, stack := range resp.Stacks {
+		retVal = append(retVal, stack.ToStackInfo())
+	}
+
+	return retVal, nil
+}
+
+func (r *PluginRepo) ListEnvironments(ctx context.Context) ([]string, error) {
+	resp, err := r.call(ctx, model.PluginRequest{
+		Method: model.PluginMethodListEnvironments,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Environments == nil {
+		return []string{}, nil
+	}
+
+	return resp.Environments, nil
+}
+
+func (r *PluginRepo) GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error) {
+	resp, err := r.call(ctx, model.PluginRequest{
+		Method:  model.PluginMethodGetEnvironment,
+		EnvName: envName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Environment == nil {
+		return nil, apperr.NewNotFoundError("environment", envName)
+	}
+
+	envInfo := resp.Environment.ToEnvironmentInfo()
+	return &envInfo, nil
+}
+
+func (r *PluginRepo) IsEnvironmentInState(ctx context.Context, envName string, stacks []string, states []model.State) (bool, []string, error) {
+	stateNames := []string{}
+	for _, st := range states {
+		stateNames = append(stateNames, st.String())
+	}
+
+	resp, err := r.call(ctx, model.PluginRequest{
+		Method:  model.PluginMethodIsEnvironmentInState,
+		EnvName: envName,
+		Stacks:  stacks,
+		States:  stateNames,
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	// The stacks that are in one of the states are returned in stacks
+	inState := []string{}
+	for _, stack := range resp.Stacks {
+		inState = append(inState, stack.Name)
+	}
+
+	return resp.InState, inState, nil
+}
+
+func (r *PluginRepo) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	resp, err := r.call(ctx, model.PluginRequest{
+		Method: model.PluginMethodDetectStackDrift,
+		Name:   name,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.DetectionId, nil
+}
+
+func (r *PluginRepo) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	resp, err := r.call(ctx, model.PluginRequest{
+		Method:      model.PluginMethodGetStackDrift,
+		Name:        name,
+		DetectionId: detectionId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Drift == nil {
+		return nil, fmt.Errorf("plugin %v returned no drift for stack %v", r.name, name)
+	}
+
+	drift := *resp.Drift
+	drift.Name = name
+	return &drift, nil
+}
+
+func (r *PluginRepo) deployRequest(method string, name string, stack *model.StackConfig, params map[string]string,
+	metadata map[string]string, dryRun bool) model.PluginRequest {
+	return model.PluginRequest{
+		Method:         method,
+		Name:           name,
+		EnvName:        metadata[model.StackKeyEnvName],
+		TemplateFile:   stack.TemplateFile,
+		TimeoutSeconds: int(stack.Timeout.Seconds()),
+		Params:         params,
+		Metadata:       metadata,
+		DryRun:         dryRun,
+	}
+}
+
+func (r *PluginRepo) callStack(ctx context.Context, req model.PluginRequest) (*model.StackInfo, error) {
+	resp, err := r.call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Stack == nil {
+		return nil, fmt.Errorf("plugin %v returned no stack for %v", r.name, req.Method)
+	}
+
+	stackInfo := resp.Stack.ToStackInfo()
+	return &stackInfo, nil
+}
+
+// call sends a request to the plugin after checking that the plugin supports the method
+func (r *PluginRepo) call(ctx context.Context, req model.PluginRequest) (*model.PluginResponse, error) {
+	handshake, err := r.getHandshake(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !handshake.HasCapability(req.Method) {
+		return nil, apperr.NewUnsupportedError(req.Method, model.IacTypePlugin+r.name)
+	}
+
+	return r.send(ctx, req)
+}
+
+// getHandshake runs the handshake on first use. A failed handshake is retried on the next call.
+func (r *PluginRepo) getHandshake(ctx context.Context) (*model.PluginResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.handshake != nil {
+		return r.handshake, nil
+	}
+
+	path, err := r.findPlugin()
+	if err != nil {
+		return nil, err
+	}
+	r.path = path
+
+	resp, err := r.send(ctx, model.PluginRequest{
+		Method: model.PluginMethodHandshake,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ProtocolVersion != model.PluginProtocolVersion {
+		return nil, fmt.Errorf("plugin %v speaks protocol version %v, swiz requires version %v", r.name,
+			resp.ProtocolVersion, model.PluginProtocolVersion)
+	}
+
+	r.handshake = resp
+	return resp, nil
+}
+
+func (r *PluginRepo) findPlugin() (string, error) {
+	location, err := r.openUrl.UrlWithBaseDir(r.baseDir, r.pluginDir)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := r.openUrl.GetPathFromUrl(location, true)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, PluginExecPrefix+r.name)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", apperr.NewNotFoundError("plugin", path)
+	}
+
+	return path, nil
+}
+
+func (r *PluginRepo) send(ctx context.Context, req model.PluginRequest) (*model.PluginResponse, error) {
+	req.ProtocolVersion = model.PluginProtocolVersion
+	req.Enclave = r.enclave.Name
+	req.Provider = r.provider
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := r.exec.Run(ctx, execwrap.Cmd{
+		Name:  r.path,
+		Stdin: data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("plugin %v %v: %w", r.name, req.Method, err)
+	}
+
+	resp := &model.PluginResponse{}
+	err = json.Unmarshal(out, resp)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %v %v returned an invalid response: %w", r.name, req.Method, err)
+	}
+
+	if resp.Error != nil {
+		return nil, r.toError(req, resp.Error)
+	}
+
+	return resp, nil
+}
+
+// toError maps a plugin error to the matching app error so callers can check for it
+func (r *PluginRepo) toError(req model.PluginRequest, pluginErr *model.PluginError) error {
+	switch pluginErr.Code {
+	case model.PluginErrNotFound:
+		if req.Name != "" {
+			return apperr.NewNotFoundError("stack", req.Name)
+		}
+		return apperr.NewNotFoundError("environment", req.EnvName)
+	case model.PluginErrUnsupported:
+		return apperr.NewUnsupportedError(req.Method, model.IacTypePlugin+r.name)
+	default:
+		return fmt.Errorf("plugin %v %v failed: %v", r.name, req.Method, strings.TrimSpace(pluginErr.Message))
+	}
+}
@@ -0,0 +1,235 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+// pluginExec answers plugin requests with the response of their method. Requests are kept in the order they were sent.
+type pluginExec struct {
+	fakeExec
+	requests  []model.PluginRequest
+	responses map[string]string
+}
+
+func newPluginExec(responses map[string]string) *pluginExec {
+	e := &pluginExec{responses: responses}
+	e.respond = func(cmd execwrap.Cmd) ([]byte, error) {
+		req := model.PluginRequest{}
+		err := json.Unmarshal(cmd.Stdin, &req)
+		if err != nil {
+			return nil, err
+		}
+		e.requests = append(e.requests, req)
+
+		resp, ok := e.responses[req.Method]
+		if !ok {
+			return nil, errors.New("exit status 1")
+		}
+		return []byte(resp), nil
+	}
+	return e
+}
+
+func (e *pluginExec) methods() []string {
+	retVal := []string{}
+	for _, req := range e.requests {
+		retVal = append(retVal, req.Method)
+	}
+	return retVal
+}
+
+func newTestPluginRepo(t *testing.T, exec execwrap.Execer) *PluginRepo {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, PluginExecPrefix+"pulumi"), []byte{}, 0700))
+
+	return &PluginRepo{
+		name:      "pulumi",
+		pluginDir: "file://" + dir,
+		enclave:   model.Enclave{Name: "dev"},
+		provider:  model.PluginProvider{Name: "dev-account", ProviderId: model.EncProvAws},
+		exec:      exec,
+		openUrl:   fileutil.NewFileUrlHelper(),
+	}
+}
+
+const pluginHandshake = `{"protocol_version": 1, "capabilities": ["CreateStack", "GetStackInfo", "GetStackOutputs",
+	"ListEnvironments", "GetEnvironment"]}`
+
+func TestPluginRepo_Handshake(t *testing.T) {
+	exec := newPluginExec(map[string]string{
+		model.PluginMethodHandshake:    pluginHandshake,
+		model.PluginMethodGetStackInfo: `{"protocol_version": 1, "stack": {"name": "dev-app", "state": "Complete"}}`,
+		model.PluginMethodCreateStack:  `{"protocol_version": 1, "stack": {"name": "dev-app", "next_action": "Create", "state": "Creating"}}`,
+	})
+	r := newTestPluginRepo(t, exec)
+
+	stackInfo, err := r.GetStackInfo(context.Background(), "dev-app")
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateComplete, stackInfo.DeployStatus.State)
+
+	stackInfo, err = r.CreateStack(context.Background(), "dev-app", &model.StackConfig{
+		Name:         "app",
+		TemplateFile: "file://app",
+		Timeout:      5 * time.Minute,
+	}, map[string]string{"Size": "2"}, map[string]string{model.StackKeyEnvName: "dev"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateCreating, stackInfo.DeployStatus.State)
+
+	// Not in the capabilities, so the plugin is never asked
+	_, err = r.RollbackStack(context.Background(), "dev-app", nil)
+	assert.True(t, errors.Is(err, apperr.GenUnsupportedError))
+
+	// The handshake only runs once
+	assert.Equal(t, []string{model.PluginMethodHandshake, model.PluginMethodGetStackInfo, model.PluginMethodCreateStack},
+		exec.methods())
+
+	create := exec.requests[2]
+	assert.Equal(t, model.PluginProtocolVersion, create.ProtocolVersion)
+	assert.Equal(t, "dev", create.Enclave)
+	assert.Equal(t, "dev-account", create.Provider.Name)
+	assert.Equal(t, "dev", create.EnvName)
+	assert.Equal(t, "file://app", create.TemplateFile)
+	assert.Equal(t, 300, create.TimeoutSeconds)
+	assert.Equal(t, map[string]string{"Size": "2"}, create.Params)
+	assert.True(t, create.DryRun)
+}
+
+func TestPluginRepo_HandshakeFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		handshake string
+		wantErr   string
+	}{
+		{
+			name:      "wrong protocol version",
+			handshake: `{"protocol_version": 2}`,
+			wantErr:   "plugin pulumi speaks protocol version 2, swiz requires version 1",
+		},
+		{
+			name:      "invalid response",
+			handshake: `protocol_version: 1`,
+			wantErr:   "plugin pulumi Handshake returned an invalid response",
+		},
+		{
+			name:    "plugin fails",
+			wantErr: "plugin pulumi Handshake: exit status 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := map[string]string{}
+			if tt.handshake != "" {
+				responses[model.PluginMethodHandshake] = tt.handshake
+			}
+			exec := newPluginExec(responses)
+			r := newTestPluginRepo(t, exec)
+
+			_, err := r.ListEnvironments(context.Background())
+			assert.ErrorContains(t, err, tt.wantErr)
+
+			// A failed handshake is tried again on the next call
+			exec.responses[model.PluginMethodHandshake] = pluginHandshake
+			exec.responses[model.PluginMethodListEnvironments] = `{"protocol_version": 1, "environments": ["dev"]}`
+			envs, err := r.ListEnvironments(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"dev"}, envs)
+		})
+	}
+
+	t.Run("missing plugin", func(t *testing.T) {
+		r := newTestPluginRepo(t, newPluginExec(nil))
+		r.name = "missing"
+
+		_, err := r.ListEnvironments(context.Background())
+		assert.True(t, errors.Is(err, apperr.GenNotFoundError))
+	})
+}
+
+func TestPluginRepo_Errors(t *testing.T) {
+	tests := []struct {
+		name            string
+		call            func(r *PluginRepo) error
+		resp            string
+		wantNotFound    bool
+		wantUnsupported bool
+		wantErr         string
+	}{
+		{
+			name: "stack not found",
+			call: func(r *PluginRepo) error {
+				_, err := r.GetStackInfo(context.Background(), "dev-app")
+				return err
+			},
+			resp:         `{"protocol_version": 1, "error": {"code": "not_found", "message": "no such stack"}}`,
+			wantNotFound: true,
+			wantErr:      "dev-app",
+		},
+		{
+			name: "environment not found",
+			call: func(r *PluginRepo) error {
+				_, err := r.GetEnvironment(context.Background(), "dev")
+				return err
+			},
+			resp:         `{"protocol_version": 1, "error": {"code": "not_found", "message": "no such environment"}}`,
+			wantNotFound: true,
+			wantErr:      "dev",
+		},
+		{
+			name: "unsupported by the plugin",
+			call: func(r *PluginRepo) error {
+				_, err := r.GetStackOutputs(context.Background(), "dev-app")
+				return err
+			},
+			resp:            `{"protocol_version": 1, "error": {"code": "unsupported", "message": "no outputs"}}`,
+			wantUnsupported: true,
+			wantErr:         "GetStackOutputs",
+		},
+		{
+			name: "other failure",
+			call: func(r *PluginRepo) error {
+				_, err := r.GetStackInfo(context.Background(), "dev-app")
+				return err
+			},
+			resp:    `{"protocol_version": 1, "error": {"message": "access denied\n"}}`,
+			wantErr: "plugin pulumi GetStackInfo failed: access denied",
+		},
+		{
+			name: "missing stack in the response",
+			call: func(r *PluginRepo) error {
+				_, err := r.GetStackInfo(context.Background(), "dev-app")
+				return err
+			},
+			resp:    `{"protocol_version": 1}`,
+			wantErr: "plugin pulumi returned no stack for GetStackInfo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestPluginRepo(t, newPluginExec(map[string]string{
+				model.PluginMethodHandshake:       pluginHandshake,
+				model.PluginMethodGetStackInfo:    tt.resp,
+				model.PluginMethodGetStackOutputs: tt.resp,
+				model.PluginMethodGetEnvironment:  tt.resp,
+			}))
+
+			err := tt.call(r)
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantNotFound, errors.Is(err, apperr.GenNotFoundError))
+			assert.Equal(t, tt.wantUnsupported, errors.Is(err, apperr.GenUnsupportedError))
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+const (
+	scriptAttrDir     = "dir"
+	scriptAttrDestroy = "destroy"
+	scriptAttrStatus  = "status"
+)
+
+// ScriptRepo runs the shell commands of a stack config for steps that aren't IaC, such as database migrations. The
+// commands are kept in a swiz-managed state index along with the metadata, so the step is deleted with its environment.
+type ScriptRepo struct {
+	creds   *awsCredentials
+	index   *StateIndex
+	exec    execwrap.Execer
+	openUrl fileutil.FileUrlHelper
+}
+
+func NewScriptRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider) IacDeployer {
+	return &ScriptRepo{
+		creds:   newAwsCredentials(provider),
+		index:   NewEnclaveStateIndex(enclave, model.IacTypeScript),
+		exec:    execwrap.NewExec(),
+		openUrl: fileutil.NewFileUrlHelper(),
+	}
+}
+
+func (r *ScriptRepo) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.apply(ctx, name, stack, params, metadata, model.NextActionCreate, dryRun)
+}
+
+func (r *ScriptRepo) DeleteStack(ctx context.Context, name string, dryRun bool) (*model.StackInfo, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		if errors.Is(err, apperr.GenNotFoundError) {
+			// Nothing was applied
+			return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Stack does not exist", ""), nil
+		}
+		return nil, err
+	}
+
+	if dryRun {
+		return newStackInfo(name, model.NextActionDelete, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	if rec.Attributes[scriptAttrDestroy] != "" {
+		_, err = r.run(ctx, rec, rec.Attributes[scriptAttrDestroy], "")
+		if err != nil {
+			// Leave the failure in the index, waiting on the stack reports it
+			rec.State = model.StateFailed
+			rec.Reason = err.Error()
+			return newStackInfo(name, model.NextActionDelete, model.StateFailed, rec.Reason, ""), r.index.Put(rec)
+		}
+	}
+
+	err = r.index.Delete(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Destroyed", ""), nil
+}
+
+func (r *ScriptRepo) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.apply(ctx, name, stack, params, metadata, model.NextActionUpdate, dryRun)
+}
+
+// GetStackInfo runs the status command if there is one. It prints the name of a state, or nothing when the step is
+// complete, and a failed status command marks the step as failed.
+func (r *ScriptRepo) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec.Attributes[scriptAttrStatus] != "" && rec.State != model.StateFailed {
+		out, statusErr := r.run(ctx, rec, rec.Attributes[scriptAttrStatus], "")
+		status := strings.TrimSpace(string(out))
+		switch {
+		case statusErr != nil:
+			rec.State = model.StateFailed
+			rec.Reason = statusErr.Error()
+		case status == "":
+			rec.State = model.StateComplete
+		default:
+			rec.State = model.ParseState(status)
+			rec.Reason = status
+		}
+	}
+
+	stackInfo := rec.ToStackInfo()
+	return &stackInfo, nil
+}
+
+func (r *ScriptRepo) GetStackOutputs(ctx context.Context, name string) (map[string]string, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return rec.Outputs, nil
+}
+
+func (r *ScriptRepo) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.StackSnapshot{
+		Name:       name,
+		Parameters: rec.Params,
+	}, nil
+}
+
+func (r *ScriptRepo) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	if snapshot != nil {
+		return nil, apperr.NewUnsupportedError("rolling back an update", model.IacTypeScript)
+	}
+
+	// Scripts run to completion, there is never an update in progress to cancel
+	return r.index.GetStackInfo(name)
+}
+
+func (r *ScriptRepo) ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error) {
+	return r.index.ListStacks(envName)
+}
+
+func (r *ScriptRepo) ListEnvironments(ctx context.Context) ([]string, error) {
+	return r.index.ListEnvironments()
+}
+
+func (r *ScriptRepo) GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error) {
+	return r.index.GetEnvironment(envName)
+}
+
+func (r *ScriptRepo) IsEnvironmentInState(ctx context.Context, envName string, stacks []string, states []model.State) (bool, []string, error) {
+	return r.index.IsEnvironmentInState(stacks, states)
+}
+
+func (r *ScriptRepo) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	return "", apperr.NewUnsupportedError("drift detection", model.IacTypeScript)
+}
+
+func (r *ScriptRepo) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	return nil, apperr.NewUnsupportedError("drift detection", model.IacTypeScript)
+}
+
+// apply runs the apply command and reads the outputs it wrote. The command runs to completion, a failure is recorded in
+// the index and reported when waiting on the stack.
+func (r *ScriptRepo) apply(ctx context.Context, name string, stack *model.StackConfig, params map[string]string,
+	metadata map[string]string, action model.NextAction, dryRun bool) (*model.StackInfo, error) {
+	if stack.Script == nil || stack.Script.Apply == "" {
+		return nil, fmt.Errorf("stack %v has no script apply command", stack.RawName)
+	}
+
+	if dryRun {
+		return newStackInfo(name, action, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	rec := &model.StackRecord{
+		Name:     name,
+		EnvName:  metadata[model.StackKeyEnvName],
+		Template: stack.Script.Apply,
+		Params:   params,
+		Metadata: map[string]string{},
+		Outputs:  map[string]string{},
+		Attributes: map[string]string{
+			scriptAttrDir:     stack.Script.Dir,
+			scriptAttrDestroy: stack.Script.Destroy,
+			scriptAttrStatus:  stack.Script.Status,
+		},
+		State:  model.StateComplete,
+		Reason: "Applied",
+	}
+
+	// Keep the create metadata on update
+	existing, err := r.index.Get(name)
+	if err == nil {
+		for k, v := range existing.Metadata {
+			rec.Metadata[k] = v
+		}
+	}
+	for k, v := range metadata {
+		rec.Metadata[k] = v
+	}
+
+	rec.Outputs, err = r.runApply(ctx, rec)
+	if err != nil {
+		rec.State = model.StateFailed
+		rec.Reason = err.Error()
+	}
+
+	err = r.index.Put(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, action, rec.State, rec.Reason, rec.Template), nil
+}
+
+// runApply runs the apply command with SWIZ_OUTPUT_FILE set to a temp file, which the command can write a JSON object
+// of outputs to
+func (r *ScriptRepo) runApply(ctx context.Context, rec *model.StackRecord) (map[string]string, error) {
+	outDir, err := os.MkdirTemp("", "swiz-script-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outDir)
+
+	outFile := filepath.Join(outDir, "outputs.json")
+	_, err = r.run(ctx, rec, rec.Template, outFile)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// No outputs
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+
+	values := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse outputs: %w", err)
+	}
+
+	return outputStrings(values), nil
+}
+
+func (r *ScriptRepo) run(ctx context.Context, rec *model.StackRecord, command string, outFile string) ([]byte, error) {
+	dirPath, err := r.openUrl.GetPathFromUrl(rec.Attributes[scriptAttrDir], true)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := r.env(ctx, rec, outFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.exec.Run(ctx, execwrap.Cmd{
+		Name: "sh",
+		Args: []string{"-c", command},
+		Dir:  dirPath,
+		Env:  env,
+	})
+}
+
+// env passes the params as SWIZ_PARAM_<name> environment variables along with the stack and environment names and the
+// AWS credentials of the provider
+func (r *ScriptRepo) env(ctx context.Context, rec *model.StackRecord, outFile string) (map[string]string, error) {
+	env, err := r.creds.Env(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	env["SWIZ_STACK_NAME"] = rec.Name
+	env["SWIZ_ENV_NAME"] = rec.EnvName
+	if outFile != "" {
+		env["SWIZ_OUTPUT_FILE"] = outFile
+	}
+	for k, v := range rec.Params {
+		env["SWIZ_PARAM_"+k] = v
+	}
+
+	return env, nil
+}
@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+func newTestScriptRepo(t *testing.T, exec execwrap.Execer) *ScriptRepo {
+	return &ScriptRepo{
+		creds:   newAwsCredentials(&model.EncProvider{ProviderId: model.EncProvDummy}),
+		index:   NewStateIndex("file://" + t.TempDir() + "/script.json"),
+		exec:    exec,
+		openUrl: fileutil.NewFileUrlHelper(),
+	}
+}
+
+// writeScriptOutputs answers the apply command by writing out to the output file, or nothing if out is empty
+func writeScriptOutputs(out string) func(cmd execwrap.Cmd) ([]byte, error) {
+	return func(cmd execwrap.Cmd) ([]byte, error) {
+		if out == "" || cmd.Args[1] != "./migrate.sh" {
+			return nil, nil
+		}
+		return nil, os.WriteFile(cmd.Env["SWIZ_OUTPUT_FILE"], []byte(out), 0600)
+	}
+}
+
+func TestScriptRepo_CreateStack(t *testing.T) {
+	tests := []struct {
+		name        string
+		out         string
+		wantState   model.State
+		wantOutputs map[string]string
+	}{
+		{
+			name:        "no outputs",
+			wantState:   model.StateComplete,
+			wantOutputs: map[string]string{},
+		},
+		{
+			name:      "strings are passed as is and other values as JSON",
+			out:       `{"Endpoint": "db.local", "Port": 5432, "Tags": ["a", "b"], "Config": {"tls": true}}`,
+			wantState: model.StateComplete,
+			wantOutputs: map[string]string{
+				"Endpoint": "db.local",
+				"Port":     "5432",
+				"Tags":     `["a", "b"]`,
+				"Config":   `{"tls": true}`,
+			},
+		},
+		{
+			name:      "invalid outputs fail the step",
+			out:       `Endpoint=db.local`,
+			wantState: model.StateFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := &fakeExec{respond: writeScriptOutputs(tt.out)}
+			r := newTestScriptRepo(t, exec)
+			dir := t.TempDir()
+
+			stackInfo, err := r.CreateStack(context.Background(), "dev-migrate", &model.StackConfig{
+				Name:   "migrate",
+				Script: &model.StackScript{Dir: "file://" + dir, Apply: "./migrate.sh"},
+			}, map[string]string{"DbName": "app"}, map[string]string{model.StackKeyEnvName: "dev"}, false)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantState, stackInfo.DeployStatus.State)
+
+			apply := exec.find("-c ./migrate.sh")
+			assert.Equal(t, "sh", apply.Name)
+			assert.Equal(t, dir, apply.Dir)
+			assert.Equal(t, "dev-migrate", apply.Env["SWIZ_STACK_NAME"])
+			assert.Equal(t, "dev", apply.Env["SWIZ_ENV_NAME"])
+			assert.Equal(t, "app", apply.Env["SWIZ_PARAM_DbName"])
+
+			// The output file is removed once it is read
+			_, err = os.Stat(apply.Env["SWIZ_OUTPUT_FILE"])
+			assert.True(t, os.IsNotExist(err))
+
+			if tt.wantOutputs != nil {
+				outputs, err := r.GetStackOutputs(context.Background(), "dev-migrate")
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantOutputs, outputs)
+			}
+		})
+	}
+}
+
+func TestScriptRepo_GetStackInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		statusErr  error
+		wantState  model.State
+		wantReason string
+	}{
+		{
+			name:       "no output is complete",
+			status:     "\n",
+			wantState:  model.StateComplete,
+			wantReason: "Applied",
+		},
+		{
+			name:       "state name",
+			status:     "Updating\n",
+			wantState:  model.StateUpdating,
+			wantReason: "Updating",
+		},
+		{
+			name:       "unknown state name",
+			status:     "migrating 3 of 5",
+			wantState:  model.StateUnknown,
+			wantReason: "migrating 3 of 5",
+		},
+		{
+			name:       "failed status command",
+			statusErr:  errors.New("sh -c failed: exit status 1: connection refused"),
+			wantState:  model.StateFailed,
+			wantReason: "sh -c failed: exit status 1: connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestScriptRepo(t, &fakeExec{
+				respond: func(cmd execwrap.Cmd) ([]byte, error) {
+					if cmd.Args[1] == "./status.sh" {
+						return []byte(tt.status), tt.statusErr
+					}
+					return nil, nil
+				},
+			})
+			_, err := r.CreateStack(context.Background(), "dev-migrate", &model.StackConfig{
+				Name: "migrate",
+				Script: &model.StackScript{
+					Dir:    "file://" + t.TempDir(),
+					Apply:  "./migrate.sh",
+					Status: "./status.sh",
+				},
+			}, nil, nil, false)
+			assert.NoError(t, err)
+
+			stackInfo, err := r.GetStackInfo(context.Background(), "dev-migrate")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantState, stackInfo.DeployStatus.State)
+			assert.Equal(t, tt.wantReason, stackInfo.DeployStatus.Reason)
+		})
+	}
+}
+
+func TestScriptRepo_DeleteStack(t *testing.T) {
+	exec := &fakeExec{}
+	r := newTestScriptRepo(t, exec)
+	_, err := r.CreateStack(context.Background(), "dev-migrate", &model.StackConfig{
+		Name: "migrate",
+		Script: &model.StackScript{
+			Dir:     "file://" + t.TempDir(),
+			Apply:   "./migrate.sh",
+			Destroy: "./drop.sh",
+		},
+	}, nil, nil, false)
+	assert.NoError(t, err)
+
+	stackInfo, err := r.DeleteStack(context.Background(), "dev-migrate", true)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateDryRun, stackInfo.DeployStatus.State)
+	assert.Nil(t, exec.find("-c ./drop.sh"))
+
+	stackInfo, err = r.DeleteStack(context.Background(), "dev-migrate", false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateDeleted, stackInfo.DeployStatus.State)
+	assert.NotNil(t, exec.find("-c ./drop.sh"))
+
+	// Deleting again finds nothing to do
+	stackInfo, err = r.DeleteStack(context.Background(), "dev-migrate", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Stack does not exist", stackInfo.DeployStatus.Reason)
+}
@@ -0,0 +1,823 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/backoff"
+	"github.com/swizzleio/swiz/pkg/drivers/awswrap"
+)
+
+// StackSetRepo deploys a stack as a CloudFormation StackSet with instances in the accounts or organizational units and
+// regions of its stack_set block. The StackSet is created in the provider's account and region. Changes to the
+// instances are separate StackSet operations that run one at a time, so every operation but the last is waited on
+// before returning. StackSets don't expose the outputs of their instances.
+type StackSetRepo struct {
+	cf     *CloudFormationRepo
+	client awswrap.Cloudformationer
+	retry  model.EncRetry
+}
+
+// stackSetGroup is a set of targets that get instances in the same regions, which can share a single operation
+type stackSetGroup struct {
+	targets []string
+	regions []string
+}
+
+func NewStackSetRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider) (IacDeployer, error) {
+	cf, err := newCloudFormationRepo(config, enclave, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StackSetRepo{
+		cf:     cf,
+		client: cf.client,
+		retry:  enclave.Retry,
+	}, nil
+}
+
+func (r *StackSetRepo) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	cfg, err := r.stackSetConfig(name, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	templateBody, templateUrl, err := r.cf.templateOrUrl(ctx, stack.TemplateFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get template body: %w", err)
+	}
+
+	templateResp, err := r.client.GetTemplateSummary(ctx, &cloudformation.GetTemplateSummaryInput{
+		TemplateURL:  templateUrl,
+		TemplateBody: templateBody,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get template summary: %w", err)
+	}
+
+	desired := r.instanceSet(cfg.Targets(), cfg.Regions)
+	if dryRun {
+		stackInfo := newStackInfo(name, model.NextActionCreate, model.StateDryRun, "Dry Run", "")
+		stackInfo.Resources = r.instanceNames(desired)
+		return stackInfo, nil
+	}
+
+	input := &cloudformation.CreateStackSetInput{
+		StackSetName:          &name,
+		TemplateURL:           templateUrl,
+		TemplateBody:          templateBody,
+		Parameters:            r.cf.generateParams(params, templateResp.Parameters),
+		Tags:                  r.cf.generateTags(metadata),
+		AdministrationRoleARN: r.optString(cfg.AdministrationRoleArn),
+		ExecutionRoleName:     r.optString(cfg.ExecutionRoleName),
+		PermissionModel:       types.PermissionModelsSelfManaged,
+		Capabilities: []types.Capability{
+			types.CapabilityCapabilityNamedIam,
+		},
+	}
+	if cfg.IsServiceManaged() {
+		// Accounts that join the organizational units later get an instance as well
+		input.PermissionModel = types.PermissionModelsServiceManaged
+		input.AutoDeployment = &types.AutoDeployment{
+			Enabled:                      aws.Bool(true),
+			RetainStacksOnAccountRemoval: aws.Bool(false),
+		}
+	}
+
+	_, err = r.client.CreateStackSet(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stack set: %w", err)
+	}
+
+	ops := []func() (*string, error){}
+	for _, group := range r.groupByRegions(desired) {
+		ops = append(ops, r.createInstancesOp(ctx, name, cfg, group))
+	}
+
+	opId, err := r.runOperations(ctx, name, ops, false)
+	if err != nil {
+		return nil, err
+	}
+
+	stackInfo := newStackInfo(name, model.NextActionCreate, model.StateCreating, "Cloudformation CreateStackSet", opId)
+	stackInfo.Resources = r.instanceNames(desired)
+
+	return stackInfo, nil
+}
+
+func (r *StackSetRepo) DeleteStack(ctx context.Context, name string, dryRun bool) (*model.StackInfo, error) {
+	if dryRun {
+		return newStackInfo(name, model.NextActionDelete, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	stackSet, err := r.describeStackSet(ctx, name)
+	if err != nil {
+		if errors.Is(err, apperr.GenNotFoundError) {
+			return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Stack set not found", ""), nil
+		}
+		return nil, err
+	}
+
+	instances, err := r.listInstances(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The instances have to be gone before the stack set can be deleted
+	serviceManaged := stackSet.PermissionModel == types.PermissionModelsServiceManaged
+	ops := []func() (*string, error){}
+	for _, group := range r.groupByRegions(r.instanceTargets(instances)) {
+		ops = append(ops, r.deleteInstancesOp(ctx, name, serviceManaged, nil, group))
+	}
+
+	_, err = r.runOperations(ctx, name, ops, true)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.client.DeleteStackSet(ctx, &cloudformation.DeleteStackSetInput{
+		StackSetName: &name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete stack set: %w", err)
+	}
+
+	return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Cloudformation DeleteStackSet",
+		r.cf.strOrEmpty(stackSet.StackSetId)), nil
+}
+
+func (r *StackSetRepo) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	cfg, err := r.stackSetConfig(name, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	templateBody, templateUrl, err := r.cf.templateOrUrl(ctx, stack.TemplateFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get template body: %w", err)
+	}
+
+	templateResp, err := r.client.GetTemplateSummary(ctx, &cloudformation.GetTemplateSummaryInput{
+		TemplateURL:  templateUrl,
+		TemplateBody: templateBody,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get template summary: %w", err)
+	}
+
+	instances, err := r.listInstances(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := r.instanceTargets(instances)
+	desired := r.instanceSet(cfg.Targets(), cfg.Regions)
+	if dryRun {
+		stackInfo := newStackInfo(name, model.NextActionUpdate, model.StateDryRun, "Dry Run", "")
+		stackInfo.Resources = r.instanceNames(desired)
+		return stackInfo, nil
+	}
+
+	// Remove the instances that are no longer wanted, update the rest and then add the new ones
+	ops := []func() (*string, error){}
+	for _, group := range r.groupByRegions(r.instanceDiff(existing, desired)) {
+		ops = append(ops, r.deleteInstancesOp(ctx, name, cfg.IsServiceManaged(), r.operationPreferences(cfg), group))
+	}
+
+	input := &cloudformation.UpdateStackSetInput{
+		StackSetName:          &name,
+		TemplateURL:           templateUrl,
+		TemplateBody:          templateBody,
+		Parameters:            r.cf.generateParams(params, templateResp.Parameters),
+		Tags:                  r.cf.generateTags(metadata),
+		AdministrationRoleARN: r.optString(cfg.AdministrationRoleArn),
+		ExecutionRoleName:     r.optString(cfg.ExecutionRoleName),
+		OperationPreferences:  r.operationPreferences(cfg),
+		Capabilities: []types.Capability{
+			types.CapabilityCapabilityNamedIam,
+		},
+	}
+	ops = append(ops, func() (*string, error) {
+		resp, updateErr := r.client.UpdateStackSet(ctx, input)
+		if updateErr != nil {
+			return nil, fmt.Errorf("unable to update stack set: %w", updateErr)
+		}
+		return resp.OperationId, nil
+	})
+
+	for _, group := range r.groupByRegions(r.instanceDiff(desired, existing)) {
+		ops = append(ops, r.createInstancesOp(ctx, name, cfg, group))
+	}
+
+	opId, err := r.runOperations(ctx, name, ops, false)
+	if err != nil {
+		return nil, err
+	}
+
+	stackInfo := newStackInfo(name, model.NextActionUpdate, model.StateUpdating, "Cloudformation UpdateStackSet", opId)
+	stackInfo.Resources = r.instanceNames(desired)
+
+	return stackInfo, nil
+}
+
+func (r *StackSetRepo) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	stackSet, err := r.describeStackSet(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	stackInfo, err := r.stackSetInfo(ctx, stackSet)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := r.listInstances(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := 0
+	for _, instance := range instances {
+		status := string(instance.Status)
+		if instance.StackInstanceStatus != nil && instance.StackInstanceStatus.DetailedStatus != "" {
+			status = string(instance.StackInstanceStatus.DetailedStatus)
+		}
+		if instance.Status == types.StackInstanceStatusInoperable ||
+			status == string(types.StackInstanceDetailedStatusFailed) {
+			failed++
+		}
+
+		stackInfo.Resources = append(stackInfo.Resources, fmt.Sprintf("%v/%v: %v",
+			r.cf.strOrEmpty(instance.Account), r.cf.strOrEmpty(instance.Region), status))
+	}
+	if failed > 0 {
+		stackInfo.DeployStatus.Reason = fmt.Sprintf("%v (%v of %v instances failed)", stackInfo.DeployStatus.Reason,
+			failed, len(instances))
+	}
+
+	return stackInfo, nil
+}
+
+// GetStackOutputs returns no outputs, StackSets don't expose the outputs of their instances
+func (r *StackSetRepo) GetStackOutputs(ctx context.Context, name string) (map[string]string, error) {
+	_, err := r.describeStackSet(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{}, nil
+}
+
+func (r *StackSetRepo) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	stackSet, err := r.describeStackSet(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{}
+	for _, param := range stackSet.Parameters {
+		params[r.cf.strOrEmpty(param.ParameterKey)] = r.cf.strOrEmpty(param.ParameterValue)
+	}
+
+	return &model.StackSnapshot{
+		Name:         name,
+		TemplateBody: r.cf.strOrEmpty(stackSet.TemplateBody),
+		Parameters:   params,
+	}, nil
+}
+
+// RollbackStack stops a running operation. Stopping doesn't undo the instances that were already changed, so with a
+// snapshot the previous template and params are then deployed to every instance.
+func (r *StackSetRepo) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	stackSet, err := r.describeStackSet(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := r.latestOperation(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if op != nil && r.isRunning(op.Status) {
+		_, err = r.client.StopStackSetOperation(ctx, &cloudformation.StopStackSetOperationInput{
+			StackSetName: &name,
+			OperationId:  op.OperationId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to stop stack set operation: %w", err)
+		}
+
+		if snapshot == nil {
+			return newStackInfo(name, model.NextActionUpdate, r.operationToState(op.Action, op.Status),
+				"Cloudformation StopStackSetOperation", r.cf.strOrEmpty(op.OperationId)), nil
+		}
+
+		_, err = r.waitForOperation(ctx, name, op.OperationId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if snapshot == nil {
+		return r.stackSetInfo(ctx, stackSet)
+	}
+
+	cfParams := []types.Parameter{}
+	for k, v := range snapshot.Parameters {
+		param := types.Parameter{
+			ParameterKey: aws.String(k),
+		}
+		if v == cfNoEchoValue {
+			// NoEcho values can't be read back, keep whatever is deployed
+			param.UsePreviousValue = aws.Bool(true)
+		} else {
+			param.ParameterValue = aws.String(v)
+		}
+		cfParams = append(cfParams, param)
+	}
+
+	templateBody, templateUrl, err := r.cf.bodyOrUrl(ctx, []byte(snapshot.TemplateBody))
+	if err != nil {
+		return nil, err
+	}
+
+	// Without the roles of the stack set, a self-managed stack set falls back to the default roles
+	resp, err := r.client.UpdateStackSet(ctx, &cloudformation.UpdateStackSetInput{
+		StackSetName:          &name,
+		TemplateBody:          templateBody,
+		TemplateURL:           templateUrl,
+		Parameters:            cfParams,
+		AdministrationRoleARN: stackSet.AdministrationRoleARN,
+		ExecutionRoleName:     stackSet.ExecutionRoleName,
+		Capabilities: []types.Capability{
+			types.CapabilityCapabilityNamedIam,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to update stack set: %w", err)
+	}
+
+	return newStackInfo(name, model.NextActionUpdate, model.StateUpdating, "Cloudformation RollbackStackSet",
+		r.cf.strOrEmpty(resp.OperationId)), nil
+}
+
+func (r *StackSetRepo) ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error) {
+	retVal := []model.StackInfo{}
+
+	err := r.iterateStackSets(ctx, func(stackSet *types.StackSet) error {
+		if r.tagValue(stackSet.Tags, model.StackKeyEnvName) != envName {
+			return nil
+		}
+
+		stackInfo, err := r.stackSetInfo(ctx, stackSet)
+		if err != nil {
+			return err
+		}
+		retVal = append(retVal, *stackInfo)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stack sets: %w", err)
+	}
+
+	return retVal, nil
+}
+
+func (r *StackSetRepo) ListEnvironments(ctx context.Context) ([]string, error) {
+	uniqueValues := map[string]struct{}{}
+
+	err := r.iterateStackSets(ctx, func(stackSet *types.StackSet) error {
+		envName := r.tagValue(stackSet.Tags, model.StackKeyEnvName)
+		if envName != "" {
+			uniqueValues[envName] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	retVal := []string{}
+	for value := range uniqueValues {
+		retVal = append(retVal, value)
+	}
+
+	return retVal, nil
+}
+
+func (r *StackSetRepo) GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error) {
+	stacks, err := r.ListStacks(ctx, envName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get environment: %w", err)
+	}
+
+	return newEnvironmentInfo(envName, stacks)
+}
+
+func (r *StackSetRepo) IsEnvironmentInState(ctx context.Context, envName string, stacks []string, states []model.State) (bool, []string, error) {
+	stackCompleteList := []string{}
+
+	for _, stackName := range stacks {
+		stackSet, err := r.describeStackSet(ctx, stackName)
+		if err != nil {
+			if errors.Is(err, apperr.GenNotFoundError) && r.cf.hasState(states, model.StateDeleted) {
+				stackCompleteList = append(stackCompleteList, stackName)
+				continue
+			}
+			return false, stackCompleteList, err
+		}
+
+		stackInfo, err := r.stackSetInfo(ctx, stackSet)
+		if err != nil {
+			return false, stackCompleteList, err
+		}
+
+		if r.cf.hasState(states, stackInfo.DeployStatus.State) {
+			stackCompleteList = append(stackCompleteList, stackName)
+		}
+
+		if stackInfo.DeployStatus.State == model.StateFailed {
+			return false, nil, fmt.Errorf("stack set %v failed: %v", stackName, stackInfo.DeployStatus.Reason)
+		}
+	}
+
+	return len(stackCompleteList) == len(stacks), stackCompleteList, nil
+}
+
+func (r *StackSetRepo) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	return "", apperr.NewUnsupportedError("drift detection", model.IacTypeCfSet)
+}
+
+func (r *StackSetRepo) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	return nil, apperr.NewUnsupportedError("drift detection", model.IacTypeCfSet)
+}
+
+// stackSetInfo returns the state of the latest operation on the stack set. A stack set without operations has no
+// instances to deploy and is complete.
+func (r *StackSetRepo) stackSetInfo(ctx context.Context, stackSet *types.StackSet) (*model.StackInfo, error) {
+	name := r.cf.strOrEmpty(stackSet.StackSetName)
+	stackInfo := newStackInfo(name, model.NextActionUpdate, model.StateComplete, "", r.cf.strOrEmpty(stackSet.StackSetId))
+
+	op, err := r.latestOperation(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if op != nil {
+		stackInfo.DeployStatus.State = r.operationToState(op.Action, op.Status)
+		stackInfo.DeployStatus.Reason = r.cf.strOrEmpty(op.StatusReason)
+		if stackInfo.DeployStatus.Reason == "" {
+			stackInfo.DeployStatus.Reason = fmt.Sprintf("%v %v", op.Action, op.Status)
+		}
+	}
+
+	return stackInfo, nil
+}
+
+func (r *StackSetRepo) stackSetConfig(name string, stack *model.StackConfig) (*model.StackSetConfig, error) {
+	if stack.StackSet == nil {
+		return nil, fmt.Errorf("stack %v has no stack_set block", name)
+	}
+
+	return stack.StackSet, nil
+}
+
+func (r *StackSetRepo) describeStackSet(ctx context.Context, name string) (*types.StackSet, error) {
+	resp, err := r.client.DescribeStackSet(ctx, &cloudformation.DescribeStackSetInput{
+		StackSetName: &name,
+	})
+	if err != nil {
+		var notFound *types.StackSetNotFoundException
+		if errors.As(err, &notFound) {
+			return nil, apperr.NewNotFoundError("stack set", name)
+		}
+		return nil, fmt.Errorf("unable to describe stack set: %w", err)
+	}
+	if resp.StackSet == nil || resp.StackSet.Status == types.StackSetStatusDeleted {
+		return nil, apperr.NewNotFoundError("stack set", name)
+	}
+
+	return resp.StackSet, nil
+}
+
+func (r *StackSetRepo) listInstances(ctx context.Context, name string) ([]types.StackInstanceSummary, error) {
+	instances := []types.StackInstanceSummary{}
+
+	paginator := cloudformation.NewListStackInstancesPaginator(r.client, &cloudformation.ListStackInstancesInput{
+		StackSetName: &name,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			var notFound *types.StackSetNotFoundException
+			if errors.As(err, &notFound) {
+				return nil, apperr.NewNotFoundError("stack set", name)
+			}
+			return nil, fmt.Errorf("failed to list stack instances: %w", err)
+		}
+		instances = append(instances, page.Summaries...)
+	}
+
+	return instances, nil
+}
+
+// latestOperation returns the most recent operation that changed the instances, or nil if there is none
+func (r *StackSetRepo) latestOperation(ctx context.Context, name string) (*types.StackSetOperationSummary, error) {
+	var latest *types.StackSetOperationSummary
+
+	paginator := cloudformation.NewListStackSetOperationsPaginator(r.client, &cloudformation.ListStackSetOperationsInput{
+		StackSetName: &name,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list stack set operations: %w", err)
+		}
+
+		for i := range page.Summaries {
+			op := &page.Summaries[i]
+			if op.Action == types.StackSetOperationActionDetectDrift || op.CreationTimestamp == nil {
+				continue
+			}
+			if latest == nil || op.CreationTimestamp.After(*latest.CreationTimestamp) {
+				latest = op
+			}
+		}
+	}
+
+	return latest, nil
+}
+
+func (r *StackSetRepo) iterateStackSets(ctx context.Context, stackSetFunc func(stackSet *types.StackSet) error) error {
+	paginator := cloudformation.NewListStackSetsPaginator(r.client, &cloudformation.ListStackSetsInput{
+		Status: types.StackSetStatusActive,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get page when listing stack sets: %w", err)
+		}
+
+		// The summaries don't include tags
+		for _, summary := range page.Summaries {
+			stackSet, err := r.describeStackSet(ctx, r.cf.strOrEmpty(summary.StackSetName))
+			if err != nil {
+				if errors.Is(err, apperr.GenNotFoundError) {
+					continue
+				}
+				return err
+			}
+
+			err = stackSetFunc(stackSet)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// runOperations starts the operations in order. Only one operation can run on a stack set at a time, so each waits for
+// the previous one. The last operation is only waited on if waitLast is set. It returns the id of the last operation.
+func (r *StackSetRepo) runOperations(ctx context.Context, name string, ops []func() (*string, error),
+	waitLast bool) (string, error) {
+	opId := ""
+	for i, op := range ops {
+		id, err := op()
+		if err != nil {
+			return "", err
+		}
+		opId = r.cf.strOrEmpty(id)
+
+		if i == len(ops)-1 && !waitLast {
+			break
+		}
+
+		status, err := r.waitForOperation(ctx, name, id)
+		if err != nil {
+			return "", err
+		}
+		if status.Status != types.StackSetOperationStatusSucceeded {
+			return "", fmt.Errorf("stack set %v operation %v %v: %v", name, opId, status.Status,
+				r.cf.strOrEmpty(status.StatusReason))
+		}
+	}
+
+	return opId, nil
+}
+
+// waitForOperation polls an operation until it is no longer running
+func (r *StackSetRepo) waitForOperation(ctx context.Context, name string, opId *string) (*types.StackSetOperation, error) {
+	interval := r.retry.PollInterval()
+	for {
+		resp, err := r.client.DescribeStackSetOperation(ctx, &cloudformation.DescribeStackSetOperationInput{
+			StackSetName: &name,
+			OperationId:  opId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to describe stack set operation: %w", err)
+		}
+
+		if resp.StackSetOperation != nil && !r.isRunning(resp.StackSetOperation.Status) {
+			return resp.StackSetOperation, nil
+		}
+
+		err = backoff.Sleep(ctx, interval.Next(false))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *StackSetRepo) createInstancesOp(ctx context.Context, name string, cfg *model.StackSetConfig,
+	group stackSetGroup) func() (*string, error) {
+	return func() (*string, error) {
+		resp, err := r.client.CreateStackInstances(ctx, &cloudformation.CreateStackInstancesInput{
+			StackSetName:         &name,
+			Regions:              group.regions,
+			DeploymentTargets:    r.deploymentTargets(cfg.IsServiceManaged(), group.targets),
+			OperationPreferences: r.operationPreferences(cfg),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create stack instances: %w", err)
+		}
+		return resp.OperationId, nil
+	}
+}
+
+func (r *StackSetRepo) deleteInstancesOp(ctx context.Context, name string, serviceManaged bool,
+	prefs *types.StackSetOperationPreferences, group stackSetGroup) func() (*string, error) {
+	return func() (*string, error) {
+		resp, err := r.client.DeleteStackInstances(ctx, &cloudformation.DeleteStackInstancesInput{
+			StackSetName:         &name,
+			Regions:              group.regions,
+			DeploymentTargets:    r.deploymentTargets(serviceManaged, group.targets),
+			OperationPreferences: prefs,
+			RetainStacks:         false,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to delete stack instances: %w", err)
+		}
+		return resp.OperationId, nil
+	}
+}
+
+func (r *StackSetRepo) deploymentTargets(serviceManaged bool, targets []string) *types.DeploymentTargets {
+	if serviceManaged {
+		return &types.DeploymentTargets{OrganizationalUnitIds: targets}
+	}
+	return &types.DeploymentTargets{Accounts: targets}
+}
+
+func (r *StackSetRepo) operationPreferences(cfg *model.StackSetConfig) *types.StackSetOperationPreferences {
+	prefs := cfg.Preferences
+	return &types.StackSetOperationPreferences{
+		FailureToleranceCount:      r.optInt32(prefs.FailureToleranceCount),
+		FailureTolerancePercentage: r.optInt32(prefs.FailureTolerancePercentage),
+		MaxConcurrentCount:         r.optInt32(prefs.MaxConcurrentCount),
+		MaxConcurrentPercentage:    r.optInt32(prefs.MaxConcurrentPercentage),
+		RegionConcurrencyType:      types.RegionConcurrencyType(prefs.RegionConcurrency),
+	}
+}
+
+// instanceSet returns the regions of each target
+func (r *StackSetRepo) instanceSet(targets []string, regions []string) map[string]map[string]bool {
+	retVal := map[string]map[string]bool{}
+	for _, target := range targets {
+		retVal[target] = map[string]bool{}
+		for _, region := range regions {
+			retVal[target][region] = true
+		}
+	}
+	return retVal
+}
+
+// instanceTargets returns the regions of each target of the instances. Instances of a service-managed stack set are
+// targeted by their organizational unit.
+func (r *StackSetRepo) instanceTargets(instances []types.StackInstanceSummary) map[string]map[string]bool {
+	retVal := map[string]map[string]bool{}
+	for _, instance := range instances {
+		target := r.cf.strOrEmpty(instance.OrganizationalUnitId)
+		if target == "" {
+			target = r.cf.strOrEmpty(instance.Account)
+		}
+		if retVal[target] == nil {
+			retVal[target] = map[string]bool{}
+		}
+		retVal[target][r.cf.strOrEmpty(instance.Region)] = true
+	}
+	return retVal
+}
+
+// instanceDiff returns the target regions in a that aren't in b
+func (r *StackSetRepo) instanceDiff(a map[string]map[string]bool, b map[string]map[string]bool) map[string]map[string]bool {
+	retVal := map[string]map[string]bool{}
+	for target, regions := range a {
+		for region := range regions {
+			if !b[target][region] {
+				if retVal[target] == nil {
+					retVal[target] = map[string]bool{}
+				}
+				retVal[target][region] = true
+			}
+		}
+	}
+	return retVal
+}
+
+// groupByRegions groups the targets that have the same regions
+func (r *StackSetRepo) groupByRegions(instances map[string]map[string]bool) []stackSetGroup {
+	groups := map[string]*stackSetGroup{}
+	keys := []string{}
+	for target, regionSet := range instances {
+		regions := []string{}
+		for region := range regionSet {
+			regions = append(regions, region)
+		}
+		sort.Strings(regions)
+
+		key := strings.Join(regions, ",")
+		if groups[key] == nil {
+			groups[key] = &stackSetGroup{regions: regions}
+			keys = append(keys, key)
+		}
+		groups[key].targets = append(groups[key].targets, target)
+	}
+	sort.Strings(keys)
+
+	retVal := []stackSetGroup{}
+	for _, key := range keys {
+		sort.Strings(groups[key].targets)
+		retVal = append(retVal, *groups[key])
+	}
+	return retVal
+}
+
+func (r *StackSetRepo) instanceNames(instances map[string]map[string]bool) []string {
+	retVal := []string{}
+	for target, regions := range instances {
+		for region := range regions {
+			retVal = append(retVal, fmt.Sprintf("%v/%v", target, region))
+		}
+	}
+	sort.Strings(retVal)
+	return retVal
+}
+
+func (r *StackSetRepo) operationToState(action types.StackSetOperationAction, status types.StackSetOperationStatus) model.State {
+	switch status {
+	case types.StackSetOperationStatusSucceeded:
+		return model.StateComplete
+	case types.StackSetOperationStatusFailed, types.StackSetOperationStatusStopped:
+		return model.StateFailed
+	case types.StackSetOperationStatusRunning, types.StackSetOperationStatusQueued,
+		types.StackSetOperationStatusStopping:
+		switch action {
+		case types.StackSetOperationActionCreate:
+			return model.StateCreating
+		case types.StackSetOperationActionDelete:
+			return model.StateDeleting
+		default:
+			return model.StateUpdating
+		}
+	default:
+		return model.StateUnknown
+	}
+}
+
+func (r *StackSetRepo) isRunning(status types.StackSetOperationStatus) bool {
+	return status == types.StackSetOperationStatusRunning || status == types.StackSetOperationStatusQueued ||
+		status == types.StackSetOperationStatusStopping
+}
+
+func (r *StackSetRepo) tagValue(tags []types.Tag, key string) string {
+	return r.cf.tagValue(tags, key)
+}
+
+func (r *StackSetRepo) optString(str string) *string {
+	if str == "" {
+		return nil
+	}
+	return &str
+}
+
+func (r *StackSetRepo) optInt32(i *int) *int32 {
+	if i == nil {
+		return nil
+	}
+	return aws.Int32(int32(*i))
+}
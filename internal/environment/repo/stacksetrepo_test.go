@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	mockaws "github.com/swizzleio/swiz/mocks/ext/aws"
+)
+
+func newTestStackSetRepo() *StackSetRepo {
+	return &StackSetRepo{
+		cf: &CloudFormationRepo{},
+	}
+}
+
+func TestStackSetRepo_InstanceDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    map[string]map[string]bool
+		b    map[string]map[string]bool
+		want map[string]map[string]bool
+	}{
+		{
+			name: "same instances",
+			a:    map[string]map[string]bool{"111": {"us-east-1": true}},
+			b:    map[string]map[string]bool{"111": {"us-east-1": true}},
+			want: map[string]map[string]bool{},
+		},
+		{
+			name: "new target",
+			a:    map[string]map[string]bool{"111": {"us-east-1": true}, "222": {"us-east-1": true, "eu-west-1": true}},
+			b:    map[string]map[string]bool{"111": {"us-east-1": true}},
+			want: map[string]map[string]bool{"222": {"us-east-1": true, "eu-west-1": true}},
+		},
+		{
+			name: "new region of an existing target",
+			a:    map[string]map[string]bool{"111": {"us-east-1": true, "eu-west-1": true}},
+			b:    map[string]map[string]bool{"111": {"us-east-1": true}},
+			want: map[string]map[string]bool{"111": {"eu-west-1": true}},
+		},
+		{
+			name: "nothing to diff against",
+			a:    map[string]map[string]bool{"111": {"us-east-1": true}},
+			b:    map[string]map[string]bool{},
+			want: map[string]map[string]bool{"111": {"us-east-1": true}},
+		},
+		{
+			name: "only in b",
+			a:    map[string]map[string]bool{},
+			b:    map[string]map[string]bool{"111": {"us-east-1": true}},
+			want: map[string]map[string]bool{},
+		},
+	}
+
+	r := newTestStackSetRepo()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.instanceDiff(tt.a, tt.b))
+		})
+	}
+}
+
+func TestStackSetRepo_GroupByRegions(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances map[string]map[string]bool
+		want      []stackSetGroup
+	}{
+		{
+			name:      "no instances",
+			instances: map[string]map[string]bool{},
+			want:      []stackSetGroup{},
+		},
+		{
+			name: "targets with the same regions share a group",
+			instances: map[string]map[string]bool{
+				"333": {"us-east-1": true, "eu-west-1": true},
+				"111": {"eu-west-1": true, "us-east-1": true},
+				"222": {"us-west-2": true},
+			},
+			want: []stackSetGroup{
+				{targets: []string{"111", "333"}, regions: []string{"eu-west-1", "us-east-1"}},
+				{targets: []string{"222"}, regions: []string{"us-west-2"}},
+			},
+		},
+		{
+			name: "overlapping regions are separate groups",
+			instances: map[string]map[string]bool{
+				"111": {"us-east-1": true},
+				"222": {"us-east-1": true, "us-west-2": true},
+			},
+			want: []stackSetGroup{
+				{targets: []string{"111"}, regions: []string{"us-east-1"}},
+				{targets: []string{"222"}, regions: []string{"us-east-1", "us-west-2"}},
+			},
+		},
+	}
+
+	r := newTestStackSetRepo()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.groupByRegions(tt.instances))
+		})
+	}
+}
+
+func TestStackSetRepo_InstanceTargets(t *testing.T) {
+	r := newTestStackSetRepo()
+
+	instances := []types.StackInstanceSummary{
+		{Account: aws.String("111"), Region: aws.String("us-east-1")},
+		{Account: aws.String("111"), Region: aws.String("eu-west-1")},
+		{Account: aws.String("222"), OrganizationalUnitId: aws.String("ou-abcd"), Region: aws.String("us-east-1")},
+		{Account: aws.String("333"), OrganizationalUnitId: aws.String("ou-abcd"), Region: aws.String("us-east-1")},
+	}
+
+	targets := r.instanceTargets(instances)
+	assert.Equal(t, map[string]map[string]bool{
+		"111":     {"us-east-1": true, "eu-west-1": true},
+		"ou-abcd": {"us-east-1": true},
+	}, targets)
+	assert.Equal(t, []string{"111/eu-west-1", "111/us-east-1", "ou-abcd/us-east-1"}, r.instanceNames(targets))
+
+	// Adding regions only creates the missing instances, grouped by the regions they need
+	desired := r.instanceSet([]string{"111", "ou-abcd"}, []string{"us-east-1", "eu-west-1", "us-west-2"})
+	assert.Equal(t, []stackSetGroup{
+		{targets: []string{"ou-abcd"}, regions: []string{"eu-west-1", "us-west-2"}},
+		{targets: []string{"111"}, regions: []string{"us-west-2"}},
+	}, r.groupByRegions(r.instanceDiff(desired, targets)))
+	assert.Empty(t, r.groupByRegions(r.instanceDiff(targets, desired)))
+}
+
+func TestStackSetRepo_OperationToState(t *testing.T) {
+	tests := []struct {
+		action types.StackSetOperationAction
+		status types.StackSetOperationStatus
+		want   model.State
+	}{
+		{action: types.StackSetOperationActionCreate, status: types.StackSetOperationStatusSucceeded, want: model.StateComplete},
+		{action: types.StackSetOperationActionUpdate, status: types.StackSetOperationStatusFailed, want: model.StateFailed},
+		{action: types.StackSetOperationActionUpdate, status: types.StackSetOperationStatusStopped, want: model.StateFailed},
+		{action: types.StackSetOperationActionCreate, status: types.StackSetOperationStatusRunning, want: model.StateCreating},
+		{action: types.StackSetOperationActionDelete, status: types.StackSetOperationStatusQueued, want: model.StateDeleting},
+		{action: types.StackSetOperationActionUpdate, status: types.StackSetOperationStatusStopping, want: model.StateUpdating},
+		{action: types.StackSetOperationActionUpdate, status: "SOMETHING_NEW", want: model.StateUnknown},
+	}
+
+	r := newTestStackSetRepo()
+	for _, tt := range tests {
+		t.Run(string(tt.action)+" "+string(tt.status), func(t *testing.T) {
+			assert.Equal(t, tt.want, r.operationToState(tt.action, tt.status))
+		})
+	}
+}
+
+func TestStackSetRepo_RollbackStackKeepsRoles(t *testing.T) {
+	client := mockaws.NewCloudformationer(t)
+	client.On("DescribeStackSet", mock.Anything, mock.Anything).Return(&cloudformation.DescribeStackSetOutput{
+		StackSet: &types.StackSet{
+			StackSetName:          aws.String("dev-app"),
+			Status:                types.StackSetStatusActive,
+			AdministrationRoleARN: aws.String("arn:aws:iam::111111111111:role/SwizAdmin"),
+			ExecutionRoleName:     aws.String("SwizExecution"),
+		},
+	}, nil)
+	client.On("ListStackSetOperations", mock.Anything, mock.Anything).Return(
+		&cloudformation.ListStackSetOperationsOutput{}, nil)
+	client.On("UpdateStackSet", mock.Anything, mock.MatchedBy(func(input *cloudformation.UpdateStackSetInput) bool {
+		return aws.ToString(input.AdministrationRoleARN) == "arn:aws:iam::111111111111:role/SwizAdmin" &&
+			aws.ToString(input.ExecutionRoleName) == "SwizExecution"
+	})).Return(&cloudformation.UpdateStackSetOutput{OperationId: aws.String("op-1")}, nil)
+	r := &StackSetRepo{
+		cf:     &CloudFormationRepo{},
+		client: client,
+	}
+
+	stackInfo, err := r.RollbackStack(context.Background(), "dev-app", &model.StackSnapshot{
+		TemplateBody: cfTestTemplate,
+		Parameters:   map[string]string{"Size": "small"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateUpdating, stackInfo.DeployStatus.State)
+}
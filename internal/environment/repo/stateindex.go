@@ -0,0 +1,286 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+var DefaultStateLocation = "file://~/.swiz/state"
+
+// Deployers for different providers of the same IaC type share an index file, so they share the index to serialize
+// access to it
+var (
+	enclaveIndexes   = map[string]*StateIndex{}
+	enclaveIndexesMu sync.Mutex
+)
+
+// StateIndex is a swiz-managed index of deployed stacks stored as a JSON file. IaC tools that have no notion of an
+// environment use it to list stacks and environments the same way CloudFormation does with tags.
+type StateIndex struct {
+	location string
+	openUrl  fileutil.FileUrlHelper
+	fh       fileutil.FileHelper
+	mu       sync.Mutex
+}
+
+func NewStateIndex(location string) *StateIndex {
+	return &StateIndex{
+		location: location,
+		openUrl:  fileutil.NewFileUrlHelper(),
+		fh:       fileutil.NewFileHelper(),
+	}
+}
+
+// NewEnclaveStateIndex returns the index for an IaC type in an enclave
+func NewEnclaveStateIndex(enclave model.Enclave, iacType string) *StateIndex {
+	location := fmt.Sprintf("%v/%v/%v.json", DefaultStateLocation, enclave.Name, strings.ToLower(iacType))
+
+	enclaveIndexesMu.Lock()
+	defer enclaveIndexesMu.Unlock()
+
+	if enclaveIndexes[location] == nil {
+		enclaveIndexes[location] = NewStateIndex(location)
+	}
+
+	return enclaveIndexes[location]
+}
+
+func (i *StateIndex) Get(name string) (*model.StackRecord, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	records, err := i.load()
+	if err != nil {
+		return nil, err
+	}
+
+	rec, ok := records[name]
+	if !ok {
+		return nil, apperr.NewNotFoundError("stack", name)
+	}
+
+	return rec, nil
+}
+
+func (i *StateIndex) Put(rec *model.StackRecord) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	records, err := i.load()
+	if err != nil {
+		return err
+	}
+
+	rec.Updated = time.Now()
+	records[rec.Name] = rec
+
+	return i.save(records)
+}
+
+func (i *StateIndex) Delete(name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	records, err := i.load()
+	if err != nil {
+		return err
+	}
+
+	delete(records, name)
+
+	return i.save(records)
+}
+
+// List returns the records in an environment sorted by name. An empty env name returns every record.
+func (i *StateIndex) List(envName string) ([]model.StackRecord, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	records, err := i.load()
+	if err != nil {
+		return nil, err
+	}
+
+	retVal := []model.StackRecord{}
+	for _, rec := range records {
+		if envName == "" || rec.EnvName == envName {
+			retVal = append(retVal, *rec)
+		}
+	}
+	sort.Slice(retVal, func(a, b int) bool {
+		return retVal[a].Name < retVal[b].Name
+	})
+
+	return retVal, nil
+}
+
+func (i *StateIndex) GetStackInfo(name string) (*model.StackInfo, error) {
+	rec, err := i.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stackInfo := rec.ToStackInfo()
+	return &stackInfo, nil
+}
+
+func (i *StateIndex) ListStacks(envName string) ([]model.StackInfo, error) {
+	records, err := i.List(envName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stacks: %w", err)
+	}
+
+	retVal := []model.StackInfo{}
+	for _, rec := range records {
+		retVal = append(retVal, rec.ToStackInfo())
+	}
+
+	return retVal, nil
+}
+
+func (i *StateIndex) ListEnvironments() ([]string, error) {
+	records, err := i.List("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	// Store unique values
+	uniqueValues := map[string]struct{}{}
+	for _, rec := range records {
+		uniqueValues[rec.EnvName] = struct{}{}
+	}
+
+	retVal := []string{}
+	for value := range uniqueValues {
+		retVal = append(retVal, value)
+	}
+	sort.Strings(retVal)
+
+	return retVal, nil
+}
+
+func (i *StateIndex) GetEnvironment(envName string) (*model.EnvironmentInfo, error) {
+	stacks, err := i.ListStacks(envName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get environment: %w", err)
+	}
+
+	return newEnvironmentInfo(envName, stacks)
+}
+
+// newEnvironmentInfo sums up the state of the stacks in an environment. An environment with no stacks is not found.
+func newEnvironmentInfo(envName string, stacks []model.StackInfo) (*model.EnvironmentInfo, error) {
+	if len(stacks) == 0 {
+		return nil, apperr.NewNotFoundError("environment", envName)
+	}
+
+	envInfo := model.NewEnvironmentInfo(envName, stacks)
+	return &envInfo, nil
+}
+
+func (i *StateIndex) IsEnvironmentInState(stacks []string, states []model.State) (bool, []string, error) {
+	stackCompleteList := []string{}
+
+	for _, stackName := range stacks {
+		rec, err := i.Get(stackName)
+		if err != nil {
+			if errors.Is(err, apperr.GenNotFoundError) && i.hasState(states, model.StateDeleted) {
+				// Deleted stacks are removed from the index
+				stackCompleteList = append(stackCompleteList, stackName)
+				continue
+			}
+			return false, stackCompleteList, err
+		}
+
+		if i.hasState(states, rec.State) {
+			stackCompleteList = append(stackCompleteList, stackName)
+		} else if rec.State == model.StateFailed {
+			return false, nil, fmt.Errorf("stack %v failed: %v", stackName, rec.Reason)
+		}
+	}
+
+	return len(stackCompleteList) == len(stacks), stackCompleteList, nil
+}
+
+// outputStrings converts JSON output values to strings. Strings are passed as is, anything else stays JSON.
+func outputStrings(values map[string]json.RawMessage) map[string]string {
+	retVal := map[string]string{}
+	for k, v := range values {
+		var str string
+		if json.Unmarshal(v, &str) == nil {
+			retVal[k] = str
+		} else {
+			retVal[k] = string(v)
+		}
+	}
+
+	return retVal
+}
+
+// newStackInfo returns the stack info for a stack deployed by a tool that runs to completion
+func newStackInfo(name string, action model.NextAction, state model.State, reason string, details string) *model.StackInfo {
+	return &model.StackInfo{
+		Name:       name,
+		NextAction: action,
+		DeployStatus: model.DeployStatus{
+			Name:    name,
+			State:   state,
+			Reason:  reason,
+			Details: details,
+		},
+		Resources: []string{},
+	}
+}
+
+func (i *StateIndex) hasState(states []model.State, state model.State) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (i *StateIndex) load() (map[string]*model.StackRecord, error) {
+	records := map[string]*model.StackRecord{}
+
+	data, err := i.openUrl.OpenUrl(i.location)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return records, nil
+		}
+		return nil, fmt.Errorf("unable to open state index: %w", err)
+	}
+
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse state index: %w", err)
+	}
+
+	return records, nil
+}
+
+func (i *StateIndex) save(records map[string]*model.StackRecord) error {
+	err := i.fh.CreateDirIfNotExist(i.location)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return i.openUrl.WriteUrl(i.location, data)
+}
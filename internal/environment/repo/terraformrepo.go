@@ -0,0 +1,386 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/swizzleio/swiz/internal/appconfig"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+const (
+	TerraformBinary = "terraform"
+	OpenTofuBinary  = "tofu"
+)
+
+var DefaultTerraformDataLocation = "file://~/.swiz/terraform"
+
+// Stacks that share a module init it at the same time, which races on the dependency lock file in the module dir, so
+// init is serialized per module dir
+var (
+	moduleInitLocks   = map[string]*sync.Mutex{}
+	moduleInitLocksMu sync.Mutex
+)
+
+// TerraformRepo deploys each stack as a Terraform (or OpenTofu) workspace of the module directory in template_file.
+// Terraform has no notion of an environment, so deployed stacks are tracked in a swiz-managed state index.
+type TerraformRepo struct {
+	binary   string
+	iacType  string
+	provider *model.EncProvider
+	creds    *awsCredentials
+	index    *StateIndex
+	exec     execwrap.Execer
+	openUrl  fileutil.FileUrlHelper
+	dataDir  string
+}
+
+func NewTerraformRepo(config appconfig.AppConfig, enclave model.Enclave, provider *model.EncProvider,
+	iacType string, binary string) IacDeployer {
+	return &TerraformRepo{
+		binary:   binary,
+		iacType:  iacType,
+		provider: provider,
+		creds:    newAwsCredentials(provider),
+		index:    NewEnclaveStateIndex(enclave, iacType),
+		exec:     execwrap.NewExec(),
+		openUrl:  fileutil.NewFileUrlHelper(),
+		dataDir:  fmt.Sprintf("%v/%v", DefaultTerraformDataLocation, enclave.Name),
+	}
+}
+
+func (r *TerraformRepo) CreateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.apply(ctx, name, stack, params, metadata, model.NextActionCreate, dryRun)
+}
+
+func (r *TerraformRepo) DeleteStack(ctx context.Context, name string, dryRun bool) (*model.StackInfo, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		if errors.Is(err, apperr.GenNotFoundError) {
+			// Nothing was deployed
+			return newStackInfo(name, model.NextActionDelete, model.StateDeleted, "Stack does not exist", ""), nil
+		}
+		return nil, err
+	}
+
+	dir, err := r.moduleDir(rec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	env, exists, err := r.prepare(ctx, name, dir, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		if !exists {
+			return newStackInfo(name, model.NextActionDelete, model.StateDryRun, "Dry Run, workspace does not exist", ""), nil
+		}
+		_, err = r.run(ctx, dir, env, append([]string{"plan", "-destroy", "-input=false", "-no-color"},
+			r.varArgs(rec.Params)...)...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to plan stack delete: %w", err)
+		}
+		return newStackInfo(name, model.NextActionDelete, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	_, err = r.run(ctx, dir, env, append([]string{"destroy", "-auto-approve", "-input=false", "-no-color"},
+		r.varArgs(rec.Params)...)...)
+	if err != nil {
+		// Leave the failure in the index, waiting on the stack reports it
+		rec.State = model.StateFailed
+		rec.Reason = err.Error()
+		return newStackInfo(name, model.NextActionDelete, model.StateFailed, rec.Reason, ""), r.index.Put(rec)
+	}
+
+	// The workspace can only be deleted once another one is selected
+	_, err = r.run(ctx, dir, env, "workspace", "select", "default")
+	if err == nil {
+		_, err = r.run(ctx, dir, env, "workspace", "delete", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete workspace: %w", err)
+	}
+
+	err = r.index.Delete(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, model.NextActionDelete, model.StateDeleted, fmt.Sprintf("%v destroy", r.iacType), ""), nil
+}
+
+func (r *TerraformRepo) UpdateStack(ctx context.Context, name string, stack *model.StackConfig,
+	params map[string]string, metadata map[string]string, dryRun bool) (*model.StackInfo, error) {
+	return r.apply(ctx, name, stack, params, metadata, model.NextActionUpdate, dryRun)
+}
+
+func (r *TerraformRepo) GetStackInfo(ctx context.Context, name string) (*model.StackInfo, error) {
+	return r.index.GetStackInfo(name)
+}
+
+func (r *TerraformRepo) GetStackOutputs(ctx context.Context, name string) (map[string]string, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return rec.Outputs, nil
+}
+
+func (r *TerraformRepo) GetStackSnapshot(ctx context.Context, name string) (*model.StackSnapshot, error) {
+	rec, err := r.index.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.StackSnapshot{
+		Name:       name,
+		Parameters: rec.Params,
+	}, nil
+}
+
+func (r *TerraformRepo) RollbackStack(ctx context.Context, name string, snapshot *model.StackSnapshot) (*model.StackInfo, error) {
+	if snapshot != nil {
+		// The module source is not versioned by swiz, so a previous apply can't be restored
+		return nil, apperr.NewUnsupportedError("rolling back an update", r.iacType)
+	}
+
+	// Applies run to completion, there is never an update in progress to cancel
+	return r.index.GetStackInfo(name)
+}
+
+func (r *TerraformRepo) ListStacks(ctx context.Context, envName string) ([]model.StackInfo, error) {
+	return r.index.ListStacks(envName)
+}
+
+func (r *TerraformRepo) ListEnvironments(ctx context.Context) ([]string, error) {
+	return r.index.ListEnvironments()
+}
+
+func (r *TerraformRepo) GetEnvironment(ctx context.Context, envName string) (*model.EnvironmentInfo, error) {
+	return r.index.GetEnvironment(envName)
+}
+
+func (r *TerraformRepo) IsEnvironmentInState(ctx context.Context, envName string, stacks []string, states []model.State) (bool, []string, error) {
+	return r.index.IsEnvironmentInState(stacks, states)
+}
+
+func (r *TerraformRepo) DetectStackDrift(ctx context.Context, name string) (string, error) {
+	return "", apperr.NewUnsupportedError("drift detection", r.iacType)
+}
+
+func (r *TerraformRepo) GetStackDrift(ctx context.Context, name string, detectionId string) (*model.StackDrift, error) {
+	return nil, apperr.NewUnsupportedError("drift detection", r.iacType)
+}
+
+// apply runs terraform apply in the workspace of the stack, or terraform plan for a dry run. Apply runs to completion,
+// a failure is recorded in the index and reported when waiting on the stack.
+func (r *TerraformRepo) apply(ctx context.Context, name string, stack *model.StackConfig, params map[string]string,
+	metadata map[string]string, action model.NextAction, dryRun bool) (*model.StackInfo, error) {
+	dir, err := r.moduleDir(stack.TemplateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	env, exists, err := r.prepare(ctx, name, dir, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		if !exists {
+			// Without a workspace there is no state to plan against, everything would be created
+			return newStackInfo(name, action, model.StateDryRun, "Dry Run, workspace would be created", ""), nil
+		}
+		_, err = r.run(ctx, dir, env, append([]string{"plan", "-input=false", "-no-color"}, r.varArgs(params)...)...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to plan stack: %w", err)
+		}
+		return newStackInfo(name, action, model.StateDryRun, "Dry Run", ""), nil
+	}
+
+	rec := &model.StackRecord{
+		Name:     name,
+		EnvName:  metadata[model.StackKeyEnvName],
+		Template: stack.TemplateFile,
+		Params:   params,
+		Metadata: map[string]string{},
+		Outputs:  map[string]string{},
+		State:    model.StateComplete,
+		Reason:   fmt.Sprintf("%v apply", r.iacType),
+	}
+
+	// Keep the create metadata on update
+	existing, err := r.index.Get(name)
+	if err == nil {
+		for k, v := range existing.Metadata {
+			rec.Metadata[k] = v
+		}
+	}
+	for k, v := range metadata {
+		rec.Metadata[k] = v
+	}
+
+	_, err = r.run(ctx, dir, env, append([]string{"apply", "-auto-approve", "-input=false", "-no-color"},
+		r.varArgs(params)...)...)
+	if err == nil {
+		rec.Outputs, err = r.outputs(ctx, dir, env)
+	}
+	if err != nil {
+		rec.State = model.StateFailed
+		rec.Reason = err.Error()
+	}
+
+	err = r.index.Put(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStackInfo(name, action, rec.State, rec.Reason, stack.TemplateFile), nil
+}
+
+// prepare initializes the module and selects the workspace of the stack. Each stack gets its own data dir so stacks
+// that share a module can run at the same time. A dry run never creates the workspace, false is returned if it does
+// not exist.
+func (r *TerraformRepo) prepare(ctx context.Context, name string, dir string, dryRun bool) (map[string]string, bool, error) {
+	dataDir, err := r.openUrl.GetPathFromUrl(fmt.Sprintf("%v/%v", r.dataDir, name), true)
+	if err != nil {
+		return nil, false, err
+	}
+
+	env, err := r.creds.Env(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	env["TF_DATA_DIR"] = dataDir
+	env["TF_IN_AUTOMATION"] = "1"
+
+	err = r.init(ctx, dir, env)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if dryRun {
+		exists, existsErr := r.workspaceExists(ctx, dir, env, name)
+		if existsErr != nil || !exists {
+			return env, false, existsErr
+		}
+	}
+
+	args := []string{"workspace", "select", name}
+	if !dryRun {
+		args = []string{"workspace", "select", "-or-create=true", name}
+	}
+	_, err = r.run(ctx, dir, env, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to select workspace: %w", err)
+	}
+
+	return env, true, nil
+}
+
+// init runs terraform init in the module dir, holding the lock of the dir
+func (r *TerraformRepo) init(ctx context.Context, dir string, env map[string]string) error {
+	moduleInitLocksMu.Lock()
+	lock, ok := moduleInitLocks[dir]
+	if !ok {
+		lock = &sync.Mutex{}
+		moduleInitLocks[dir] = lock
+	}
+	moduleInitLocksMu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	_, err := r.run(ctx, dir, env, "init", "-input=false", "-no-color")
+	if err != nil {
+		return fmt.Errorf("unable to init module: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TerraformRepo) workspaceExists(ctx context.Context, dir string, env map[string]string, name string) (bool, error) {
+	out, err := r.run(ctx, dir, env, "workspace", "list")
+	if err != nil {
+		return false, fmt.Errorf("unable to list workspaces: %w", err)
+	}
+
+	// The selected workspace is prefixed with a *
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*")) == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *TerraformRepo) outputs(ctx context.Context, dir string, env map[string]string) (map[string]string, error) {
+	out, err := r.run(ctx, dir, env, "output", "-json")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get outputs: %w", err)
+	}
+
+	tfOutputs := map[string]struct {
+		Value json.RawMessage `json:"value"`
+	}{}
+	err = json.Unmarshal(out, &tfOutputs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse outputs: %w", err)
+	}
+
+	values := map[string]json.RawMessage{}
+	for k, v := range tfOutputs {
+		values[k] = v.Value
+	}
+
+	return outputStrings(values), nil
+}
+
+func (r *TerraformRepo) run(ctx context.Context, dir string, env map[string]string, args ...string) ([]byte, error) {
+	return r.exec.Run(ctx, execwrap.Cmd{
+		Name: r.binary,
+		Args: args,
+		Dir:  dir,
+		Env:  env,
+	})
+}
+
+func (r *TerraformRepo) moduleDir(template string) (string, error) {
+	scheme, err := r.openUrl.GetScheme(template)
+	if err != nil {
+		return "", err
+	}
+	if scheme != "file" {
+		return "", fmt.Errorf("%v modules must be a local directory, got %v", r.iacType, template)
+	}
+
+	return r.openUrl.GetPathFromUrl(template, true)
+}
+
+func (r *TerraformRepo) varArgs(params map[string]string) []string {
+	keys := []string{}
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	retVal := []string{}
+	for _, k := range keys {
+		retVal = append(retVal, "-var", fmt.Sprintf("%v=%v", k, params[k]))
+	}
+
+	return retVal
+}
@@ -0,0 +1,216 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/pkg/execwrap"
+	"github.com/swizzleio/swiz/pkg/fileutil"
+)
+
+// fakeExec records the commands it runs and answers them with respond, or no output if respond is nil
+type fakeExec struct {
+	mu      sync.Mutex
+	cmds    []execwrap.Cmd
+	respond func(cmd execwrap.Cmd) ([]byte, error)
+}
+
+func (e *fakeExec) Run(ctx context.Context, cmd execwrap.Cmd) ([]byte, error) {
+	e.mu.Lock()
+	e.cmds = append(e.cmds, cmd)
+	e.mu.Unlock()
+
+	if e.respond == nil {
+		return nil, nil
+	}
+	return e.respond(cmd)
+}
+
+// commands returns the args of each command run, joined by spaces
+func (e *fakeExec) commands() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	retVal := []string{}
+	for _, cmd := range e.cmds {
+		retVal = append(retVal, strings.Join(cmd.Args, " "))
+	}
+	return retVal
+}
+
+// find returns the first command whose args start with prefix
+func (e *fakeExec) find(prefix string) *execwrap.Cmd {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, cmd := range e.cmds {
+		if strings.HasPrefix(strings.Join(cmd.Args, " "), prefix) {
+			return &e.cmds[i]
+		}
+	}
+	return nil
+}
+
+func newTestTerraformRepo(t *testing.T, exec execwrap.Execer) *TerraformRepo {
+	return &TerraformRepo{
+		binary:   TerraformBinary,
+		iacType:  "Terraform",
+		provider: &model.EncProvider{ProviderId: model.EncProvDummy},
+		creds:    newAwsCredentials(&model.EncProvider{ProviderId: model.EncProvDummy}),
+		index:    NewStateIndex("file://" + t.TempDir() + "/terraform.json"),
+		exec:     exec,
+		openUrl:  fileutil.NewFileUrlHelper(),
+		dataDir:  "file://" + t.TempDir(),
+	}
+}
+
+func TestTerraformRepo_CreateStack(t *testing.T) {
+	exec := &fakeExec{
+		respond: func(cmd execwrap.Cmd) ([]byte, error) {
+			if cmd.Args[0] == "output" {
+				return []byte(`{"vpc_id": {"value": "vpc-123"}}`), nil
+			}
+			return nil, nil
+		},
+	}
+	r := newTestTerraformRepo(t, exec)
+	moduleDir := t.TempDir()
+
+	stackInfo, err := r.CreateStack(context.Background(), "dev-network", &model.StackConfig{
+		Name:         "network",
+		TemplateFile: "file://" + moduleDir,
+	}, map[string]string{"db_password": "hunter2", "size": "2"}, map[string]string{model.StackKeyEnvName: "dev"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StateComplete, stackInfo.DeployStatus.State)
+
+	assert.Equal(t, []string{
+		"init -input=false -no-color",
+		"workspace select -or-create=true dev-network",
+		"apply -auto-approve -input=false -no-color -var db_password=hunter2 -var size=2",
+		"output -json",
+	}, exec.commands())
+
+	apply := exec.find("apply")
+	assert.Equal(t, moduleDir, apply.Dir)
+	assert.Equal(t, "1", apply.Env["TF_IN_AUTOMATION"])
+	assert.NotEmpty(t, apply.Env["TF_DATA_DIR"])
+
+	outputs, err := r.GetStackOutputs(context.Background(), "dev-network")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"vpc_id": "vpc-123"}, outputs)
+}
+
+func TestTerraformRepo_DryRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		workspaces string
+		wantCmds   []string
+		wantReason string
+	}{
+		{
+			name:       "existing workspace is planned",
+			workspaces: "  default\n* dev-other\n  dev-network\n",
+			wantCmds: []string{
+				"init -input=false -no-color",
+				"workspace list",
+				"workspace select dev-network",
+				"plan -input=false -no-color -var db_password=hunter2",
+			},
+			wantReason: "Dry Run",
+		},
+		{
+			name:       "selected workspace is planned",
+			workspaces: "  default\n* dev-network\n",
+			wantCmds: []string{
+				"init -input=false -no-color",
+				"workspace list",
+				"workspace select dev-network",
+				"plan -input=false -no-color -var db_password=hunter2",
+			},
+			wantReason: "Dry Run",
+		},
+		{
+			name:       "missing workspace is not created",
+			workspaces: "* default\n  dev-network-old\n",
+			wantCmds: []string{
+				"init -input=false -no-color",
+				"workspace list",
+			},
+			wantReason: "Dry Run, workspace would be created",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := &fakeExec{
+				respond: func(cmd execwrap.Cmd) ([]byte, error) {
+					if strings.Join(cmd.Args, " ") == "workspace list" {
+						return []byte(tt.workspaces), nil
+					}
+					return nil, nil
+				},
+			}
+			r := newTestTerraformRepo(t, exec)
+
+			stackInfo, err := r.UpdateStack(context.Background(), "dev-network", &model.StackConfig{
+				Name:         "network",
+				TemplateFile: "file://" + t.TempDir(),
+			}, map[string]string{"db_password": "hunter2"}, nil, true)
+			assert.NoError(t, err)
+			assert.Equal(t, model.StateDryRun, stackInfo.DeployStatus.State)
+			assert.Equal(t, tt.wantReason, stackInfo.DeployStatus.Reason)
+			assert.Equal(t, tt.wantCmds, exec.commands())
+
+			// A dry run leaves no record behind
+			_, err = r.GetStackInfo(context.Background(), "dev-network")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTerraformRepo_InitPerModuleDir(t *testing.T) {
+	var running, maxRunning int32
+	exec := &fakeExec{
+		respond: func(cmd execwrap.Cmd) ([]byte, error) {
+			if cmd.Args[0] == "init" {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			}
+			if cmd.Args[0] == "output" {
+				return []byte(`{}`), nil
+			}
+			return nil, nil
+		},
+	}
+	r := newTestTerraformRepo(t, exec)
+	stack := &model.StackConfig{
+		Name:         "app",
+		TemplateFile: "file://" + t.TempDir(),
+	}
+
+	wg := sync.WaitGroup{}
+	for _, name := range []string{"dev-app1", "dev-app2", "dev-app3"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			_, err := r.CreateStack(context.Background(), name, stack, nil, nil, false)
+			assert.NoError(t, err)
+		}(name)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), maxRunning)
+}
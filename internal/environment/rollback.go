@@ -0,0 +1,133 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/swizzleio/swiz/internal/environment/model"
+	"github.com/swizzleio/swiz/internal/environment/repo"
+	"github.com/swizzleio/swiz/pkg/errtype"
+)
+
+// stackChange is a stack that was created or updated by a deploy. snapshot is the state before the update.
+type stackChange struct {
+	stack    *model.StackConfig
+	name     string
+	deployer repo.IacDeployer
+	created  bool
+	snapshot *model.StackSnapshot
+}
+
+// RollbackErr is returned when a deploy failed and the stacks it changed were rolled back. Stacks holds the outcome of
+// the rollback for each stack.
+type RollbackErr struct {
+	Cause  error
+	Stacks []model.StackInfo
+}
+
+func (e RollbackErr) Error() string {
+	return fmt.Sprintf("deploy failed and was rolled back: %v", e.Cause)
+}
+
+func (e RollbackErr) Unwrap() error {
+	return e.Cause
+}
+
+// rollbackChanges undoes the stacks changed by a failed deploy in reverse dependency order. Created stacks are deleted
+// and updated stacks are returned to their previous version. This is best effort, a stack that fails to roll back is
+// reported in the summary and does not stop the other stacks.
+func (s EnvService) rollbackChanges(ctx context.Context, enclave *model.Enclave, envName string,
+	graph *model.DependencyGraph, changes map[string]stackChange, cause error) error {
+	stacks := map[string]*model.StackConfig{}
+	deployers := map[string]repo.IacDeployer{}
+	for name, change := range changes {
+		stacks[name] = change.stack
+		deployers[name] = change.deployer
+	}
+
+	var mu sync.Mutex
+	summary := []model.StackInfo{}
+	err := s.runGraph(ctx, enclave, envName, graph, stacks, deployers, true, 0, model.StateComplete,
+		func(stack *model.StackConfig) (string, error) {
+			stackInfo := s.rollbackStack(ctx, enclave, envName, changes[stack.RawName])
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			summary = append(summary, stackInfo)
+			return "", nil
+		},
+		func(stack *model.StackConfig) error {
+			return nil
+		})
+
+	errList := errtype.ErrList{}
+	errList.Add(cause)
+	if err != nil {
+		errList.Add(fmt.Errorf("rollback did not finish: %w", err))
+	}
+
+	return &RollbackErr{
+		Cause:  errList.ErrOrNil(),
+		Stacks: summary,
+	}
+}
+
+// rollbackStack rolls back a single stack and waits for it to finish
+func (s EnvService) rollbackStack(ctx context.Context, enclave *model.Enclave, envName string,
+	change stackChange) model.StackInfo {
+	var stackInfo *model.StackInfo
+	var err error
+
+	iacDeploy := change.deployer
+	startTime := time.Now()
+	if change.created {
+		stackInfo, err = iacDeploy.DeleteStack(ctx, change.name, false)
+		if err == nil {
+			err = s.waitForStacksComplete(ctx, enclave, iacDeploy, envName, []string{change.name}, startTime, model.StateDeleted)
+			stackInfo.DeployStatus.State = model.StateDeleted
+		}
+	} else {
+		stackInfo, err = iacDeploy.RollbackStack(ctx, change.name, change.snapshot)
+		if err == nil {
+			// Deployers only report an update or rollback in progress once they started one, a stack they can't act on
+			// is reported in the state it is in
+			switch stackInfo.DeployStatus.State {
+			case model.StateRollingBack:
+				err = s.waitForStacksComplete(ctx, enclave, iacDeploy, envName, []string{change.name}, startTime, model.StateRolledBack)
+			case model.StateUpdating:
+				// The previous version is being deployed again
+				err = s.waitForStacksComplete(ctx, enclave, iacDeploy, envName, []string{change.name}, startTime, model.StateComplete)
+			case model.StateRolledBack, model.StateDryRun:
+				// Already on the previous version
+			default:
+				err = fmt.Errorf("stack %v can't be rolled back from state %v", change.name, stackInfo.DeployStatus.State)
+			}
+			if err == nil {
+				stackInfo.DeployStatus.State = model.StateRolledBack
+			}
+		}
+	}
+
+	if err != nil {
+		nextAction := model.NextActionUpdate
+		if change.created {
+			nextAction = model.NextActionDelete
+		}
+
+		return model.StackInfo{
+			Name:       change.name,
+			NextAction: nextAction,
+			DeployStatus: model.DeployStatus{
+				Name:   change.name,
+				State:  model.StateFailed,
+				Reason: err.Error(),
+			},
+			Resources: []string{},
+		}
+	}
+
+	return *stackInfo
+}
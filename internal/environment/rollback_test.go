@@ -0,0 +1,166 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+func TestEnvService_DeployEnvironmentRollback(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       DeployOpts
+		noSnapshot bool
+		wantStates map[string]model.State
+		wantCalls  []string
+		wantNoCall []string
+	}{
+		{
+			name: "created and updated stacks",
+			opts: DeployOpts{DeployAll: true, Rollback: true},
+			wantStates: map[string]model.State{
+				"dev-vpc": model.StateRolledBack,
+				"dev-db":  model.StateDeleted,
+				"dev-app": model.StateDeleted,
+			},
+			wantCalls: []string{"delete dev-app", "delete dev-db", "rollback dev-vpc"},
+		},
+		{
+			name:       "updated stack without a snapshot",
+			opts:       DeployOpts{DeployAll: true, Rollback: true},
+			noSnapshot: true,
+			wantStates: map[string]model.State{
+				"dev-vpc": model.StateFailed,
+				"dev-db":  model.StateDeleted,
+				"dev-app": model.StateDeleted,
+			},
+			wantCalls: []string{"delete dev-app", "delete dev-db", "rollback dev-vpc"},
+		},
+		{
+			name:       "rollback disabled",
+			opts:       DeployOpts{DeployAll: true},
+			wantNoCall: []string{"delete dev-app", "delete dev-db", "rollback dev-vpc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iacDeploy := newFakeDeployer()
+			iacDeploy.setStack("dev-vpc", model.StateComplete)
+			iacDeploy.params["dev-vpc"] = map[string]string{"Size": "small"}
+			iacDeploy.fail["dev-app"] = true
+			iacDeploy.noSnapshot = tt.noSnapshot
+			svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+				testStack{name: "vpc", params: map[string]string{"Size": "large"}},
+				testStack{name: "db", dependsOn: []string{"vpc"}},
+				testStack{name: "app", dependsOn: []string{"db"}},
+			)
+
+			_, err := svc.DeployEnvironment(context.Background(), "", "", "dev", tt.opts)
+			assert.ErrorContains(t, err, "stack dev-app failed")
+			for _, call := range tt.wantCalls {
+				assert.Contains(t, iacDeploy.callList(), call)
+			}
+			for _, call := range tt.wantNoCall {
+				assert.NotContains(t, iacDeploy.callList(), call)
+			}
+
+			var rollbackErr *RollbackErr
+			if tt.wantStates == nil {
+				assert.False(t, errors.As(err, &rollbackErr))
+				return
+			}
+			assert.True(t, errors.As(err, &rollbackErr))
+
+			states := map[string]model.State{}
+			for _, stackInfo := range rollbackErr.Stacks {
+				states[stackInfo.Name] = stackInfo.DeployStatus.State
+			}
+			assert.Equal(t, tt.wantStates, states)
+
+			// Dependents are rolled back first
+			assert.Less(t, iacDeploy.callIndex("delete dev-app"), iacDeploy.callIndex("delete dev-db"))
+			assert.Less(t, iacDeploy.callIndex("delete dev-db"), iacDeploy.callIndex("rollback dev-vpc"))
+			if !tt.noSnapshot {
+				assert.Equal(t, map[string]string{"Size": "small"}, iacDeploy.params["dev-vpc"])
+			}
+		})
+	}
+}
+
+func TestEnvService_DeployEnvironmentDryRunNoRollback(t *testing.T) {
+	iacDeploy := newFakeDeployer()
+	svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{},
+		testStack{name: "vpc"},
+		testStack{name: "app", dependsOn: []string{"vpc"}},
+	)
+
+	stackInfoList, err := svc.DeployEnvironment(context.Background(), "", "", "dev", DeployOpts{
+		DeployAll: true,
+		Rollback:  true,
+		DryRun:    true,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, stackInfoList, 2)
+	assert.ElementsMatch(t, []string{"create dev-vpc", "create dev-app"}, iacDeploy.callList())
+}
+
+func TestEnvService_RollbackStack(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     model.State
+		created   bool
+		snapshot  *model.StackSnapshot
+		wantState model.State
+		wantCall  string
+	}{
+		{
+			name:      "created stack",
+			state:     model.StateComplete,
+			created:   true,
+			wantState: model.StateDeleted,
+			wantCall:  "delete dev-app",
+		},
+		{
+			name:      "update in progress",
+			state:     model.StateUpdating,
+			wantState: model.StateRolledBack,
+			wantCall:  "rollback dev-app",
+		},
+		{
+			name:      "finished update with a snapshot",
+			state:     model.StateComplete,
+			snapshot:  &model.StackSnapshot{Name: "dev-app", Parameters: map[string]string{"Size": "small"}},
+			wantState: model.StateRolledBack,
+			wantCall:  "rollback dev-app",
+		},
+		{
+			name:      "finished update without a snapshot",
+			state:     model.StateComplete,
+			wantState: model.StateFailed,
+			wantCall:  "rollback dev-app",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iacDeploy := newFakeDeployer()
+			iacDeploy.setStack("dev-app", tt.state)
+			svc := newTestEnvService(t, iacDeploy, model.EnvBehavior{})
+			enclave := &model.Enclave{Retry: testRetry}
+
+			stackInfo := svc.rollbackStack(context.Background(), enclave, "dev", stackChange{
+				stack:    &model.StackConfig{Name: "app", RawName: "app"},
+				name:     "dev-app",
+				deployer: iacDeploy,
+				created:  tt.created,
+				snapshot: tt.snapshot,
+			})
+			assert.Equal(t, tt.wantState, stackInfo.DeployStatus.State)
+			assert.Equal(t, []string{tt.wantCall}, iacDeploy.callList())
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+// withTimeout limits the context to the timeout, 0 means no limit
+func (s EnvService) withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// envTimeoutErr turns an interruption caused by the env timeout into a timeout error that names the stacks that were
+// still in progress. Other errors are returned as is.
+func (s EnvService) envTimeoutErr(parentCtx context.Context, ctx context.Context, envName string,
+	timeout time.Duration, err error) error {
+	var interruptErr *InterruptedErr
+	if parentCtx.Err() != nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) || !errors.As(err, &interruptErr) {
+		return err
+	}
+
+	if len(interruptErr.Stacks) == 0 {
+		return apperr.NewTimeoutError("environment", []string{envName}, timeout)
+	}
+
+	return apperr.NewTimeoutError("stack", interruptErr.Stacks, timeout)
+}
+
+// getStackTimeout returns the timeout of a stack, falling back to the enclave stack_timeout. 0 means no limit.
+func (s EnvService) getStackTimeout(enclave *model.Enclave, stack *model.StackConfig) time.Duration {
+	if stack.Timeout > 0 {
+		return stack.Timeout
+	}
+
+	if enclave.EnvBehavior.StackTimeout != nil {
+		return *enclave.EnvBehavior.StackTimeout
+	}
+
+	return 0
+}
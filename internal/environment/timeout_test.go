@@ -0,0 +1,145 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swizzleio/swiz/internal/apperr"
+	"github.com/swizzleio/swiz/internal/environment/model"
+)
+
+func TestEnvService_DeployEnvironmentTimeout(t *testing.T) {
+	stackTimeout := 20 * time.Millisecond
+	tests := []struct {
+		name      string
+		opts      DeployOpts
+		behavior  model.EnvBehavior
+		dbTimeout time.Duration
+		want      *apperr.TimeoutErr
+	}{
+		{
+			name:      "stack timeout",
+			opts:      DeployOpts{DeployAll: true},
+			dbTimeout: 20 * time.Millisecond,
+			want:      apperr.NewTimeoutError("stack", []string{"dev-db"}, 20*time.Millisecond),
+		},
+		{
+			name:     "enclave stack timeout",
+			opts:     DeployOpts{DeployAll: true},
+			behavior: model.EnvBehavior{StackTimeout: &stackTimeout},
+			want:     apperr.NewTimeoutError("stack", []string{"dev-db"}, stackTimeout),
+		},
+		{
+			name: "env timeout",
+			opts: DeployOpts{DeployAll: true, Timeout: 30 * time.Millisecond},
+			want: apperr.NewTimeoutError("stack", []string{"dev-db"}, 30*time.Millisecond),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iacDeploy := newFakeDeployer()
+			iacDeploy.hang["dev-db"] = true
+			svc := newTestEnvService(t, iacDeploy, tt.behavior,
+				testStack{name: "vpc"},
+				testStack{name: "db", dependsOn: []string{"vpc"}, timeout: tt.dbTimeout},
+				testStack{name: "app", dependsOn: []string{"db"}},
+			)
+
+			_, err := svc.DeployEnvironment(context.Background(), "", "", "dev", tt.opts)
+			var timeoutErr *apperr.TimeoutErr
+			assert.True(t, errors.As(err, &timeoutErr))
+			assert.Equal(t, tt.want, timeoutErr)
+			assert.NotContains(t, iacDeploy.callList(), "create dev-app")
+		})
+	}
+}
+
+func TestEnvService_EnvTimeoutErr(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), 0)
+	defer cancelExpired()
+	stackErr := errors.New("stack dev-app failed")
+
+	tests := []struct {
+		name      string
+		parentCtx context.Context
+		ctx       context.Context
+		err       error
+		want      error
+	}{
+		{
+			name:      "stacks in progress",
+			parentCtx: context.Background(),
+			ctx:       expired,
+			err:       &InterruptedErr{Cause: context.DeadlineExceeded, Stacks: []string{"dev-app"}},
+			want:      apperr.NewTimeoutError("stack", []string{"dev-app"}, time.Minute),
+		},
+		{
+			name:      "no stacks in progress",
+			parentCtx: context.Background(),
+			ctx:       expired,
+			err:       &InterruptedErr{Cause: context.DeadlineExceeded},
+			want:      apperr.NewTimeoutError("environment", []string{"dev"}, time.Minute),
+		},
+		{
+			name:      "cancelled",
+			parentCtx: cancelled,
+			ctx:       cancelled,
+			err:       &InterruptedErr{Cause: context.Canceled, Stacks: []string{"dev-app"}},
+			want:      &InterruptedErr{Cause: context.Canceled, Stacks: []string{"dev-app"}},
+		},
+		{
+			name:      "stack failed",
+			parentCtx: context.Background(),
+			ctx:       context.Background(),
+			err:       stackErr,
+			want:      stackErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := EnvService{}.envTimeoutErr(tt.parentCtx, tt.ctx, "dev", time.Minute, tt.err)
+			assert.Equal(t, tt.want, err)
+		})
+	}
+}
+
+func TestEnvService_GetStackTimeout(t *testing.T) {
+	stackTimeout := time.Hour
+	tests := []struct {
+		name    string
+		enclave *model.Enclave
+		stack   *model.StackConfig
+		want    time.Duration
+	}{
+		{
+			name:    "no timeout",
+			enclave: &model.Enclave{},
+			stack:   &model.StackConfig{},
+		},
+		{
+			name:    "enclave default",
+			enclave: &model.Enclave{EnvBehavior: model.EnvBehavior{StackTimeout: &stackTimeout}},
+			stack:   &model.StackConfig{},
+			want:    time.Hour,
+		},
+		{
+			name:    "stack overrides enclave",
+			enclave: &model.Enclave{EnvBehavior: model.EnvBehavior{StackTimeout: &stackTimeout}},
+			stack:   &model.StackConfig{Timeout: time.Minute},
+			want:    time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, EnvService{}.getStackTimeout(tt.enclave, tt.stack))
+		})
+	}
+}
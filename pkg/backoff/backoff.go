@@ -0,0 +1,75 @@
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Exponential computes jittered exponential backoff delays between retries
+type Exponential struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay returns the delay before the given retry, starting at 0. The delay is picked at random between 0 and
+// Base * 2^attempt, capped at Max.
+func (e Exponential) Delay(attempt int) time.Duration {
+	ceiling := e.Max
+	if attempt < 32 {
+		if exp := e.Base << attempt; exp > 0 && exp < ceiling {
+			ceiling = exp
+		}
+	}
+
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Interval is a poll interval that grows while nothing changes and drops back to Min once there is progress
+type Interval struct {
+	Min     time.Duration
+	Max     time.Duration
+	current time.Duration
+}
+
+func NewInterval(min time.Duration, max time.Duration) *Interval {
+	if max < min {
+		max = min
+	}
+
+	return &Interval{
+		Min:     min,
+		Max:     max,
+		current: min,
+	}
+}
+
+// Next returns how long to wait before the next poll. progress is true if the last poll saw a change.
+func (i *Interval) Next(progress bool) time.Duration {
+	if progress {
+		i.current = i.Min
+		return i.current
+	}
+
+	next := i.current
+	i.current += i.current / 2
+	if i.current > i.Max {
+		i.current = i.Max
+	}
+
+	return next
+}
+
+// Sleep waits for the duration or until the context is done, in which case the context error is returned
+func Sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponential_Delay(t *testing.T) {
+	e := Exponential{
+		Base: 100 * time.Millisecond,
+		Max:  time.Second,
+	}
+
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, e.Delay(0), 100*time.Millisecond)
+		assert.LessOrEqual(t, e.Delay(2), 400*time.Millisecond)
+		assert.LessOrEqual(t, e.Delay(10), time.Second)
+		assert.LessOrEqual(t, e.Delay(100), time.Second)
+		assert.GreaterOrEqual(t, e.Delay(3), time.Duration(0))
+	}
+
+	assert.Equal(t, time.Duration(0), Exponential{}.Delay(3))
+}
+
+func TestInterval_Next(t *testing.T) {
+	i := NewInterval(2*time.Second, 5*time.Second)
+
+	assert.Equal(t, 2*time.Second, i.Next(false))
+	assert.Equal(t, 3*time.Second, i.Next(false))
+	assert.Equal(t, 4500*time.Millisecond, i.Next(false))
+	assert.Equal(t, 5*time.Second, i.Next(false))
+	assert.Equal(t, 5*time.Second, i.Next(false))
+	assert.Equal(t, 2*time.Second, i.Next(true))
+	assert.Equal(t, 2*time.Second, i.Next(false))
+
+	fixed := NewInterval(5*time.Second, 0)
+	assert.Equal(t, 5*time.Second, fixed.Next(false))
+	assert.Equal(t, 5*time.Second, fixed.Next(false))
+}
+
+func TestSleep(t *testing.T) {
+	assert.NoError(t, Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Sleep(ctx, time.Hour), context.Canceled)
+}
@@ -2,23 +2,35 @@ package awswrap
 
 import (
 	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/organizations"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"log"
+	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 )
 
 var DefaultAccountName = "dev"
 
+// DefaultSessionName is the session name used when assuming a role without one
+var DefaultSessionName = "swiz"
+
 type AwsConfig struct {
 	//Name string
 	Profile   string
 	AccountId string
 	Region    string
 	Endpoint  string
+	// RoleArn is a role assumed with the credentials of the profile. The other fields only apply when it is set.
+	RoleArn     string
+	ExternalId  string
+	SessionName string
+	Duration    time.Duration
 }
 
 type AwsConfigManager interface {
@@ -27,7 +39,7 @@ type AwsConfigManager interface {
 }
 
 type AwsConfiger interface {
-	GenerateConfig() aws.Config
+	GenerateConfig() (aws.Config, error)
 }
 
 type AwsConfigManage struct {
@@ -101,13 +113,17 @@ func NewAwsConfig(name, accountId, region string) AwsConfiger {
 	}
 }
 
-// GenerateConfig generates an AWS specific config
-func (a AwsConfig) GenerateConfig() aws.Config {
+// GenerateConfig generates an AWS specific config. When a role is set, the credentials of the profile are used to
+// assume it and the temporary credentials are refreshed before they expire.
+func (a AwsConfig) GenerateConfig() (aws.Config, error) {
 	// Initialize a session that the SDK will use to load
 	// credentials from the shared credentials file ~/.aws/credentials
 	// and region from the shared configuration file ~/.aws/config.
 
-	cfgOpt := config.WithRegion(a.Region)
+	cfgOpts := []func(*config.LoadOptions) error{
+		config.WithRegion(a.Region),
+		config.WithSharedConfigProfile(a.Profile),
+	}
 	if "" != a.Endpoint {
 		customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
 			return aws.Endpoint{
@@ -117,15 +133,80 @@ func (a AwsConfig) GenerateConfig() aws.Config {
 			}, nil
 		})
 
-		cfgOpt = config.WithEndpointResolverWithOptions(customResolver)
+		cfgOpts = append(cfgOpts, config.WithEndpointResolverWithOptions(customResolver))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), cfgOpts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("unable to load AWS profile %v: %w", a.Profile, err)
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), cfgOpt,
-		config.WithSharedConfigProfile(a.Profile))
+	err = a.checkProfile(cfg)
 	if err != nil {
-		// handle error
-		log.Fatalf("creating awswrap session %v", err)
+		return aws.Config{}, err
+	}
+
+	if a.RoleArn != "" {
+		assumeRole := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg, stsRetry), a.RoleArn,
+			func(o *stscreds.AssumeRoleOptions) {
+				o.RoleSessionName = DefaultSessionName
+				if a.SessionName != "" {
+					o.RoleSessionName = a.SessionName
+				}
+				if a.ExternalId != "" {
+					o.ExternalID = aws.String(a.ExternalId)
+				}
+				if a.Duration > 0 {
+					o.Duration = a.Duration
+				}
+			})
+		cfg.Credentials = aws.NewCredentialsCache(assumeRole)
+	}
+
+	return cfg, nil
+}
+
+// stsRetry retries assuming a role as often as the other AWS calls. The role is assumed by the first call that needs
+// credentials, which fails if the role can't be assumed.
+func stsRetry(o *sts.Options) {
+	o.Retryer = retry.AddWithMaxBackoffDelay(retry.AddWithMaxAttempts(retry.NewStandard(), DefaultRetryMaxAttempts),
+		DefaultRetryMaxDelay)
+}
+
+// checkProfile returns an error if the profile is missing from the shared config files. The SDK quietly falls back to
+// the default credentials then, which may be of another account. Credentials in the environment are used over the
+// profile, and without any shared config files the default credentials are all there is, so both are fine.
+func (a AwsConfig) checkProfile(cfg aws.Config) error {
+	if a.Profile == "" {
+		return nil
+	}
+
+	files := []string{config.DefaultSharedConfigFilename(), config.DefaultSharedCredentialsFilename()}
+	for _, src := range cfg.ConfigSources {
+		switch c := src.(type) {
+		case config.SharedConfig:
+			if c.Profile == a.Profile {
+				return nil
+			}
+		case config.EnvConfig:
+			if c.Credentials.HasKeys() || c.WebIdentityTokenFilePath != "" || c.ContainerCredentialsEndpoint != "" ||
+				c.ContainerCredentialsRelativePath != "" {
+				return nil
+			}
+			if c.SharedConfigFile != "" {
+				files[0] = c.SharedConfigFile
+			}
+			if c.SharedCredentialsFile != "" {
+				files[1] = c.SharedCredentialsFile
+			}
+		}
+	}
+
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			return fmt.Errorf("AWS profile %v does not exist", a.Profile)
+		}
 	}
 
-	return cfg
+	return nil
 }
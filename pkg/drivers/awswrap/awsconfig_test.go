@@ -5,7 +5,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/organizations"
 	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
 	"github.com/swizzleio/swiz/mocks/ext/aws"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -139,10 +142,22 @@ func TestGetAllOrgAccounts(t *testing.T) {
 }
 
 func TestGenerateConfig(t *testing.T) {
+	// Keep the profiles and credentials of the machine running the tests out of it
+	cfgFile := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(cfgFile, []byte("[profile other]\nregion = test-region\n"), 0600))
+	t.Setenv("AWS_CONFIG_FILE", cfgFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", cfgFile)
+	for _, envVar := range []string{"AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_WEB_IDENTITY_TOKEN_FILE",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"} {
+		t.Setenv(envVar, "")
+	}
+
 	testCases := []struct {
 		name        string
 		configInput AwsConfig
-		expectPanic bool
+		env         map[string]string
+		assumesRole bool
+		expectErr   bool
 	}{
 		{
 			name: "generates AWS config",
@@ -152,17 +167,97 @@ func TestGenerateConfig(t *testing.T) {
 				Region:    "test-region",
 				Endpoint:  "",
 			},
-			expectPanic: false,
+			// The profile doesn't exist, which is returned instead of panicking
+			expectErr: true,
+		},
+		{
+			name: "generates AWS config from an existing profile",
+			configInput: AwsConfig{
+				Profile: "other",
+				Region:  "test-region",
+			},
+		},
+		{
+			name: "generates AWS config with credentials in the environment",
+			configInput: AwsConfig{
+				Profile: "test-profile",
+				Region:  "test-region",
+			},
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "AKIDEXAMPLE",
+				"AWS_SECRET_ACCESS_KEY": "secret",
+			},
+		},
+		{
+			name: "generates AWS config without a profile",
+			configInput: AwsConfig{
+				Profile:   "",
+				AccountId: "test-account-id",
+				Region:    "test-region",
+				Endpoint:  "",
+			},
+		},
+		{
+			name: "generates AWS config with an endpoint",
+			configInput: AwsConfig{
+				Region:   "test-region",
+				Endpoint: "http://localhost:4566",
+			},
+		},
+		{
+			name: "generates AWS config that assumes a role",
+			configInput: AwsConfig{
+				AccountId:   "test-account-id",
+				Region:      "test-region",
+				RoleArn:     "arn:aws:iam::123456789012:role/deploy",
+				ExternalId:  "neato",
+				SessionName: "swiz-test",
+				Duration:    15 * time.Minute,
+			},
+			assumesRole: true,
+		},
+		{
+			name: "returns an error when the profile of an assumed role doesn't exist",
+			configInput: AwsConfig{
+				Profile: "test-profile",
+				Region:  "test-region",
+				RoleArn: "arn:aws:iam::123456789012:role/deploy",
+			},
+			expectErr: true,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			if tc.expectPanic {
-				assert.Panics(t, func() { tc.configInput.GenerateConfig() })
-			} else {
-				assert.NotPanics(t, func() { tc.configInput.GenerateConfig() })
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			var cfg aws.Config
+			var err error
+			assert.NotPanics(t, func() { cfg, err = tc.configInput.GenerateConfig() })
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.configInput.Region, cfg.Region)
+
+			_, isCache := cfg.Credentials.(*aws.CredentialsCache)
+			if tc.assumesRole {
+				assert.True(t, isCache)
 			}
 		})
 	}
 }
+
+func TestGenerateConfig_BadProfile(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(cfgFile, []byte("[profile broken]\nrole_arn = arn:aws:iam::123456789012:role/deploy\nsource_profile = missing\n"), 0600))
+	t.Setenv("AWS_CONFIG_FILE", cfgFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", cfgFile)
+
+	_, err := AwsConfig{Profile: "broken", Region: "test-region"}.GenerateConfig()
+	assert.Error(t, err)
+}
@@ -0,0 +1,355 @@
+package awswrap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/swizzleio/swiz/pkg/backoff"
+)
+
+const (
+	DefaultRetryMaxAttempts = 8
+	DefaultRetryBaseDelay   = time.Second
+	DefaultRetryMaxDelay    = 30 * time.Second
+)
+
+// throttlingErrorCodes are the API error codes of requests that were turned away for going over a rate limit. The
+// request was never acted on, so it can be sent again even if it changes something.
+var throttlingErrorCodes = map[string]bool{
+	"Throttling":                true,
+	"ThrottlingException":       true,
+	"ThrottledException":        true,
+	"RequestThrottled":          true,
+	"RequestThrottledException": true,
+	"RequestLimitExceeded":      true,
+	"TooManyRequestsException":  true,
+}
+
+// transientErrorCodes are the other API error codes that are worth retrying for calls that only read. The request may
+// have been acted on, so calls that change something are not retried on these.
+var transientErrorCodes = map[string]bool{
+	"RequestTimeout":          true,
+	"RequestTimeoutException": true,
+	"ServiceUnavailable":      true,
+	"InternalFailure":         true,
+	"InternalError":           true,
+}
+
+type RetryOpts struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// retrier retries calls with jittered exponential backoff
+type retrier struct {
+	opts    RetryOpts
+	backoff backoff.Exponential
+}
+
+func newRetrier(opts RetryOpts) retrier {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = DefaultRetryBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultRetryMaxDelay
+	}
+
+	return retrier{
+		opts: opts,
+		backoff: backoff.Exponential{
+			Base: opts.BaseDelay,
+			Max:  opts.MaxDelay,
+		},
+	}
+}
+
+// RetryCloudformation wraps a Cloudformationer and retries calls that fail with throttling or other transient errors.
+// Calls that change something, such as CreateStack, are only retried when they are throttled, so a request that
+// reached CloudFormation is never sent twice. The wrapped client shouldn't retry on its own, see NoSdkRetry.
+type RetryCloudformation struct {
+	client Cloudformationer
+	retrier
+}
+
+func NewRetryCloudformation(client Cloudformationer, opts RetryOpts) Cloudformationer {
+	return &RetryCloudformation{
+		client:  client,
+		retrier: newRetrier(opts),
+	}
+}
+
+// NoSdkRetry turns off the retries of the SDK client, so calls are only retried by RetryCloudformation
+func NoSdkRetry(o *cloudformation.Options) {
+	o.Retryer = aws.NopRetryer{}
+}
+
+// RetryS3 wraps an S3er and retries calls that fail with throttling or other transient errors. Objects are put under
+// a key of their content, so putting one again is safe and puts are retried like reads. The wrapped client shouldn't
+// retry on its own, see NoS3SdkRetry.
+type RetryS3 struct {
+	client S3er
+	retrier
+}
+
+func NewRetryS3(client S3er, opts RetryOpts) S3er {
+	return &RetryS3{
+		client:  client,
+		retrier: newRetrier(opts),
+	}
+}
+
+// NoS3SdkRetry turns off the retries of the SDK client, so calls are only retried by RetryS3
+func NoS3SdkRetry(o *s3.Options) {
+	o.Retryer = aws.NopRetryer{}
+}
+
+// IsRetryableError returns true for throttling, timeouts, server side faults and connection errors
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		return throttlingErrorCodes[code] || transientErrorCodes[code] || apiErr.ErrorFault() == smithy.FaultServer
+	}
+
+	return retry.RetryableConnectionError{}.IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// IsThrottlingError returns true if the request was turned away for going over a rate limit
+func IsThrottlingError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && throttlingErrorCodes[apiErr.ErrorCode()]
+}
+
+func withRetry[T any](ctx context.Context, r retrier, retryable func(error) bool,
+	call func() (T, error)) (T, error) {
+	var resp T
+	var err error
+	for attempt := 0; attempt < r.opts.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if sleepErr := backoff.Sleep(ctx, r.backoff.Delay(attempt)); sleepErr != nil {
+				return resp, err
+			}
+		}
+
+		resp, err = call()
+		if !retryable(err) {
+			return resp, err
+		}
+	}
+
+	return resp, err
+}
+
+func (r *RetryCloudformation) GetTemplateSummary(ctx context.Context, params *cloudformation.GetTemplateSummaryInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateSummaryOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.GetTemplateSummaryOutput, error) {
+		return r.client.GetTemplateSummary(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) CreateStack(ctx context.Context, params *cloudformation.CreateStackInput, optFns ...func(*cloudformation.Options)) (*cloudformation.CreateStackOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.CreateStackOutput, error) {
+		return r.client.CreateStack(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DeleteStack(ctx context.Context, params *cloudformation.DeleteStackInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteStackOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.DeleteStackOutput, error) {
+		return r.client.DeleteStack(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) CreateChangeSet(ctx context.Context, params *cloudformation.CreateChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.CreateChangeSetOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.CreateChangeSetOutput, error) {
+		return r.client.CreateChangeSet(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DeleteChangeSet(ctx context.Context, params *cloudformation.DeleteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteChangeSetOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.DeleteChangeSetOutput, error) {
+		return r.client.DeleteChangeSet(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) ExecuteChangeSet(ctx context.Context, params *cloudformation.ExecuteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ExecuteChangeSetOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.ExecuteChangeSetOutput, error) {
+		return r.client.ExecuteChangeSet(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DescribeStackResources(ctx context.Context, params *cloudformation.DescribeStackResourcesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.DescribeStackResourcesOutput, error) {
+		return r.client.DescribeStackResources(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) GetTemplate(ctx context.Context, params *cloudformation.GetTemplateInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.GetTemplateOutput, error) {
+		return r.client.GetTemplate(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) CancelUpdateStack(ctx context.Context, params *cloudformation.CancelUpdateStackInput, optFns ...func(*cloudformation.Options)) (*cloudformation.CancelUpdateStackOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.CancelUpdateStackOutput, error) {
+		return r.client.CancelUpdateStack(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DescribeChangeSet(ctx context.Context, params *cloudformation.DescribeChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeChangeSetOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.DescribeChangeSetOutput, error) {
+		return r.client.DescribeChangeSet(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DescribeStackEvents(ctx context.Context, params *cloudformation.DescribeStackEventsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackEventsOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.DescribeStackEventsOutput, error) {
+		return r.client.DescribeStackEvents(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DescribeStacks(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.DescribeStacksOutput, error) {
+		return r.client.DescribeStacks(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) CreateStackSet(ctx context.Context, params *cloudformation.CreateStackSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.CreateStackSetOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.CreateStackSetOutput, error) {
+		return r.client.CreateStackSet(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) UpdateStackSet(ctx context.Context, params *cloudformation.UpdateStackSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.UpdateStackSetOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.UpdateStackSetOutput, error) {
+		return r.client.UpdateStackSet(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DeleteStackSet(ctx context.Context, params *cloudformation.DeleteStackSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteStackSetOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.DeleteStackSetOutput, error) {
+		return r.client.DeleteStackSet(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DescribeStackSet(ctx context.Context, params *cloudformation.DescribeStackSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackSetOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.DescribeStackSetOutput, error) {
+		return r.client.DescribeStackSet(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) CreateStackInstances(ctx context.Context, params *cloudformation.CreateStackInstancesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.CreateStackInstancesOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.CreateStackInstancesOutput, error) {
+		return r.client.CreateStackInstances(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DeleteStackInstances(ctx context.Context, params *cloudformation.DeleteStackInstancesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteStackInstancesOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.DeleteStackInstancesOutput, error) {
+		return r.client.DeleteStackInstances(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DescribeStackSetOperation(ctx context.Context, params *cloudformation.DescribeStackSetOperationInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackSetOperationOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.DescribeStackSetOperationOutput, error) {
+		return r.client.DescribeStackSetOperation(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) StopStackSetOperation(ctx context.Context, params *cloudformation.StopStackSetOperationInput, optFns ...func(*cloudformation.Options)) (*cloudformation.StopStackSetOperationOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.StopStackSetOperationOutput, error) {
+		return r.client.StopStackSetOperation(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) ListStackSets(ctx context.Context, params *cloudformation.ListStackSetsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackSetsOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.ListStackSetsOutput, error) {
+		return r.client.ListStackSets(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) ListStackInstances(ctx context.Context, params *cloudformation.ListStackInstancesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackInstancesOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.ListStackInstancesOutput, error) {
+		return r.client.ListStackInstances(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) ListStackSetOperations(ctx context.Context, params *cloudformation.ListStackSetOperationsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackSetOperationsOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.ListStackSetOperationsOutput, error) {
+		return r.client.ListStackSetOperations(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) SetStackPolicy(ctx context.Context, params *cloudformation.SetStackPolicyInput, optFns ...func(*cloudformation.Options)) (*cloudformation.SetStackPolicyOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.SetStackPolicyOutput, error) {
+		return r.client.SetStackPolicy(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) UpdateTerminationProtection(ctx context.Context, params *cloudformation.UpdateTerminationProtectionInput, optFns ...func(*cloudformation.Options)) (*cloudformation.UpdateTerminationProtectionOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.UpdateTerminationProtectionOutput, error) {
+		return r.client.UpdateTerminationProtection(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DetectStackDrift(ctx context.Context, params *cloudformation.DetectStackDriftInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DetectStackDriftOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.DetectStackDriftOutput, error) {
+		return r.client.DetectStackDrift(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DescribeStackDriftDetectionStatus(ctx context.Context, params *cloudformation.DescribeStackDriftDetectionStatusInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+		return r.client.DescribeStackDriftDetectionStatus(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) UpdateStack(ctx context.Context, params *cloudformation.UpdateStackInput, optFns ...func(*cloudformation.Options)) (*cloudformation.UpdateStackOutput, error) {
+	return withRetry(ctx, r.retrier, IsThrottlingError, func() (*cloudformation.UpdateStackOutput, error) {
+		return r.client.UpdateStack(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryCloudformation) DescribeStackResourceDrifts(ctx context.Context, params *cloudformation.DescribeStackResourceDriftsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackResourceDriftsOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*cloudformation.DescribeStackResourceDriftsOutput, error) {
+		return r.client.DescribeStackResourceDrifts(ctx, params, optFns...)
+	})
+}
+
+func (r *RetryS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return withRetry(ctx, r.retrier, IsRetryableError, func() (*s3.HeadObjectOutput, error) {
+		return r.client.HeadObject(ctx, params, optFns...)
+	})
+}
+
+// PutObject rewinds the body before each attempt, since the attempt before read it. A body that can't be rewound is
+// only sent once.
+func (r *RetryS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, canRewind := params.Body.(io.Seeker)
+	retryable := IsRetryableError
+	if params.Body != nil && !canRewind {
+		retryable = func(error) bool { return false }
+	}
+
+	return withRetry(ctx, r.retrier, retryable, func() (*s3.PutObjectOutput, error) {
+		if canRewind {
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		return r.client.PutObject(ctx, params, optFns...)
+	})
+}
@@ -0,0 +1,234 @@
+package awswrap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mockaws "github.com/swizzleio/swiz/mocks/ext/aws"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "nil",
+			err:      nil,
+			expected: false,
+		},
+		{
+			name:     "throttling",
+			err:      &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"},
+			expected: true,
+		},
+		{
+			name:     "server fault",
+			err:      &smithy.GenericAPIError{Code: "Boom", Fault: smithy.FaultServer},
+			expected: true,
+		},
+		{
+			name:     "validation error",
+			err:      &smithy.GenericAPIError{Code: "ValidationError", Message: "Stack does not exist"},
+			expected: false,
+		},
+		{
+			name:     "request timeout",
+			err:      &smithy.GenericAPIError{Code: "RequestTimeout"},
+			expected: true,
+		},
+		{
+			name:     "context canceled",
+			err:      context.Canceled,
+			expected: false,
+		},
+		{
+			name:     "plain error",
+			err:      errors.New("nope"),
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsRetryableError(tc.err))
+		})
+	}
+}
+
+func TestRetryCloudformation_DescribeStacks(t *testing.T) {
+	throttle := &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}
+	opts := RetryOpts{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+	}
+
+	t.Run("retries until success", func(t *testing.T) {
+		client := mockaws.NewCloudformationer(t)
+		expected := &cloudformation.DescribeStacksOutput{}
+		client.On("DescribeStacks", mock.Anything, mock.Anything).Return(nil, throttle).Twice()
+		client.On("DescribeStacks", mock.Anything, mock.Anything).Return(expected, nil).Once()
+
+		resp, err := NewRetryCloudformation(client, opts).DescribeStacks(context.Background(), &cloudformation.DescribeStacksInput{})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		client := mockaws.NewCloudformationer(t)
+		client.On("DescribeStacks", mock.Anything, mock.Anything).Return(nil, throttle).Times(3)
+
+		_, err := NewRetryCloudformation(client, opts).DescribeStacks(context.Background(), &cloudformation.DescribeStacksInput{})
+		assert.ErrorIs(t, err, throttle)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		client := mockaws.NewCloudformationer(t)
+		notFound := &smithy.GenericAPIError{Code: "ValidationError"}
+		client.On("DescribeStacks", mock.Anything, mock.Anything).Return(nil, notFound).Once()
+
+		_, err := NewRetryCloudformation(client, opts).DescribeStacks(context.Background(), &cloudformation.DescribeStacksInput{})
+		assert.ErrorIs(t, err, notFound)
+	})
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	assert.True(t, IsThrottlingError(&smithy.GenericAPIError{Code: "Throttling"}))
+	assert.True(t, IsThrottlingError(&smithy.GenericAPIError{Code: "TooManyRequestsException"}))
+	assert.False(t, IsThrottlingError(&smithy.GenericAPIError{Code: "RequestTimeout"}))
+	assert.False(t, IsThrottlingError(&smithy.GenericAPIError{Code: "Boom", Fault: smithy.FaultServer}))
+	assert.False(t, IsThrottlingError(errors.New("connection reset")))
+	assert.False(t, IsThrottlingError(nil))
+}
+
+func TestRetryCloudformation_CreateStack(t *testing.T) {
+	opts := RetryOpts{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+	}
+
+	t.Run("retries when throttled", func(t *testing.T) {
+		client := mockaws.NewCloudformationer(t)
+		expected := &cloudformation.CreateStackOutput{}
+		client.On("CreateStack", mock.Anything, mock.Anything).Return(nil, &smithy.GenericAPIError{Code: "Throttling"}).Once()
+		client.On("CreateStack", mock.Anything, mock.Anything).Return(expected, nil).Once()
+
+		resp, err := NewRetryCloudformation(client, opts).CreateStack(context.Background(), &cloudformation.CreateStackInput{})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("does not resend a timed out create", func(t *testing.T) {
+		client := mockaws.NewCloudformationer(t)
+		timeout := &smithy.GenericAPIError{Code: "RequestTimeout"}
+		client.On("CreateStack", mock.Anything, mock.Anything).Return(nil, timeout).Once()
+
+		_, err := NewRetryCloudformation(client, opts).CreateStack(context.Background(), &cloudformation.CreateStackInput{})
+		assert.ErrorIs(t, err, timeout)
+	})
+
+	t.Run("does not resend after a server fault", func(t *testing.T) {
+		client := mockaws.NewCloudformationer(t)
+		fault := &smithy.GenericAPIError{Code: "InternalFailure", Fault: smithy.FaultServer}
+		client.On("CreateStack", mock.Anything, mock.Anything).Return(nil, fault).Once()
+
+		_, err := NewRetryCloudformation(client, opts).CreateStack(context.Background(), &cloudformation.CreateStackInput{})
+		assert.ErrorIs(t, err, fault)
+	})
+}
+
+func TestNoSdkRetry(t *testing.T) {
+	o := cloudformation.Options{}
+	NoSdkRetry(&o)
+	assert.Equal(t, 1, o.Retryer.MaxAttempts())
+}
+
+func TestRetryS3_HeadObject(t *testing.T) {
+	opts := RetryOpts{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+	}
+
+	t.Run("retries until success", func(t *testing.T) {
+		client := mockaws.NewS3er(t)
+		expected := &s3.HeadObjectOutput{}
+		client.On("HeadObject", mock.Anything, mock.Anything).Return(nil, &smithy.GenericAPIError{Code: "SlowDown", Fault: smithy.FaultServer}).Once()
+		client.On("HeadObject", mock.Anything, mock.Anything).Return(expected, nil).Once()
+
+		resp, err := NewRetryS3(client, opts).HeadObject(context.Background(), &s3.HeadObjectInput{})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, resp)
+	})
+
+	t.Run("does not retry a missing object", func(t *testing.T) {
+		client := mockaws.NewS3er(t)
+		notFound := &smithy.GenericAPIError{Code: "NotFound"}
+		client.On("HeadObject", mock.Anything, mock.Anything).Return(nil, notFound).Once()
+
+		_, err := NewRetryS3(client, opts).HeadObject(context.Background(), &s3.HeadObjectInput{})
+		assert.ErrorIs(t, err, notFound)
+	})
+}
+
+func TestRetryS3_PutObject(t *testing.T) {
+	timeout := &smithy.GenericAPIError{Code: "RequestTimeout"}
+	opts := RetryOpts{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+	}
+
+	t.Run("resends the whole body", func(t *testing.T) {
+		client := mockaws.NewS3er(t)
+		bodies := []string{}
+		readBody := func(args mock.Arguments) {
+			b, err := io.ReadAll(args.Get(1).(*s3.PutObjectInput).Body)
+			assert.NoError(t, err)
+			bodies = append(bodies, string(b))
+		}
+		client.On("PutObject", mock.Anything, mock.Anything).Run(readBody).Return(nil, timeout).Once()
+		client.On("PutObject", mock.Anything, mock.Anything).Run(readBody).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		_, err := NewRetryS3(client, opts).PutObject(context.Background(), &s3.PutObjectInput{
+			Body: strings.NewReader("template"),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"template", "template"}, bodies)
+	})
+
+	t.Run("does not resend a body that can't be rewound", func(t *testing.T) {
+		client := mockaws.NewS3er(t)
+		client.On("PutObject", mock.Anything, mock.Anything).Return(nil, timeout).Once()
+
+		_, err := NewRetryS3(client, opts).PutObject(context.Background(), &s3.PutObjectInput{
+			Body: io.MultiReader(strings.NewReader("template")),
+		})
+		assert.ErrorIs(t, err, timeout)
+	})
+}
+
+func TestNoS3SdkRetry(t *testing.T) {
+	o := s3.Options{}
+	NoS3SdkRetry(&o)
+	assert.Equal(t, 1, o.Retryer.MaxAttempts())
+}
+
+func TestStsRetry(t *testing.T) {
+	o := sts.Options{}
+	stsRetry(&o)
+	assert.Equal(t, DefaultRetryMaxAttempts, o.Retryer.MaxAttempts())
+}
@@ -34,3 +34,8 @@ func (e *ErrList) Add(err error) {
 
 	e.Errors = append(e.Errors, err)
 }
+
+// Unwrap returns the errors in the list so errors.Is and errors.As can match any of them
+func (e *ErrList) Unwrap() []error {
+	return e.Errors
+}
@@ -43,3 +43,13 @@ func TestErrList_Add(t *testing.T) {
 	assert.Equal(t, 1, len(errList.Errors), "Expected the length of Errors to be 1")
 	assert.Equal(t, err, errList.Errors[0], "Expected the first error to match")
 }
+
+func TestErrList_Unwrap(t *testing.T) {
+	target := errors.New("error2")
+	errList := &ErrList{}
+	errList.Add(errors.New("error1"))
+	errList.Add(target)
+
+	assert.Equal(t, []error{errList.Errors[0], target}, errList.Unwrap(), "Expected Unwrap to return the errors")
+	assert.True(t, errors.Is(errList, target), "Expected errors.Is to match an error in the list")
+}
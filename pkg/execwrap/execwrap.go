@@ -0,0 +1,82 @@
+package execwrap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultStopWait is how long a cancelled command gets to exit after it is interrupted before it is killed
+const DefaultStopWait = 30 * time.Second
+
+type Cmd struct {
+	Name  string
+	Args  []string
+	Dir   string
+	Env   map[string]string // Added to the environment of the current process
+	Stdin []byte
+}
+
+//go:generate mockery --name Execer --filename execer_mock.go --output ../../mocks/pkg/execwrap --outpkg mockexecwrap
+type Execer interface {
+	Run(ctx context.Context, cmd Cmd) ([]byte, error)
+}
+
+type Exec struct {
+	stopWait time.Duration
+}
+
+func NewExec() Execer {
+	return &Exec{
+		stopWait: DefaultStopWait,
+	}
+}
+
+// Run runs the command and returns what it wrote to stdout. If the context is cancelled, the command is sent an
+// interrupt so it can stop cleanly. A failed command returns an error that includes its stderr.
+func (e Exec) Run(ctx context.Context, c Cmd) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = append(os.Environ(), e.envList(c.Env)...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = e.stopWait
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if c.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(c.Stdin)
+	}
+
+	err := cmd.Run()
+	if err != nil {
+		return stdout.Bytes(), fmt.Errorf("%v failed: %w: %v", e.describe(c), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (e Exec) describe(c Cmd) string {
+	if len(c.Args) == 0 {
+		return c.Name
+	}
+
+	return fmt.Sprintf("%v %v", c.Name, c.Args[0])
+}
+
+func (e Exec) envList(env map[string]string) []string {
+	retVal := []string{}
+	for k, v := range env {
+		retVal = append(retVal, fmt.Sprintf("%v=%v", k, v))
+	}
+	sort.Strings(retVal)
+
+	return retVal
+}
@@ -0,0 +1,47 @@
+package execwrap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExec_Run(t *testing.T) {
+	e := NewExec()
+
+	out, err := e.Run(context.Background(), Cmd{
+		Name:  "sh",
+		Args:  []string{"-c", "cat; echo \" $SWIZ_TEST\"; pwd"},
+		Dir:   "/",
+		Env:   map[string]string{"SWIZ_TEST": "neato"},
+		Stdin: []byte("hello"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello neato\n/\n", string(out))
+}
+
+func TestExec_RunError(t *testing.T) {
+	e := NewExec()
+
+	_, err := e.Run(context.Background(), Cmd{
+		Name: "sh",
+		Args: []string{"-c", "echo bad things >&2; exit 3"},
+	})
+	assert.EqualError(t, err, "sh -c failed: exit status 3: bad things")
+}
+
+func TestExec_RunCancel(t *testing.T) {
+	e := &Exec{stopWait: time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := e.Run(ctx, Cmd{
+		Name: "sleep",
+		Args: []string{"10"},
+	})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -2,10 +2,13 @@ package preprocessor
 
 import (
 	"fmt"
+	"sync"
 )
 
+// ParamStore holds global params and stack outputs. It is safe for concurrent use.
 type ParamStore struct {
 	params map[string]string
+	mu     sync.RWMutex
 }
 
 func NewParamStore(params map[string]string) *ParamStore {
@@ -19,6 +22,9 @@ func NewParamStore(params map[string]string) *ParamStore {
 }
 
 func (s *ParamStore) GetParam(paramName string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.params[CleanTemplateParam(paramName)]
 }
 
@@ -38,6 +44,10 @@ func (s *ParamStore) SetParam(stackName string, paramName string, paramValue str
 	if stackName != "" {
 		paramName = fmt.Sprintf("%v.%v", stackName, paramName)
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.params[paramName] = paramValue
 }
 
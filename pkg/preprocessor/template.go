@@ -20,6 +20,21 @@ func IsTemplateReplaceParam(paramName string) bool {
 	return strings.HasPrefix(paramName, "{{") && strings.HasSuffix(paramName, "}}")
 }
 
+// ParseOutputRef parses a {{stack_name.output_name}} template param into the stack and output name. ok is false when the
+// value is not a reference to a stack output.
+func ParseOutputRef(value string) (stackName string, outputName string, ok bool) {
+	if !IsTemplateReplaceParam(value) {
+		return "", "", false
+	}
+
+	stackName, outputName, ok = strings.Cut(CleanTemplateParam(value), ".")
+	if !ok || stackName == "" || outputName == "" {
+		return "", "", false
+	}
+
+	return stackName, outputName, true
+}
+
 func ParseTemplateTokens(template string, replaceIdx map[string]string) string {
 	// Regular expression to match {{var:length}} format
 	re := regexp.MustCompile(`{{(\w+):(\d+)}}`)
@@ -21,6 +21,22 @@ func TestIsTemplateReplaceParam(t *testing.T) {
 	assert.False(t, isParam, "Expected IsTemplateReplaceParam to return false")
 }
 
+func TestParseOutputRef(t *testing.T) {
+	stackName, outputName, ok := ParseOutputRef("{{swizboot.SleepTestFunctionArn}}")
+	assert.True(t, ok, "Expected ParseOutputRef to find an output reference")
+	assert.Equal(t, "swizboot", stackName, "Expected ParseOutputRef to return the stack name")
+	assert.Equal(t, "SleepTestFunctionArn", outputName, "Expected ParseOutputRef to return the output name")
+
+	_, _, ok = ParseOutputRef("{{LogLevel}}")
+	assert.False(t, ok, "Expected ParseOutputRef to ignore global params")
+
+	_, _, ok = ParseOutputRef("swizboot.SleepTestFunctionArn")
+	assert.False(t, ok, "Expected ParseOutputRef to ignore static values")
+
+	_, _, ok = ParseOutputRef("{{swizboot.}}")
+	assert.False(t, ok, "Expected ParseOutputRef to ignore an empty output name")
+}
+
 func TestParseTemplateTokens(t *testing.T) {
 	testCases := []struct {
 		desc        string